@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// Archive formats of add --output.
+const (
+	archiveTar = "tar"
+	archiveZip = "zip"
+)
+
+// stdoutFile is the --output-file writing to the standard output.
+const stdoutFile = "-"
+
+// writeArchive writes into w the archive of the format with the files in dir.
+func writeArchive(w io.Writer, format, dir string, files []string) error {
+	switch format {
+	case archiveTar:
+		return writeTar(w, dir, files)
+	case archiveZip:
+		return writeZip(w, dir, files)
+	default:
+		return garchetype.WithHint(fmt.Errorf("unknown archive format %q", format), "editor-and-archives", "Use tar or zip")
+	}
+}
+
+// writeTar writes into w the tarball of the files in dir.
+func writeTar(w io.Writer, dir string, files []string) error {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		h, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.ToSlash(f)
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writeZip writes into w the zip archive of the files in dir, the symbolic
+// links stored as such.
+func writeZip(w io.Writer, dir string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		h, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		h.Name, h.Method = filepath.ToSlash(f), zip.Deflate
+		fw, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		var b []byte
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			var link string
+			link, err = os.Readlink(p)
+			b = []byte(filepath.ToSlash(link))
+		case fi.Mode().IsRegular():
+			b, err = os.ReadFile(p)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(b); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
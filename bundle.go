@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// recentLogLines is the number of diagnostics kept for the diagnostic bundle.
+const recentLogLines = 200
+
+// recentLogs keeps the latest diagnostics of every level, whatever the log
+// level, for the diagnostic bundle.
+var recentLogs = &logRing{max: recentLogLines}
+
+// logRing is a writer keeping its latest lines.
+type logRing struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		r.lines = append(r.lines, l)
+	}
+	if n := len(r.lines) - r.max; n > 0 {
+		r.lines = r.lines[n:]
+	}
+	return len(p), nil
+}
+
+// writeTo writes the kept lines to w.
+func (r *logRing) writeTo(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.lines {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// levelWriter writes the diagnostics of the min level or higher to w.
+type levelWriter struct {
+	w   io.Writer
+	min zerolog.Level
+}
+
+func (lw levelWriter) Write(p []byte) (int, error) {
+	return lw.w.Write(p)
+}
+
+func (lw levelWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	if l < lw.min {
+		return len(p), nil
+	}
+	return lw.w.Write(p)
+}
+
+// safeRun runs run, turning a panic into an error naming the diagnostic bundle
+// written about it.
+func safeRun(ctx context.Context, stdout, stderr io.Writer, args []string) (err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		stack := debug.Stack()
+		f, werr := writeBundle(v, stack, args)
+		if werr != nil {
+			err = fmt.Errorf("internal error: %v\n%s", v, stack)
+			return
+		}
+		err = fmt.Errorf("internal error: %v, please attach the diagnostic bundle %s to an issue", v, f)
+	}()
+	return run(ctx, stdout, stderr, args)
+}
+
+// writeBundle writes the diagnostic bundle of the panic v with its stack to a
+// temporary file, and returns its path. The bundle holds the build info, the
+// command line and the environment variables with the secrets masked, the
+// stack trace and the recent diagnostics.
+func writeBundle(v any, stack []byte, args []string) (string, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s diagnostic bundle, %s\n\n", exeName, time.Now().Format(time.RFC3339))
+	getBuildInfo().print(&b)
+	fmt.Fprintf(&b, "\ncommand: %s\n\n", strings.Join(sanitizeArgs(args), " "))
+	layers := make(envLayers)
+	for _, e := range environment {
+		if _, ok := os.LookupEnv(e.Name); ok {
+			layers[e.Name] = layerEnv
+		}
+	}
+	if err := layers.print(&b); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "\npanic: %v\n\n%s\nrecent diagnostics:\n", v, stack)
+	recentLogs.writeTo(&b)
+	f, err := os.CreateTemp("", exeName+"-crash-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(b.Bytes()); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// inputFlags are the flags taking input values as key=value.
+var inputFlags = []string{"i", "input"}
+
+// secretFlag reports whether the values of the flag name must be masked: the
+// input values and the flags named like a secret variable, e.g. --token.
+func secretFlag(name string) bool {
+	return slices.Contains(inputFlags, name) || maskSecret(strings.ToUpper(name), name) != name
+}
+
+// sanitizeArgs returns the command line args with the values of the secret
+// flags, the generator input values, the ones after --, and the passwords of
+// the URLs masked. The input names are kept.
+func sanitizeArgs(args []string) []string {
+	sanitized := make([]string, len(args))
+	inputs := false
+	flag := "" // The secret flag whose value is the next arg.
+	maskInput := func(a string) string {
+		if name, _, ok := strings.Cut(a, "="); ok {
+			return name + "=****"
+		}
+		return "****"
+	}
+	for i, a := range args {
+		switch {
+		case inputs:
+			name, _, ok := strings.Cut(a, "=")
+			if !ok && !strings.HasPrefix(a, "-") {
+				a = "****"
+			} else if ok {
+				a = name + "=****"
+			}
+		case flag != "":
+			if slices.Contains(inputFlags, flag) {
+				a = maskInput(a)
+			} else {
+				a = "****"
+			}
+			flag = ""
+		case a == "--":
+			inputs = true
+		case strings.HasPrefix(a, "-"):
+			name, v, ok := strings.Cut(strings.TrimLeft(a, "-"), "=")
+			switch {
+			case !secretFlag(name):
+				a = maskSecret("", a)
+			case !ok:
+				flag = name
+			case slices.Contains(inputFlags, name):
+				a = a[:len(a)-len(v)] + maskInput(v)
+			default:
+				a = a[:len(a)-len(v)] + "****"
+			}
+		default:
+			a = maskSecret("", a)
+		}
+		sanitized[i] = a
+	}
+	return sanitized
+}
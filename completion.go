@@ -0,0 +1,200 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/diegosz/flaggy"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// completeCommand is the hidden command the completion scripts run to get the
+// candidates of the word being completed.
+const completeCommand = "__complete"
+
+// completionMaxAge skips syncing the source listed within it, so completing
+// doesn't wait on the network.
+const completionMaxAge = 24 * time.Hour
+
+// completionScripts are the completion scripts of the shells, deferring to
+// the complete command.
+var completionScripts = map[string]string{
+	"bash": `_garchetype() {
+	local IFS=$'\n'
+	COMPREPLY=($(garchetype __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _garchetype garchetype
+`,
+	"zsh": `#compdef garchetype
+_garchetype() {
+	local -a candidates
+	candidates=("${(@f)$(garchetype __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _garchetype garchetype
+`,
+	"fish": `complete -c garchetype -f -a '(garchetype __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`,
+}
+
+// printCompletion writes the completion script of the shell to w.
+func printCompletion(w io.Writer, shell string) error {
+	s, ok := completionScripts[shell]
+	if !ok {
+		return garchetype.WithHint(fmt.Errorf("unknown shell %q", shell), "other-commands", "Use bash, zsh or fish")
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// completion is the state of the command line being completed.
+type completion struct {
+	p  *flaggy.Parser
+	sc *flaggy.Subcommand // nil before the subcommand
+	// flags are the values of the flags given, by long name.
+	flags map[string]string
+}
+
+// complete writes to w the candidates of the last of the words typed after
+// the command name, possibly empty, one per line: the subcommands, the flags,
+// or the archetypes and transformations of the source. Nothing is written for
+// the shell to complete the file names.
+func complete(ctx context.Context, w io.Writer, cfg *Config, p *flaggy.Parser, words []string) error {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	c := &completion{p: p, flags: make(map[string]string)}
+	cur, typed := words[len(words)-1], words[:len(words)-1]
+	var value *flaggy.Flag // The flag the current word is the value of.
+	for i := 0; i < len(typed); i++ {
+		w := typed[i]
+		switch {
+		case w == "--":
+			return nil // The trailing inputs.
+		case strings.HasPrefix(w, "-"):
+			name, v, ok := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			f := c.flag(name)
+			if f == nil || ok || isBool(f) {
+				if f != nil {
+					c.flags[f.LongName] = v
+				}
+				continue
+			}
+			if i+1 == len(typed) {
+				value = f
+				continue
+			}
+			i++
+			c.flags[f.LongName] = typed[i]
+		case c.sc == nil:
+			c.sc = subcommand(p.Subcommands, w)
+		}
+	}
+	var candidates []string
+	switch {
+	case value != nil && value.LongName == "archetype":
+		candidates = c.archetypes(ctx, cfg, "")
+	case value != nil && value.LongName == "transformation":
+		candidates = c.archetypes(ctx, cfg, cmp.Or(c.flags["archetype"], cfg.Archetype, defaultArchetype))
+	case value != nil:
+	case strings.HasPrefix(cur, "-"):
+		for _, f := range c.visibleFlags() {
+			if f.LongName != "" {
+				candidates = append(candidates, "--"+f.LongName)
+			}
+			if f.ShortName != "" {
+				candidates = append(candidates, "-"+f.ShortName)
+			}
+		}
+	case c.sc == nil:
+		for _, sc := range p.Subcommands {
+			if !sc.Hidden {
+				candidates = append(candidates, sc.Name)
+			}
+		}
+	}
+	for _, cd := range candidates {
+		if strings.HasPrefix(cd, cur) {
+			fmt.Fprintln(w, cd)
+		}
+	}
+	return nil
+}
+
+// subcommand returns the subcommand of scs named name, or nil.
+func subcommand(scs []*flaggy.Subcommand, name string) *flaggy.Subcommand {
+	for _, sc := range scs {
+		if name != "" && (sc.Name == name || sc.ShortName == name) {
+			return sc
+		}
+	}
+	return nil
+}
+
+// visibleFlags returns the global flags and the ones of the subcommand.
+func (c *completion) visibleFlags() []*flaggy.Flag {
+	fs := visibleFlags(c.p.Flags)
+	if c.sc != nil {
+		fs = append(fs, visibleFlags(c.sc.Flags)...)
+	}
+	return fs
+}
+
+// flag returns the flag named name, long or short, or nil.
+func (c *completion) flag(name string) *flaggy.Flag {
+	for _, f := range c.visibleFlags() {
+		if f.HasName(name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// isBool reports whether the flag f takes no value.
+func isBool(f *flaggy.Flag) bool {
+	_, ok := f.AssignmentVar.(*bool)
+	return ok
+}
+
+// archetypes returns the archetypes of the source, or the transformations of
+// the archetype if set. The source is listed as cached, and nothing is
+// returned if it isn't there yet, rather than cloning it.
+func (c *completion) archetypes(ctx context.Context, cfg *Config, archetype string) []string {
+	o := garchetype.Options{
+		SourceDir:        cmp.Or(c.flags["source-dir"], cfg.SourceDir),
+		ArchetypesFolder: cmp.Or(c.flags["archetypes-folder"], cfg.ArchetypesFolder),
+		MaxAge:           completionMaxAge,
+	}
+	if _, err := os.Stat(o.SourceDir); o.SourceDir == "" || err != nil {
+		return nil
+	}
+	as, err := garchetype.List(ctx, o)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, a := range as {
+		if archetype == "" {
+			names = append(names, a.Name)
+			continue
+		}
+		if a.Name != strings.Split(archetype, "@")[0] {
+			continue
+		}
+		for _, t := range a.Transformations {
+			names = append(names, t.Name)
+			names = append(names, t.Aliases...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diegosz/flaggy"
+)
+
+// commandDoc is the reference of a command, taken from the flaggy definitions.
+type commandDoc struct {
+	Name        string // full name, e.g. garchetype add
+	Description string
+	Flags       []*flaggy.Flag
+	Subcommands []*flaggy.Subcommand
+	// Global flags, only set for the subcommands.
+	Global []*flaggy.Flag
+}
+
+// commandDocs returns the reference of the p command and its visible
+// subcommands.
+func commandDocs(p *flaggy.Parser) []commandDoc {
+	root := commandDoc{Name: p.Name, Description: p.Description, Flags: visibleFlags(p.Flags)}
+	var docs []commandDoc
+	for _, sc := range p.Subcommands {
+		if sc.Hidden {
+			continue
+		}
+		root.Subcommands = append(root.Subcommands, sc)
+		docs = append(docs, commandDoc{
+			Name:        p.Name + " " + sc.Name,
+			Description: sc.Description,
+			Flags:       visibleFlags(sc.Flags),
+			Global:      root.Flags,
+		})
+	}
+	return append([]commandDoc{root}, docs...)
+}
+
+func visibleFlags(fs []*flaggy.Flag) []*flaggy.Flag {
+	var v []*flaggy.Flag
+	for _, f := range fs {
+		if !f.Hidden {
+			v = append(v, f)
+		}
+	}
+	return v
+}
+
+// fileName returns the base name of the command pages, e.g. garchetype-add.
+func (d commandDoc) fileName() string {
+	return strings.ReplaceAll(d.Name, " ", "-")
+}
+
+// writeDocs writes the man pages of the p command and its subcommands into
+// dir, along with the markdown reference pages if markdown.
+func writeDocs(p *flaggy.Parser, dir string, markdown bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, d := range commandDocs(p) {
+		if err := os.WriteFile(filepath.Join(dir, d.fileName()+".1"), []byte(d.man()), 0o644); err != nil {
+			return err
+		}
+		if !markdown {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, d.fileName()+".md"), []byte(d.markdown()), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roffEscaper escapes the roff special characters.
+var roffEscaper = strings.NewReplacer(`\`, `\\`, "-", `\-`, "'", `\(aq`)
+
+func roff(s string) string {
+	s = roffEscaper.Replace(s)
+	if strings.HasPrefix(s, ".") {
+		s = `\&` + s // Don't mistake it for a request.
+	}
+	return s
+}
+
+// man returns the roff man page of the command.
+func (d commandDoc) man() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"%s %s\" \"%s manual\"\n", strings.ToUpper(roff(d.fileName())), exeName, Version, exeName)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff(d.fileName()), roff(d.Description))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B %s\n", roff(d.Name))
+	switch {
+	case d.Subcommands != nil:
+		b.WriteString("[\\fIflags\\fR] \\fIcommand\\fR [\\fIflags\\fR]\n")
+	default:
+		b.WriteString("[\\fIflags\\fR]\n")
+	}
+	if d.Subcommands != nil {
+		b.WriteString(".SH COMMANDS\n")
+		for _, sc := range d.Subcommands {
+			fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", roff(sc.Name), roff(sc.Description))
+		}
+	}
+	manFlags(&b, "OPTIONS", d.Flags)
+	manFlags(&b, "GLOBAL OPTIONS", d.Global)
+	b.WriteString(".SH SEE ALSO\n")
+	if d.Subcommands != nil {
+		var refs []string
+		for _, sc := range d.Subcommands {
+			refs = append(refs, fmt.Sprintf(".BR %s (1)", roff(exeName+"-"+sc.Name)))
+		}
+		b.WriteString(strings.Join(refs, ",\n") + "\n")
+	} else {
+		fmt.Fprintf(&b, ".BR %s (1)\n", exeName)
+	}
+	return b.String()
+}
+
+func manFlags(b *strings.Builder, section string, fs []*flaggy.Flag) {
+	if len(fs) == 0 {
+		return
+	}
+	fmt.Fprintf(b, ".SH %s\n", section)
+	for _, f := range fs {
+		fmt.Fprintf(b, ".TP\n.B %s\n%s\n", roff(flagNames(f)), roff(f.Description))
+	}
+}
+
+// markdown returns the markdown reference page of the command.
+func (d commandDoc) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n%s\n\n```shell\n%s [flags]", d.Name, d.Description, d.Name)
+	if d.Subcommands != nil {
+		b.WriteString(" command [flags]")
+	}
+	b.WriteString("\n```\n")
+	if d.Subcommands != nil {
+		b.WriteString("\n## Commands\n\n")
+		for _, sc := range d.Subcommands {
+			fmt.Fprintf(&b, "- [%s](%s-%s.md): %s\n", sc.Name, exeName, sc.Name, sc.Description)
+		}
+	}
+	markdownFlags(&b, "Flags", d.Flags)
+	markdownFlags(&b, "Global flags", d.Global)
+	return b.String()
+}
+
+func markdownFlags(b *strings.Builder, section string, fs []*flaggy.Flag) {
+	if len(fs) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n\n| Flag | Description |\n|------|-------------|\n", section)
+	for _, f := range fs {
+		fmt.Fprintf(b, "| `%s` | %s |\n", flagNames(f), strings.ReplaceAll(f.Description, "|", `\|`))
+	}
+}
+
+// flagNames returns the flag names as used in the command line, e.g. -f, --feature.
+func flagNames(f *flaggy.Flag) string {
+	var ns []string
+	if f.ShortName != "" {
+		ns = append(ns, "-"+f.ShortName)
+	}
+	if f.LongName != "" {
+		ns = append(ns, "--"+f.LongName)
+	}
+	return strings.Join(ns, ", ")
+}
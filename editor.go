@@ -0,0 +1,46 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// editorCommand returns the command line of the editor: GARCHETYPE_EDITOR,
+// VISUAL or EDITOR, in that order.
+func editorCommand() string {
+	return cmp.Or(os.Getenv(envPrefix+"_EDITOR"), os.Getenv("VISUAL"), os.Getenv("EDITOR"))
+}
+
+// openFiles opens the primary files of the features of the rs reports in the
+// editor, or their folders if the archetypes don't tell them.
+func openFiles(ctx context.Context, p *printer, rs []*garchetype.Report) error {
+	editor := strings.Fields(editorCommand())
+	if len(editor) == 0 {
+		p.warnf("Set GARCHETYPE_EDITOR, VISUAL or EDITOR to open the generated files.")
+		return nil
+	}
+	var paths []string
+	for _, r := range rs {
+		if len(r.Primary) == 0 {
+			paths = append(paths, filepath.Join(r.Destination, filepath.FromSlash(r.Subpath)))
+			continue
+		}
+		for _, f := range r.Primary {
+			paths = append(paths, filepath.Join(r.Destination, filepath.FromSlash(f)))
+		}
+	}
+	cmd := exec.CommandContext(ctx, editor[0], append(editor[1:], paths...)...) //nolint:gosec // The user editor.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return garchetype.WithHint(fmt.Errorf("editor %s: %w", editor[0], err), "editor-and-archives",
+			"Check the GARCHETYPE_EDITOR, VISUAL or EDITOR command line")
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// envVar is an environment variable garchetype reads.
+type envVar struct {
+	Name    string
+	Default string
+}
+
+var environment = []envVar{
+	{envPrefix + "_ARCHETYPE", defaultArchetype},
+	{envPrefix + "_ARCHETYPES_FOLDER", garchetype.DefaultArchetypesFolder},
+	{envPrefix + "_ENV", ""},
+	{envPrefix + "_ENV_OVERLOAD", "false"},
+	{envPrefix + "_SOURCE_DIR", ""},
+	{envPrefix + "_SOURCE_REPO", ""},
+	{envPrefix + "_SOURCE_RELEASE", ""},
+	{envPrefix + "_SOURCE_AUTH", ""},
+	{envPrefix + "_PLUGINS_DIR", ""},
+	{envPrefix + "_CACHE_MAX_SIZE", ""},
+	{envPrefix + "_TRANSFORMATION", ""},
+	{envPrefix + "_MAX_AGE", "0s"},
+	{envPrefix + "_LOCK_TIMEOUT", garchetype.DefaultLockTimeout.String()},
+	{envPrefix + "_REGISTRY", ""},
+	{envPrefix + "_REGISTRY_TOKEN", ""},
+	{envPrefix + "_SERVE_TOKEN", ""},
+	{envPrefix + "_TELEMETRY_URL", ""},
+	{envPrefix + "_PR_TOKEN", ""},
+	{envPrefix + "_EDITOR", ""},
+	{envPrefix + "_PAGER", ""},
+	{envPrefix + "_NO_PAGER", "false"},
+	{envPrefix + "_FORCE", "false"},
+	{envPrefix + "_NO_GIT", "false"},
+	{envPrefix + "_NO_HOOKS", "false"},
+	{envPrefix + "_CONFLICTS", garchetype.ConflictsTheirs},
+	{envPrefix + "_CHECK_UPDATES", "false"},
+	{envPrefix + "_SENTINEL", ""},
+	{envPrefix + "_QUIET", "false"},
+	{envPrefix + "_YES", "false"},
+	{envPrefix + "_PLAIN", "false"},
+	{envPrefix + "_THEME", "emoji"},
+	{envPrefix + "_LOG_FORMAT", logFormatText},
+	{envPrefix + "_LOG_LEVEL", defaultLogLevel},
+	{envPrefix + "_VERBOSE", "false"},
+}
+
+// Layers supplying the environment variables.
+const (
+	layerEnv     = "env"
+	layerDotEnv  = ".env file"
+	layerDefault = "default"
+)
+
+// envLayers records the layer supplying each environment variable, as the .env
+// files are loaded into the process environment.
+type envLayers map[string]string
+
+// loadEnv loads the env files, the default .env file and the one named by
+// GARCHETYPE_ENV into the process environment, and returns the layers the
+// garchetype variables come from. The later env files take precedence over the
+// earlier ones, so personal overrides can be layered over team defaults. Unless
+// overload, the files don't override the variables already set.
+func loadEnv(files []string, overload bool) (envLayers, error) {
+	layers := make(envLayers)
+	for _, e := range environment {
+		if _, ok := os.LookupEnv(e.Name); ok {
+			layers[e.Name] = layerEnv
+		}
+	}
+	// load loads the file, recording the variables it sets or changes.
+	load := func(file, layer string) error {
+		before := make(map[string]string)
+		for _, e := range environment {
+			before[e.Name] = os.Getenv(e.Name)
+		}
+		fn := godotenv.Load
+		if overload {
+			fn = godotenv.Overload
+		}
+		if err := fn(file); err != nil {
+			return err
+		}
+		for _, e := range environment {
+			v, ok := os.LookupEnv(e.Name)
+			if _, seen := layers[e.Name]; ok && (!seen || v != before[e.Name]) {
+				layers[e.Name] = layer
+			}
+		}
+		return nil
+	}
+	files = slices.Clone(files)
+	explicit := func() error {
+		for _, f := range files {
+			if err := load(f, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	implicit := func() error { return loadImplicitEnv(load) }
+	// Without overloading the first file setting a variable wins, otherwise
+	// the last one does. Either way the explicit files win over the implicit
+	// ones.
+	first, second := explicit, implicit
+	if overload {
+		first, second = implicit, explicit
+	} else {
+		slices.Reverse(files)
+	}
+	if err := first(); err != nil {
+		return nil, err
+	}
+	if err := second(); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// loadImplicitEnv loads the default .env file, if any, and the one named by
+// GARCHETYPE_ENV.
+func loadImplicitEnv(load func(file, layer string) error) error {
+	// Try to read the default .env file in the current path into ENV for this
+	// process. Unless overloading, it WILL NOT OVERRIDE an env variable that
+	// already exists - consider the .env file to set dev vars or sensible
+	// defaults.
+	_ = load(".env", layerDotEnv)
+	if env := os.Getenv(envPrefix + "_ENV"); env != "" {
+		return load(env, env)
+	}
+	return nil
+}
+
+// resolvedVar is the resolved value of an environment variable.
+type resolvedVar struct {
+	Value string `json:"value"`
+	Layer string `json:"layer"`
+}
+
+// resolve returns the resolved value of the environment variable e, with the
+// secrets masked.
+func (l envLayers) resolve(e envVar) resolvedVar {
+	v, layer := e.Default, layerDefault
+	if src, ok := l[e.Name]; ok {
+		v, layer = os.Getenv(e.Name), src
+	}
+	return resolvedVar{Value: maskSecret(e.Name, v), Layer: layer}
+}
+
+// print writes the garchetype environment variables to w, with their resolved
+// values and the layer supplying them.
+func (l envLayers) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd // Column padding.
+	for _, e := range environment {
+		rv := l.resolve(e)
+		fmt.Fprintf(tw, "%s\t%s\t(%s)\n", e.Name, rv.Value, rv.Layer)
+	}
+	return tw.Flush()
+}
+
+// printJSON writes the garchetype environment variables to w as a JSON object
+// keyed by name.
+func (l envLayers) printJSON(w io.Writer) error {
+	vars := make(map[string]resolvedVar, len(environment))
+	for _, e := range environment {
+		vars[e.Name] = l.resolve(e)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vars)
+}
+
+// printExport writes the garchetype environment variables to w as export
+// commands for the shell to eval. The secrets are left out, and so are the
+// empty variables, the same as unset.
+func (l envLayers) printExport(w io.Writer) error {
+	for _, e := range environment {
+		v := e.Default
+		if _, ok := l[e.Name]; ok {
+			v = os.Getenv(e.Name)
+		}
+		switch {
+		case v == "":
+			continue
+		case maskSecret(e.Name, v) != v:
+			fmt.Fprintf(w, "# %s is a secret, not exported.\n", e.Name)
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "export %s=%s\n", e.Name, shellQuote(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote returns s single-quoted for the POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// secretNames are the words naming variables that hold secrets.
+var secretNames = []string{"TOKEN", "SECRET", "PASSWORD", "KEY"}
+
+// maskSecret masks the value of the variable name if it's a secret, or the
+// password of a URL value.
+func maskSecret(name, value string) string {
+	if value == "" {
+		return value
+	}
+	for _, s := range secretNames {
+		if strings.Contains(name, s) {
+			return "****"
+		}
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+// envFileArgs returns the values of the --env-file flags in args, which are
+// needed before parsing them, as the env files provide the flag defaults.
+func envFileArgs(args []string) []string {
+	var files []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return files
+		case a == "--env-file" && i+1 < len(args):
+			i++
+			files = append(files, args[i])
+		case strings.HasPrefix(a, "--env-file="):
+			files = append(files, strings.TrimPrefix(a, "--env-file="))
+		}
+	}
+	return files
+}
+
+// envOverloadArg reports whether args have the --env-overload flag, see
+// envFileArgs.
+func envOverloadArg(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		if a == "--env-overload" || a == "--env-overload=true" {
+			return true
+		}
+	}
+	v, _ := envBool(envPrefix + "_ENV_OVERLOAD")
+	return v
+}
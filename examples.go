@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// example is a curated sequence of commands of the examples command.
+type example struct {
+	Topic       string
+	Title       string
+	Description string
+	Steps       []exampleStep
+}
+
+// exampleStep is a command of an example, explained by its comment.
+type exampleStep struct {
+	Comment string
+	Command string
+}
+
+// examples are the topics of the examples command, in the order they're
+// listed.
+var examples = []example{
+	{
+		Topic:       "setup",
+		Title:       "First-time setup",
+		Description: "Install garchetype and add a first feature from the team archetypes.",
+		Steps: []exampleStep{
+			{"Install the latest release.", "go install github.com/diegosz/garchetype@latest"},
+			{"Clone the archetypes source and list its archetypes.", "garchetype list -s ../archetypes -r git@github.com:acme/archetypes.git"},
+			{"Keep the source for the next runs, e.g. in a .env file of the project.", "echo 'GARCHETYPE_SOURCE_DIR=../archetypes' >> .env"},
+			{"Review what the archetype would run or write before its first use.", "garchetype inspect http-service"},
+			{"Add the feature, reviewing the files before writing them.", "garchetype add -a http-service -f payments --preview"},
+		},
+	},
+	{
+		Topic:       "private-repos",
+		Title:       "Private archetypes repositories",
+		Description: "Clone the archetypes of private repositories, locally and in CI jobs.",
+		Steps: []exampleStep{
+			{"Over ssh, the ssh agent or the default private key is used.", "garchetype list -r git@github.com:acme/private-archetypes.git -s ../private-archetypes"},
+			{"Over HTTPS, the git credential helpers are tried, e.g. after logging in with gh.", "gh auth setup-git && garchetype list -r https://github.com/acme/private-archetypes.git -s ../private-archetypes"},
+			{"In GitLab CI, with the token of the job.", "garchetype list -r https://gitlab.acme.com/platform/archetypes.git -s ../archetypes --source-auth gitlab-job-token"},
+			{"With a GitHub App, given by its environment variables.", "GITHUB_APP_ID=123 GITHUB_APP_INSTALLATION_ID=456 GITHUB_APP_PRIVATE_KEY=\"$(cat app.pem)\" garchetype list -r https://github.com/acme/archetypes.git -s ../archetypes --source-auth github-app"},
+			{"From the packages of a GitHub release, GITHUB_TOKEN giving access to it.", "garchetype list --source-release acme/archetypes@v2.0.0"},
+		},
+	},
+	{
+		Topic:       "ci",
+		Title:       "CI usage",
+		Description: "Run garchetype unattended, with ASCII output and no prompts.",
+		Steps: []exampleStep{
+			{"Never prompt, accepting the defaults, and print ASCII status lines.", "export GARCHETYPE_YES=true GARCHETYPE_THEME=ascii"},
+			{"Check the archetypes of the source, building the rendered Go code.", "garchetype validate -s . -a http-service --build -f payments -- --port 8080"},
+			{"Run the golden cases of the archetypes, writing a JUnit report.", "garchetype test -s . --junit report.xml"},
+			{"Add a feature with the inputs of a file, skipping the hooks.", "garchetype add -a http-service -f payments --var-file inputs.yaml --no-hooks"},
+			{"Add it and open a pull request with it.", "GARCHETYPE_PR_TOKEN=$GITHUB_TOKEN garchetype add -a http-service -f payments --var-file inputs.yaml --pr"},
+		},
+	},
+	{
+		Topic:       "upgrade",
+		Title:       "Upgrade flow",
+		Description: "Keep garchetype and the generated features up to date.",
+		Steps: []exampleStep{
+			{"Check whether there's a newer garchetype release, and install it.", "garchetype self-update --check && garchetype self-update"},
+			{"List the features applied to the project, with their archetype versions.", "garchetype features"},
+			{"See what changed in the archetype between the applied version and the latest one.", "garchetype diff -s ../archetypes -a http-service --from v1.4.0 -f payments"},
+			{"Generate the feature again over the existing one, reviewing the changes.", "garchetype add -a http-service -f payments --force --preview"},
+		},
+	},
+}
+
+// printExamples prints the commands of the example of topic to w, or the
+// topics without it.
+func printExamples(w io.Writer, topic string) error {
+	if topic == "" {
+		for _, e := range examples {
+			fmt.Fprintf(w, "%-14s %s\n", e.Topic, e.Title)
+		}
+		fmt.Fprintf(w, "\nRun '%s examples <topic>' to print its commands.\n", exeName)
+		return nil
+	}
+	for _, e := range examples {
+		if e.Topic != topic {
+			continue
+		}
+		fmt.Fprintf(w, "# %s\n#\n# %s\n", e.Title, e.Description)
+		for _, s := range e.Steps {
+			fmt.Fprintf(w, "\n# %s\n%s\n", s.Comment, s.Command)
+		}
+		return nil
+	}
+	topics := make([]string, len(examples))
+	for i, e := range examples {
+		topics[i] = e.Topic
+	}
+	return fmt.Errorf("unknown examples topic %q, use one of %s", topic, strings.Join(topics, ", "))
+}
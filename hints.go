@@ -0,0 +1,42 @@
+package main
+
+import "github.com/diegosz/garchetype/pkg/garchetype"
+
+// optionFlags are the flags, or the environment variables, setting the library
+// options the hints name.
+var optionFlags = map[garchetype.Option]string{
+	"Options.SourceDir":            "--source-dir (or " + envPrefix + "_SOURCE_DIR)",
+	"Options.SourceRepo":           "--source-repo",
+	"Options.SourceRelease":        "--source-release",
+	"Options.ArchetypesFolder":     "--archetypes-folder",
+	"Options.Archetype":            "-a",
+	"Options.FeatureName":          "-f",
+	"Options.Transformation":       "-t",
+	"Options.Module":               "-m",
+	"Options.Force":                "--force",
+	"Options.ForceLarge":           "--force-large",
+	"Options.NoGit":                "--no-git",
+	"Options.NoHooks":              "--no-hooks",
+	"Options.Sentinel":             "--sentinel",
+	"Options.NoSentinel":           "--no-gomod",
+	"Options.StrictDeprecations":   "--strict-deprecations",
+	"Options.LockTimeout":          "--lock-timeout",
+	"DiffOptions.From":             "--from",
+	"PublishOptions.Version":       "--version",
+	"PublishOptions.Registry":      "--registry",
+	"PublishOptions.RegistryToken": envPrefix + "_REGISTRY_TOKEN",
+	"ValidateOptions.Build":        "--build",
+	"Rename.to":                    "--to",
+	"Watch.dest":                   "--dest",
+}
+
+// cliHint returns the hint of the library error he in the terms of the
+// command line, naming the flags setting the options.
+func cliHint(he *garchetype.HintError) string {
+	return he.Format(func(o garchetype.Option) string {
+		if f, ok := optionFlags[o]; ok {
+			return f
+		}
+		return string(o)
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Languages of the CLI messages.
+const (
+	langEnglish = "en"
+	langSpanish = "es"
+)
+
+// lang is the language of the CLI messages, see setLang.
+var lang = langEnglish
+
+// catalogs hold the translations of the CLI messages by language, keyed by
+// their English format. The messages missing from a catalog are printed in
+// English.
+var catalogs = map[string]map[string]string{
+	langSpanish: {
+		// Status lines.
+		"%d cache entries removed, %s reclaimed.":           "%d entradas de la caché eliminadas, %s liberados.",
+		"%d cache entries would be removed, reclaiming %s.": "Se eliminarían %d entradas de la caché, liberando %s.",
+		"%s (%s, last used %s)":                             "%s (%s, usado por última vez el %s)",
+		"%d files changed between %s and %s.":               "%d archivos cambiaron entre %s y %s.",
+		"%d files changed.":                                 "%d archivos cambiaron.",
+		"%d files created, %d modified, %d unchanged, %d skipped, %d lines added, %d removed.": "%d archivos creados, %d modificados, %d sin cambios, %d omitidos, %d líneas agregadas, %d eliminadas.",
+		"%d files differ from the golden output":                                               "%d archivos difieren de la salida de referencia",
+		"%d features have archetype updates available, run '%s status'.":                       "%d funcionalidades tienen actualizaciones del arquetipo, ejecute '%s status'.",
+		"%d findings to review in archetype '%s'.":                                             "%d hallazgos para revisar en el arquetipo '%s'.",
+		"%d golden cases passed.":                                                              "%d casos de referencia aprobados.",
+		"%d golden cases updated.":                                                             "%d casos de referencia actualizados.",
+		"%s %s is available, run '%s self-update' to install it.":                              "%s %s está disponible, ejecute '%s self-update' para instalarlo.",
+		"%s %s is up to date.":                                                                 "%s %s está actualizado.",
+		"%s rendered %d files into %s":                                                         "%s se generaron %d archivos en %s",
+		"%s updated from %s to %s.":                                                            "%s actualizado de %s a %s.",
+		"Adding '%s' feature using '%s' archetype.":                                            "Agregando la funcionalidad '%s' con el arquetipo '%s'.",
+		"Archetype '%s' %s published to %s":                                                    "Arquetipo '%s' %s publicado en %s",
+		"Archetype '%s' is valid.":                                                             "El arquetipo '%s' es válido.",
+		"Archetype written: %s (%d files)":                                                     "Arquetipo escrito: %s (%d archivos)",
+		"Archetype: %s%s%s%s":                                                                  "Arquetipo: %s%s%s%s",
+		"Catalog index written: %s":                                                            "Índice del catálogo escrito: %s",
+		"Could not send the %s tarball: %s":                                                    "No se pudo enviar el tarball de %s: %s",
+		"Could not send the response: %s":                                                      "No se pudo enviar la respuesta: %s",
+		"1 feature has archetype updates available, run '%s status'.":                          "1 funcionalidad tiene actualizaciones del arquetipo, ejecute '%s status'.",
+		"Feature '%s' added to %s.":                                                            "Funcionalidad '%s' agregada en %s.",
+		"Feature '%s' added.":                                                                  "Funcionalidad '%s' agregada.",
+		"Feature '%s' exported as the '%s' archetype.":                                         "Funcionalidad '%s' exportada como el arquetipo '%s'.",
+		"Feature '%s' written to the %s archive.":                                              "Funcionalidad '%s' escrita en el archivo %s.",
+		"Feature '%s' written to the standard output as a %s archive.":                         "Funcionalidad '%s' escrita en la salida estándar como archivo %s.",
+		"Feature '%s' renamed to '%s'.":                                                        "Funcionalidad '%s' renombrada a '%s'.",
+		"Feature: %s%s - %s archetype %s, %s available":                                        "Funcionalidad: %s%s - arquetipo %s %s, %s disponible",
+		"Feature: %s - %s archetype, applied %s%s":                                             "Funcionalidad: %s - arquetipo %s, aplicada el %s%s",
+		"No changes between %s and %s.":                                                        "No hay cambios entre %s y %s.",
+		"Archetype: %s - %d features":                                                          "Arquetipo: %s - %d funcionalidades",
+		"Archetype: %s - %d features, versions %s":                                             "Arquetipo: %s - %d funcionalidades, versiones %s",
+		"Oldest feature: %s - %s archetype, applied %s":                                        "Funcionalidad más antigua: %s - arquetipo %s, aplicada el %s",
+		"%d features, %d generated files.":                                                     "%d funcionalidades, %d archivos generados.",
+		"No features applied to the project.":                                                  "No hay funcionalidades aplicadas al proyecto.",
+		"Nothing added to the remaining targets.":                                              "No se agregó nada a los destinos restantes.",
+		"Applying '%s' transformation to '%s' feature.":                                        "Aplicando la transformación '%s' a la funcionalidad '%s'.",
+		"Transformation '%s' applied to '%s' feature.":                                         "Transformación '%s' aplicada a la funcionalidad '%s'.",
+		"Nothing applied.":                                                                     "No se aplicó nada.",
+		"Set GARCHETYPE_EDITOR, VISUAL or EDITOR to open the generated files.":                 "Defina GARCHETYPE_EDITOR, VISUAL o EDITOR para abrir los archivos generados.",
+		"Variables of the %s template:":                                                        "Variables de la plantilla %s:",
+		"Nothing added.":                                                                       "No se agregó nada.",
+		"Nothing to review in archetype '%s'.":                                                 "Nada para revisar en el arquetipo '%s'.",
+		"Package written: %s":                                                                  "Paquete escrito: %s",
+		"Passed: %s/%s":                                                                        "Aprobado: %s/%s",
+		"Pull request of the '%s' branch opened: %s":                                           "Pull request de la rama '%s' abierto: %s",
+		"Serving the archetypes API on %s, press Ctrl+C to stop.":                              "Sirviendo la API de arquetipos en %s, presione Ctrl+C para detener.",
+		"Source: %s": "Origen: %s",
+		"The archetypes of the applied features are up to date.": "Los arquetipos de las funcionalidades aplicadas están actualizados.",
+		"The generated files are already up to date.":            "Los archivos generados ya están actualizados.",
+		"Transformation: %s%s%s%s":                               "Transformación: %s%s%s%s",
+		"Updated: %s/%s":                                         "Actualizado: %s/%s",
+		"Using version %s of the archetype, tagged %s.":          "Usando la versión %s del arquetipo, etiquetada %s.",
+		"Using transformation file: %s":                          "Usando el archivo de transformación: %s",
+		"Watching the '%s' archetype, press Ctrl+C to stop.":     "Observando el arquetipo '%s', presione Ctrl+C para detener.",
+		// Errors.
+		"%s error: %s": "error de %s: %s",
+		"See %s":       "Vea %s",
+		"warning:":     "aviso:",
+		"hint:":        "sugerencia:",
+		// Prompts.
+		"Feature name":   "Nombre de la funcionalidad",
+		"Archetype":      "Arquetipo",
+		"Transformation": "Transformación",
+		"Confirm":        "Confirmar",
+		"Abort":          "Cancelar",
+		"%s was changed in the project, resolve it how?":                     "%s cambió en el proyecto, ¿cómo resolverlo?",
+		"Take the generated version":                                         "Tomar la versión generada",
+		"Keep the current version":                                           "Mantener la versión actual",
+		"Write conflict markers to resolve by hand":                          "Escribir marcadores de conflicto para resolver a mano",
+		"Open the merge tool":                                                "Abrir la herramienta de merge",
+		"%d files to write, select one to see its diff:":                     "%d archivos para escribir, seleccione uno para ver sus diferencias:",
+		"The '%s' archetype requires '%s', not applied yet. Apply it first?": "El arquetipo '%s' requiere '%s', que aún no se aplicó. ¿Aplicarlo primero?",
+	},
+}
+
+// setLang sets the language of the CLI messages, name or the one of the
+// LC_ALL, LC_MESSAGES or LANG locale, e.g. es_AR.UTF-8, English by default.
+// Only an unsupported name is an error, the unsupported locales are English.
+func setLang(name string) error {
+	if name != "" {
+		l := langCode(name)
+		if _, ok := catalogs[l]; !ok && l != langEnglish {
+			return fmt.Errorf("unsupported language %q, use %s or %s", name, langEnglish, langSpanish)
+		}
+		lang = l
+		return nil
+	}
+	l := langCode(cmp.Or(os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")))
+	if _, ok := catalogs[l]; ok {
+		lang = l
+	}
+	return nil
+}
+
+// langCode returns the language code of the locale, e.g. es for es_AR.UTF-8.
+func langCode(locale string) string {
+	l, _, _ := strings.Cut(locale, ".")
+	l, _, _ = strings.Cut(l, "@")
+	l, _, _ = strings.Cut(strings.ReplaceAll(l, "-", "_"), "_")
+	return strings.ToLower(l)
+}
+
+// tr returns the translation of the English message format, or the format
+// itself.
+func tr(format string) string {
+	if t, ok := catalogs[lang][format]; ok {
+		return t
+	}
+	return format
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// junitSuites is the root of a JUnit XML report, with a suite per archetype.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// writeJUnit writes the outcome of the golden cases tcs to file as a JUnit XML
+// report, the format CI systems publish.
+func writeJUnit(file string, tcs []garchetype.TestCase) error {
+	var r junitSuites
+	var total time.Duration
+	var durations []time.Duration // Of the suites.
+	for _, tc := range tcs {
+		if len(r.Suites) == 0 || r.Suites[len(r.Suites)-1].Name != tc.Archetype {
+			r.Suites = append(r.Suites, junitSuite{Name: tc.Archetype})
+			durations = append(durations, 0)
+		}
+		s := &r.Suites[len(r.Suites)-1]
+		durations[len(durations)-1] += tc.Duration
+		jc := junitCase{Name: tc.Name, Classname: tc.Archetype, Time: seconds(tc.Duration)}
+		switch {
+		case tc.Err != nil:
+			jc.Error = &junitFailure{Message: tc.Err.Error(), Text: tc.Err.Error()}
+			s.Errors++
+		case len(tc.Diffs) > 0:
+			var patch strings.Builder
+			for _, d := range tc.Diffs {
+				patch.WriteString(d.Patch)
+			}
+			jc.Failure = &junitFailure{Message: fmt.Sprintf("%d files differ from the golden output", len(tc.Diffs)), Text: patch.String()}
+			s.Failures++
+		}
+		s.Cases = append(s.Cases, jc)
+		s.Tests++
+		total += tc.Duration
+	}
+	for i := range r.Suites {
+		s := &r.Suites[i]
+		s.Time = seconds(durations[i])
+		r.Tests += s.Tests
+		r.Failures += s.Failures
+		r.Errors += s.Errors
+	}
+	r.Time = seconds(total)
+	b, err := xml.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append([]byte(xml.Header), append(b, '\n')...), 0o644) //nolint:gosec,mnd // A report to publish.
+}
+
+// seconds formats d as the seconds of a JUnit time attribute.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
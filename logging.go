@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/diegosz/go-archetype/log"
+	"github.com/rs/zerolog"
+)
+
+// Log formats of the diagnostics.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// defaultLogLevel is the level of the diagnostics unless told otherwise.
+const defaultLogLevel = "warn"
+
+// logLevels are the accepted log levels.
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// zeroLogger is the go-archetype logger backed by zerolog, writing to any
+// writer in either log format.
+type zeroLogger struct {
+	logger zerolog.Logger
+}
+
+// newLogger returns the logger writing the diagnostics, both garchetype and
+// go-archetype ones, to w in the given format. The text format is colored on
+// terminals unless plain. The recent diagnostics of every level are kept for
+// the diagnostic bundle.
+func newLogger(w io.Writer, format, level string, plain bool) (log.Logger, error) {
+	if !slices.Contains(logLevels, level) {
+		return nil, fmt.Errorf("invalid log level %q, use one of %s", level, strings.Join(logLevels, ", "))
+	}
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	var out io.Writer
+	switch format {
+	case logFormatText:
+		out = zerolog.ConsoleWriter{Out: w, TimeFormat: " ", NoColor: plain || !isTerminal(w)}
+	case logFormatJSON:
+		out = w
+	default:
+		return nil, fmt.Errorf("invalid log format %q, use %s or %s", format, logFormatText, logFormatJSON)
+	}
+	zl := zerolog.New(zerolog.MultiLevelWriter(levelWriter{w: out, min: lvl}, recentLogs))
+	return &zeroLogger{logger: zl.With().Timestamp().Logger()}, nil
+}
+
+func (l *zeroLogger) Debugf(format string, args ...any) {
+	l.logger.Debug().Msgf(format, args...)
+}
+
+func (l *zeroLogger) Infof(format string, args ...any) {
+	l.logger.Info().Msgf(format, args...)
+}
+
+func (l *zeroLogger) Warnf(format string, args ...any) {
+	l.logger.Warn().Msgf(format, args...)
+}
+
+func (l *zeroLogger) Errorf(format string, args ...any) {
+	l.logger.Error().Msgf(format, args...)
+}
+
+func (l *zeroLogger) Fatalf(format string, args ...any) {
+	l.logger.Fatal().Msgf(format, args...)
+}
@@ -4,40 +4,40 @@ import (
 	"bytes"
 	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/diegosz/flaggy"
-	"github.com/diegosz/go-archetype/generator"
 	"github.com/diegosz/go-archetype/log"
-	"github.com/gogs/git-module"
-	"github.com/joho/godotenv"
 	"go.uber.org/multierr"
-	"golang.org/x/mod/modfile"
 
-	"github.com/diegosz/garchetype/internal/gitstat"
+	"github.com/diegosz/garchetype/pkg/garchetype"
 )
 
 const (
-	exeName                 = "garchetype"
-	envPrefix               = "GARCHETYPE"
-	transformationPrefix    = "transformations-"
-	transformationExt       = "yaml"
-	defaultArchetypesFolder = "archetypes"
-	defaultTransformation   = "default"
-	defaultArchetype        = "hello-world"
-	featureNameID           = "feature_name"
-	goModNameID             = "gomod_name"
+	exeName          = "garchetype"
+	envPrefix        = "GARCHETYPE"
+	defaultArchetype = "hello-world"
+	defaultServeAddr = "localhost:8080"
 )
 
 var ErrSilentExit = errors.New("silent exit")
 
 func main() {
-	if err := run(context.Background(), os.Stdout, os.Stderr, os.Args); err != nil {
+	// Cancel the running git commands on Ctrl+C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := safeRun(ctx, os.Stdout, os.Stderr, os.Args)
+	stop()
+	if err != nil {
 		if !errors.Is(err, ErrSilentExit) {
 			fmt.Fprintf(os.Stderr, "💥 %s error: %s\n", exeName, err)
 		}
@@ -47,378 +47,1228 @@ func main() {
 }
 
 type Config struct {
-	Force            bool
-	FeatureName      string
-	ArchetypesFolder string
-	Archetype        string
-	Transformation   string
-	SourceDir        string
-	SourceRepo       string
+	Force              bool
+	NoGit              bool
+	FeatureName        string
+	ArchetypesFolder   string
+	Archetype          string
+	Transformation     string
+	SourceDir          string
+	SourceRepo         string
+	SourceRelease      string
+	SourceAuth         string
+	PluginsDir         string
+	CacheMaxSize       string
+	cacheMaxSize       int64 // CacheMaxSize parsed.
+	Lang               string
+	Theme              string
+	VarFile            string
+	StdinVars          bool
+	Subpath            string
+	Module             string
+	Dests              []string
+	TargetsFile        string
+	Sentinel           string
+	NoGoMod            bool
+	Preview            bool
+	Only               []string
+	Exclude            []string
+	Provenance         bool
+	LineEndings        string
+	StrictDeprecations bool
+	StrictVars         bool
+	ForceLarge         bool
+	NoHooks            bool
+	DebugTemplates     bool
+	Trace              bool
+	diag               *printer // Diagnostics, e.g. the --debug-templates ones.
+	Conflicts          string
+	CheckUpdates       bool
+	PullRequest        bool
+	Open               bool
+	Output             string
+	OutputFile         string
+	PRToken            string
+	AllSources         bool
+	Remote             bool
+	MaxAge             time.Duration
+	LockTimeout        time.Duration
+	Quiet              bool
+	Yes                bool
+	Plain              bool
+	NoPager            bool
+	LogFormat          string
+	LogLevel           string
+	Verbose            bool
+	TelemetryURL       string
 }
 
 // newDefaultConfig returns a new default config with the default values set.
 func newDefaultConfig() *Config {
-	var force bool
-	switch strings.ToLower(os.Getenv(envPrefix + "_VERBOSE")) {
-	case "yes", "ok", "t", "true":
-		force = true
-	default:
+	plain, ok := envBool(envPrefix + "_PLAIN")
+	if !ok {
+		plain = noColor()
 	}
+	force, _ := envBool(envPrefix + "_FORCE")
+	noGit, _ := envBool(envPrefix + "_NO_GIT")
+	noHooks, _ := envBool(envPrefix + "_NO_HOOKS")
+	checkUpdates, _ := envBool(envPrefix + "_CHECK_UPDATES")
+	quiet, _ := envBool(envPrefix + "_QUIET")
+	yes, _ := envBool(envPrefix + "_YES")
+	verbose, _ := envBool(envPrefix + "_VERBOSE")
+	noPager, _ := envBool(envPrefix + "_NO_PAGER")
+	maxAge, _ := time.ParseDuration(os.Getenv(envPrefix + "_MAX_AGE"))
+	lockTimeout, _ := time.ParseDuration(os.Getenv(envPrefix + "_LOCK_TIMEOUT"))
 	return &Config{
 		Force:            force,
-		ArchetypesFolder: cmp.Or(os.Getenv(envPrefix+"_ARCHETYPES_FOLDER"), defaultArchetypesFolder),
-		Archetype:        cmp.Or(os.Getenv(envPrefix+"_ARCHETYPE"), defaultArchetype),
-		Transformation:   cmp.Or(os.Getenv(envPrefix+"_TRANSFORMATION"), defaultTransformation),
+		NoGit:            noGit,
+		NoHooks:          noHooks,
+		CheckUpdates:     checkUpdates,
+		Quiet:            quiet,
+		Yes:              yes,
+		Verbose:          verbose,
+		Plain:            plain,
+		NoPager:          noPager,
+		LogFormat:        cmp.Or(os.Getenv(envPrefix+"_LOG_FORMAT"), logFormatText),
+		LogLevel:         cmp.Or(os.Getenv(envPrefix+"_LOG_LEVEL"), defaultLogLevel),
+		ArchetypesFolder: cmp.Or(os.Getenv(envPrefix+"_ARCHETYPES_FOLDER"), garchetype.DefaultArchetypesFolder),
+		Archetype:        os.Getenv(envPrefix + "_ARCHETYPE"),      // Defaulted after parsing.
+		Transformation:   os.Getenv(envPrefix + "_TRANSFORMATION"), // Defaulted after parsing.
 		SourceDir:        os.Getenv(envPrefix + "_SOURCE_DIR"),
 		SourceRepo:       os.Getenv(envPrefix + "_SOURCE_REPO"),
+		SourceRelease:    os.Getenv(envPrefix + "_SOURCE_RELEASE"),
+		SourceAuth:       os.Getenv(envPrefix + "_SOURCE_AUTH"),
+		PluginsDir:       os.Getenv(envPrefix + "_PLUGINS_DIR"),
+		CacheMaxSize:     os.Getenv(envPrefix + "_CACHE_MAX_SIZE"),
+		Conflicts:        os.Getenv(envPrefix + "_CONFLICTS"),
+		Theme:            os.Getenv(envPrefix + "_THEME"),
+		Sentinel:         os.Getenv(envPrefix + "_SENTINEL"),
+		MaxAge:           maxAge,
+		LockTimeout:      lockTimeout,
+		TelemetryURL:     os.Getenv(envPrefix + "_TELEMETRY_URL"),
+		PRToken:          os.Getenv(envPrefix + "_PR_TOKEN"),
+		OutputFile:       stdoutFile,
 	}
 }
 
-var environment = []string{
-	envPrefix + "_ARCHETYPE",
-	envPrefix + "_ARCHETYPES_FOLDER",
-	envPrefix + "_ENV",
-	envPrefix + "_SOURCE_DIR",
-	envPrefix + "_SOURCE_REPO",
-	envPrefix + "_TRANSFORMATION",
-	envPrefix + "_FORCE",
+// envBool returns the boolean value of the environment variable name, and
+// whether it's set.
+func envBool(name string) (value, ok bool) {
+	v, ok := os.LookupEnv(name)
+	switch strings.ToLower(v) {
+	case "yes", "ok", "t", "true":
+		return true, ok
+	default:
+		return false, ok
+	}
 }
 
-func run(_ context.Context, stdout, _ io.Writer, args []string) (err error) {
-	// Try to read the default .env file in the current path into ENV for this
-	// process. It WILL NOT OVERRIDE an env variable that already exists -
-	// consider the .env file to set dev vars or sensible defaults.
-	_ = godotenv.Load()
+func run(ctx context.Context, stdout, stderr io.Writer, args []string) (err error) {
+	envFiles, envOverload := envFileArgs(args[1:]), envOverloadArg(args[1:])
+	layers, err := loadEnv(envFiles, envOverload)
+	if err != nil {
+		return err
+	}
 
 	flaggy.ShowHelpOnUnexpectedEnable()
 	flaggy.SetName(exeName)
 	flaggy.SetDescription("Tool for scaffolding using archetypes.")
-	flaggy.SetVersion(Version)
+	flaggy.DefaultParser.DisableShowVersionWithVersion() // See the version command.
 
-	if env := os.Getenv(envPrefix + "_ENV"); env != "" {
-		if err := godotenv.Load(env); err != nil {
-			return err
-		}
+	cfg := newDefaultConfig()      // Set the default values prior to parsing.
+	_ = setLang("")                // The locale one, until --lang is parsed.
+	t, err := loadTheme(cfg.Theme) // The env one, until --theme is parsed.
+	if err != nil {
+		t = themes[themeEmoji]
 	}
+	diag := newPrinter(stderr, cfg.Plain, t, log.NopLogger{}, false)
+	defer func() {
+		if err != nil && !errors.Is(err, ErrSilentExit) {
+			diag.reportError(err)
+			err = ErrSilentExit
+		}
+	}()
 
-	cfg := newDefaultConfig() // Set the default values prior to parsing.
+	flaggy.StringSlice(&envFiles, "", "env-file", "Dotenv file to load, can be repeated, the later ones take precedence.")
+	flaggy.Bool(&envOverload, "", "env-overload", "Let the dotenv files override the environment variables.")
+	flaggy.Bool(&cfg.Quiet, "q", "quiet", "Print only the errors, without the status lines.")
+	flaggy.Bool(&cfg.Yes, "y", "yes", "Don't prompt, accept the defaults and confirmations.")
+	flaggy.String(&cfg.Lang, "", "lang", "Language of the messages: en or es, by default the one of the locale.")
+	flaggy.String(&cfg.Theme, "", "theme", "Status symbols and colors: emoji, ascii, none or a theme file.")
+	flaggy.Bool(&cfg.Plain, "", "plain", "Print plain text, without emoji.")
+	flaggy.Bool(&cfg.Plain, "", "no-emoji", "Same as --plain.")
+	flaggy.Bool(&cfg.NoPager, "", "no-pager", "Don't page the long listings, diffs and descriptions on terminals.")
+	flaggy.String(&cfg.LogFormat, "", "log-format", "Diagnostics format on stderr: text or json.")
+	flaggy.String(&cfg.LogLevel, "", "log-level", "Diagnostics level: debug, info, warn or error.")
+	flaggy.String(&cfg.PluginsDir, "", "plugins-dir", "Folder of the plugins providing template functions.")
+	flaggy.String(&cfg.CacheMaxSize, "", "cache-max-size", "Maximum size of the cached sources, e.g. 2GiB, evicting the least recently used ones.")
+	flaggy.Duration(&cfg.LockTimeout, "", "lock-timeout", "How long to wait for another process syncing the same source, e.g. 1m, or -1s to fail at once.")
+	flaggy.Bool(&cfg.NoGit, "", "no-git", "Run outside a git repository, skipping the git checks and variables of the project.")
+	flaggy.Bool(&cfg.Verbose, "v", "verbose", "Print the debug diagnostics, same as --log-level debug.")
 
 	addCommand := flaggy.NewSubcommand("add")
 	addCommand.Description = "Add a feature using an archetype."
-	addCommand.Bool(&cfg.Force, "", "force", "Force adding on a dirty repo.")
+	addCommand.Bool(&cfg.Force, "", "force", "Force adding on a dirty repo, or over an existing feature.")
+	var conflicts [4]bool // See conflictFlags.
+	addCommand.Bool(&conflicts[0], "", "theirs", "Write the generated files over the existing ones they change.")
+	addCommand.Bool(&conflicts[1], "", "ours", "Keep the existing files the generation would change.")
+	addCommand.Bool(&conflicts[2], "", "manual", "Write conflict markers into the existing files the generation changes.")
+	addCommand.Bool(&conflicts[3], "", "mergetool", "Resolve the existing files the generation changes with the git merge tool.")
 	addCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to add.")
-	addCommand.String(&cfg.Archetype, "a", "archetype", "Archetype to use.")
+	addCommand.String(&cfg.Archetype, "a", "archetype", "Archetype to use, e.g. grpc-service, or grpc-service@^1.2 for its highest tagged version in the range.")
 	addCommand.String(&cfg.Transformation, "t", "transformation", "Transformation to use.")
 	addCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
 	addCommand.String(&cfg.SourceRepo, "r", "source-repo", "Source repository to use.")
+	addCommand.String(&cfg.SourceRelease, "", "source-release", "GitHub release with the archetype packages to use, as org/repo@tag.")
+	addCommand.String(&cfg.SourceAuth, "", "source-auth", "Authentication of the source repository: github-app, gitlab-job-token or gitea-token.")
+	addCommand.String(&cfg.ArchetypesFolder, "", "archetypes-folder", "Folders of the archetypes within the source, searched in order.")
+	addCommand.String(&cfg.VarFile, "", "var-file", "YAML file with the input values to use.")
+	addCommand.Bool(&cfg.StdinVars, "", "stdin-vars", "Read a JSON or YAML object with the input values from stdin.")
+	addCommand.String(&cfg.Subpath, "", "subpath", "Destination subpath to generate into.")
+	addCommand.String(&cfg.Module, "m", "module", "Destination module folder in a go.work workspace.")
+	addCommand.StringSlice(&cfg.Dests, "", "dest", "Destination folder to add the feature to, can be repeated.")
+	addCommand.String(&cfg.TargetsFile, "", "targets", "YAML file with the destination folders and their inputs.")
+	addCommand.String(&cfg.Sentinel, "", "sentinel", "File that must exist in the destination folder, by default the ecosystem one.")
+	addCommand.Bool(&cfg.NoGoMod, "", "no-gomod", "Don't require a sentinel file in the destination folder.")
+	addCommand.Bool(&cfg.Preview, "", "preview", "Review the files to be written and their diffs before confirming.")
+	addCommand.StringSlice(&cfg.Only, "", "only", "Generate only the files matching the glob, can be repeated.")
+	addCommand.StringSlice(&cfg.Exclude, "", "exclude", "Skip the files matching the glob, can be repeated.")
+	addCommand.Bool(&cfg.Provenance, "", "provenance", "Prepend a generated-by comment to the generated source files.")
+	addCommand.String(&cfg.LineEndings, "", "line-endings", "Line endings of the generated text files: lf, crlf or auto.")
+	addCommand.Bool(&cfg.StrictDeprecations, "", "strict-deprecations", "Fail instead of warning on a deprecated archetype or transformation.")
+	addCommand.Bool(&cfg.NoHooks, "", "no-hooks", "Skip the shell commands the transformation runs before and after generating.")
+	addCommand.Bool(&cfg.StrictVars, "", "strict-vars", "Fail on the template references to variables without a value, instead of rendering them empty.")
+	addCommand.Bool(&cfg.ForceLarge, "", "force-large", "Generate from an archetype over the file count and size limits.")
+	addCommand.Bool(&cfg.DebugTemplates, "", "debug-templates", "Print the variables of each rendered template, and where a failing one broke.")
+	addCommand.Bool(&cfg.Trace, "", "trace", "Print every operation of the generation on the files, in order, and why the skipped ones were.")
+	addCommand.Bool(&cfg.Open, "", "open", "Open the primary generated files, or the feature folder, in the editor.")
+	addCommand.String(&cfg.Output, "", "output", "Write the feature as a tar or zip archive instead of into the project.")
+	addCommand.String(&cfg.OutputFile, "", "output-file", "Archive file to write with --output, - for the standard output.")
+	addCommand.Bool(&cfg.PullRequest, "", "pr", "Commit the feature to a new branch, push it and open a pull request.")
+	addCommand.Bool(&cfg.CheckUpdates, "", "check-updates", "Tell whether the applied features have archetype updates, once a day.")
 
 	listCommand := flaggy.NewSubcommand("list")
 	listCommand.Description = "List available archetypes."
 	listCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	listCommand.String(&cfg.SourceRepo, "r", "source-repo", "Source repository to use.")
+	listCommand.String(&cfg.SourceRelease, "", "source-release", "GitHub release with the archetype packages to use, as org/repo@tag.")
+	listCommand.String(&cfg.SourceAuth, "", "source-auth", "Authentication of the source repository: github-app, gitlab-job-token or gitea-token.")
+	listCommand.String(&cfg.ArchetypesFolder, "", "archetypes-folder", "Folders of the archetypes within the source, searched in order.")
+	listCommand.Bool(&cfg.Remote, "", "remote", "List the catalog index of the source repository, without cloning it.")
+	listCommand.Bool(&cfg.AllSources, "", "all-sources", "List the sources of the project config too.")
+	listCommand.Duration(&cfg.MaxAge, "", "max-age", "Don't sync the sources listed within it, e.g. 1h.")
+	listCommand.Bool(&cfg.CheckUpdates, "", "check-updates", "Tell whether the applied features have archetype updates, once a day.")
+
+	indexCommand := flaggy.NewSubcommand("index")
+	indexCommand.Description = "Write the catalog index of an archetypes source."
+	indexCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to index.")
+
+	validateCommand := flaggy.NewSubcommand("validate")
+	validateCommand.Description = "Check an archetype without generating it."
+	validateCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	validateCommand.String(&cfg.Archetype, "a", "archetype", "Archetype to check.")
+	var vo garchetype.ValidateOptions
+	validateCommand.Bool(&vo.Build, "", "build", "Render the archetype into a temporary module and build it, followed by -- and the input arguments.")
+	validateCommand.String(&cfg.Transformation, "t", "transformation", "Transformation to build.")
+	validateCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to build.")
+	validateCommand.String(&cfg.VarFile, "", "var-file", "YAML file with the input values to use.")
+
+	inspectCommand := flaggy.NewSubcommand("inspect")
+	inspectCommand.Description = "List what an archetype would run or write that deserves a security review."
+	inspectCommand.AddPositionalValue(&cfg.Archetype, "archetype", 1, true, "Archetype to inspect.")
+	inspectCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	inspectCommand.String(&cfg.SourceRepo, "", "source-repo", "Source repository to clone into the source directory.")
+	var inspectJSON bool
+	inspectCommand.Bool(&inspectJSON, "", "json", "Print the findings as a JSON array.")
+
+	testCommand := flaggy.NewSubcommand("test")
+	testCommand.Description = "Render the golden cases of the archetypes and compare them with their expected output."
+	testCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	testCommand.String(&cfg.Archetype, "a", "archetype", "Archetype to test, all of them by default.")
+	var to garchetype.TestOptions
+	var junitFile string
+	testCommand.Bool(&to.Update, "", "update", "Rewrite the golden output with the rendered one.")
+	testCommand.String(&junitFile, "", "junit", "JUnit XML report file to write.")
+	testCommand.Bool(&cfg.NoHooks, "", "no-hooks", "Skip the shell commands the transformations run before and after generating.")
+
+	featuresCommand := flaggy.NewSubcommand("features")
+	featuresCommand.Description = "List the features applied to the project."
+	var featuresJSON bool
+	featuresCommand.Bool(&featuresJSON, "", "json", "Print the features as a JSON array.")
+
+	statsCommand := flaggy.NewSubcommand("stats")
+	statsCommand.Description = "Summarize the features applied to the project by archetype and version."
+	var statsJSON bool
+	statsCommand.Bool(&statsJSON, "", "json", "Print the stats as a JSON object.")
+
+	statusCommand := flaggy.NewSubcommand("status")
+	statusCommand.Description = "List the applied features with archetype updates in the source."
+	statusCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	statusCommand.String(&cfg.SourceRepo, "r", "source-repo", "Source repository to use.")
+	statusCommand.String(&cfg.SourceRelease, "", "source-release", "GitHub release with the archetype packages to use, as org/repo@tag.")
+	statusCommand.String(&cfg.SourceAuth, "", "source-auth", "Authentication of the source repository: github-app, gitlab-job-token or gitea-token.")
+	statusCommand.String(&cfg.ArchetypesFolder, "", "archetypes-folder", "Folders of the archetypes within the source, searched in order.")
+	var statusJSON bool
+	statusCommand.Bool(&statusJSON, "", "json", "Print the updates as a JSON array.")
+
+	renameCommand := flaggy.NewSubcommand("rename")
+	renameCommand.Description = "Rename an applied feature across its generated files."
+	var renameTo string
+	renameCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to rename.")
+	renameCommand.String(&renameTo, "", "to", "New feature name.")
+	renameCommand.String(&cfg.Module, "m", "module", "Module folder of the feature, if several have its name.")
+	renameCommand.Bool(&cfg.Force, "", "force", "Force renaming on a dirty repo.")
+
+	reapplyCommand := flaggy.NewSubcommand("reapply")
+	reapplyCommand.Description = "Apply another transformation of its archetype to an applied feature."
+	reapplyCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to apply the transformation to.")
+	reapplyCommand.String(&cfg.Transformation, "t", "transformation", "Transformation to apply.")
+	reapplyCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	reapplyCommand.String(&cfg.SourceRepo, "r", "source-repo", "Source repository to use.")
+	reapplyCommand.String(&cfg.SourceRelease, "", "source-release", "GitHub release with the archetype packages to use, as org/repo@tag.")
+	reapplyCommand.String(&cfg.SourceAuth, "", "source-auth", "Authentication of the source repository: github-app, gitlab-job-token or gitea-token.")
+	reapplyCommand.String(&cfg.ArchetypesFolder, "", "archetypes-folder", "Folders of the archetypes within the source, searched in order.")
+	reapplyCommand.String(&cfg.VarFile, "", "var-file", "YAML file with the input values overriding the recorded ones.")
+	reapplyCommand.String(&cfg.Module, "m", "module", "Module folder of the feature, if several have its name.")
+	reapplyCommand.Bool(&cfg.Force, "", "force", "Force applying on a dirty repo.")
+	reapplyCommand.Bool(&conflicts[0], "", "theirs", "Write the generated files over the existing ones they change.")
+	reapplyCommand.Bool(&conflicts[1], "", "ours", "Keep the existing files the generation would change.")
+	reapplyCommand.Bool(&conflicts[2], "", "manual", "Write conflict markers into the existing files the generation changes.")
+	reapplyCommand.Bool(&conflicts[3], "", "mergetool", "Resolve the existing files the generation changes with the git merge tool.")
+	reapplyCommand.Bool(&cfg.Preview, "", "preview", "Review the files to be written and their diffs before confirming.")
+	reapplyCommand.Bool(&cfg.NoHooks, "", "no-hooks", "Skip the shell commands the transformation runs before and after generating.")
+	reapplyCommand.Bool(&cfg.StrictVars, "", "strict-vars", "Fail on the template references to variables without a value, instead of rendering them empty.")
+	reapplyCommand.Bool(&cfg.ForceLarge, "", "force-large", "Generate from an archetype over the file count and size limits.")
+	reapplyCommand.Bool(&cfg.DebugTemplates, "", "debug-templates", "Print the variables of each rendered template, and where a failing one broke.")
+	reapplyCommand.Bool(&cfg.Trace, "", "trace", "Print every operation of the generation on the files, in order, and why the skipped ones were.")
+
+	publishCommand := flaggy.NewSubcommand("publish")
+	publishCommand.Description = "Package an archetype and upload it to the registry."
+	publishCommand.AddPositionalValue(&cfg.Archetype, "archetype", 1, true, "Archetype to publish.")
+	publishCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	publish := garchetype.PublishOptions{
+		Registry:      os.Getenv(envPrefix + "_REGISTRY"),
+		RegistryToken: os.Getenv(envPrefix + "_REGISTRY_TOKEN"),
+	}
+	publishCommand.String(&publish.Version, "", "version", "Package version, by default the archetype metadata one.")
+	publishCommand.String(&publish.OutDir, "o", "out", "Folder to write the package into.")
+	publishCommand.String(&publish.Registry, "", "registry", "Registry base URL to upload the package to.")
+
+	exportCommand := flaggy.NewSubcommand("export")
+	exportCommand.Description = "Create an archetype from an existing feature."
+	var exportFrom string
+	exportCommand.String(&exportFrom, "", "from", "Folder of the feature to export.")
+	exportCommand.String(&cfg.Archetype, "a", "archetype", "Name of the new archetype.")
+	exportCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to substitute, by default the folder name.")
+	exportCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to write the archetype into.")
+	exportCommand.Bool(&cfg.Force, "", "force", "Overwrite an existing archetype.")
+
+	diffCommand := flaggy.NewSubcommand("diff")
+	diffCommand.Description = "Show what changes between two archetype versions, followed by -- and the input arguments."
+	var diff garchetype.DiffOptions
+	diffCommand.String(&diff.From, "", "from", "Source revision to compare from, e.g. a tag.")
+	diffCommand.String(&diff.To, "", "to", "Source revision to compare to, HEAD by default.")
+	diffCommand.String(&cfg.Archetype, "a", "archetype", "Archetype to compare.")
+	diffCommand.String(&cfg.Transformation, "t", "transformation", "Transformation to use.")
+	diffCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to render.")
+	diffCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	diffCommand.String(&cfg.VarFile, "", "var-file", "YAML file with the input values to use.")
+
+	renderCommand := flaggy.NewSubcommand("render")
+	renderCommand.Description = "Render a single template to stdout."
+	var renderFile string
+	var renderInputs []string
+	renderCommand.AddPositionalValue(&renderFile, "template", 1, true, "Template to render, as <archetype>/<path>.")
+	renderCommand.StringSlice(&renderInputs, "i", "input", "Input value as key=value, can be repeated.")
+	renderCommand.String(&cfg.Transformation, "t", "transformation", "Transformation to use.")
+	renderCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to render.")
+	renderCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	renderCommand.String(&cfg.VarFile, "", "var-file", "YAML file with the input values to use.")
+	renderCommand.Bool(&cfg.StrictVars, "", "strict-vars", "Fail on the template references to variables without a value, instead of rendering them empty.")
+	renderCommand.Bool(&cfg.DebugTemplates, "", "debug-templates", "Print the variables of each rendered template, and where a failing one broke.")
+
+	watchCommand := flaggy.NewSubcommand("watch")
+	watchCommand.Description = "Render an archetype into a sandbox on every change, followed by -- and the input arguments."
+	var watchDest string
+	watchCommand.String(&watchDest, "d", "dest", "Sandbox folder to render the archetype into.")
+	watchCommand.String(&cfg.Archetype, "a", "archetype", "Archetype to watch.")
+	watchCommand.String(&cfg.Transformation, "t", "transformation", "Transformation to use.")
+	watchCommand.String(&cfg.FeatureName, "f", "feature", "Feature name to render.")
+	watchCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	watchCommand.String(&cfg.VarFile, "", "var-file", "YAML file with the input values to use.")
+	watchCommand.Bool(&cfg.StrictVars, "", "strict-vars", "Fail on the template references to variables without a value, instead of rendering them empty.")
+	watchCommand.Bool(&cfg.ForceLarge, "", "force-large", "Generate from an archetype over the file count and size limits.")
+	watchCommand.Bool(&cfg.NoHooks, "", "no-hooks", "Skip the shell commands the transformation runs before and after generating.")
+	watchCommand.Bool(&cfg.DebugTemplates, "", "debug-templates", "Print the variables of each rendered template, and where a failing one broke.")
+	watchCommand.Bool(&cfg.Trace, "", "trace", "Print every operation of the generation on the files, in order, and why the skipped ones were.")
+
+	serveCommand := flaggy.NewSubcommand("serve")
+	serveCommand.Description = "Serve the archetypes through an authenticated HTTP API."
+	serveAddr, serveToken, serveWorkspaces := defaultServeAddr, os.Getenv(envPrefix+"_SERVE_TOKEN"), ""
+	serveCommand.String(&serveAddr, "", "addr", "Address to listen on.")
+	serveCommand.String(&serveToken, "", "token", "Bearer token the requests must carry.")
+	serveCommand.String(&serveWorkspaces, "", "workspaces", "Folder the requests may generate into, none by default.")
+	serveCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	serveCommand.String(&cfg.SourceRepo, "r", "source-repo", "Source repository to use.")
+	serveCommand.String(&cfg.SourceRelease, "", "source-release", "GitHub release with the archetype packages to use, as org/repo@tag.")
+	serveCommand.String(&cfg.SourceAuth, "", "source-auth", "Authentication of the source repository: github-app, gitlab-job-token or gitea-token.")
+
+	mcpCommand := flaggy.NewSubcommand("mcp")
+	mcpCommand.Description = "Serve the archetypes to AI assistants with the Model Context Protocol over stdio."
+	mcpCommand.String(&cfg.SourceDir, "s", "source-dir", "Source directory to use.")
+	mcpCommand.String(&cfg.SourceRepo, "r", "source-repo", "Source repository to use.")
+	mcpCommand.String(&cfg.SourceRelease, "", "source-release", "GitHub release with the archetype packages to use, as org/repo@tag.")
+	mcpCommand.String(&cfg.SourceAuth, "", "source-auth", "Authentication of the source repository: github-app, gitlab-job-token or gitea-token.")
+	var mcpHooks bool
+	mcpCommand.Bool(&mcpHooks, "", "hooks", "Run the shell commands of the transformations, restricted by the project config, skipped by default.")
+
+	cacheCommand := flaggy.NewSubcommand("cache")
+	cacheCommand.Description = "Manage the source clones and downloads of the user cache."
+	pruneCommand := flaggy.NewSubcommand("prune")
+	pruneCommand.Description = "Remove the cached sources not used lately."
+	pruneUnused := defaultPruneUnused
+	var pruneDryRun bool
+	pruneCommand.Duration(&pruneUnused, "", "unused-for", "Remove the sources not used within it, e.g. 168h.")
+	pruneCommand.Bool(&pruneDryRun, "n", "dry-run", "Only list the sources that would be removed.")
+	cacheCommand.AttachSubcommand(pruneCommand, 1)
+
+	versionCommand := flaggy.NewSubcommand("version")
+	versionCommand.Description = "Show the version and build metadata."
+	var versionJSON bool
+	versionCommand.Bool(&versionJSON, "", "json", "Print the build metadata as a JSON object.")
+
+	selfUpdateCommand := flaggy.NewSubcommand("self-update")
+	selfUpdateCommand.Description = "Update garchetype to the latest release."
+	var updateCheck bool
+	selfUpdateCommand.Bool(&updateCheck, "", "check", "Only check whether there is a newer release.")
+
+	docsCommand := flaggy.NewSubcommand("docs")
+	docsCommand.Hidden = true
+	manCommand := flaggy.NewSubcommand("man")
+	manCommand.Description = "Generate the man pages."
+	docsDir, docsMarkdown := "man", false
+	manCommand.String(&docsDir, "d", "dir", "Folder to write the pages into.")
+	manCommand.Bool(&docsMarkdown, "", "markdown", "Write the markdown reference pages as well.")
+	docsCommand.AttachSubcommand(manCommand, 1)
+
+	examplesCommand := flaggy.NewSubcommand("examples")
+	examplesCommand.Description = "Print copy-pasteable command sequences, e.g. for the CI usage."
+	var examplesTopic string
+	examplesCommand.AddPositionalValue(&examplesTopic, "topic", 1, false, "Topic to print: setup, private-repos, ci or upgrade.")
+
+	completionCommand := flaggy.NewSubcommand("completion")
+	completionCommand.Description = "Print the shell completion script, completing the archetypes and transformations of the source too."
+	var completionShell string
+	completionCommand.AddPositionalValue(&completionShell, "shell", 1, true, "Shell of the script: bash, zsh or fish.")
 
 	environmentCommand := flaggy.NewSubcommand("environment")
 	environmentCommand.Hidden = true
+	var envJSON, envExport bool
+	environmentCommand.Bool(&envJSON, "", "json", "Print the variables as a JSON object.")
+	environmentCommand.Bool(&envExport, "", "export", "Print the variables as export commands for the shell to eval.")
 
 	flaggy.AttachSubcommand(addCommand, 1)
 	flaggy.AttachSubcommand(listCommand, 1)
+	flaggy.AttachSubcommand(indexCommand, 1)
+	flaggy.AttachSubcommand(validateCommand, 1)
+	flaggy.AttachSubcommand(inspectCommand, 1)
+	flaggy.AttachSubcommand(testCommand, 1)
+	flaggy.AttachSubcommand(featuresCommand, 1)
+	flaggy.AttachSubcommand(statsCommand, 1)
+	flaggy.AttachSubcommand(statusCommand, 1)
+	flaggy.AttachSubcommand(renameCommand, 1)
+	flaggy.AttachSubcommand(reapplyCommand, 1)
+	flaggy.AttachSubcommand(publishCommand, 1)
+	flaggy.AttachSubcommand(exportCommand, 1)
+	flaggy.AttachSubcommand(diffCommand, 1)
+	flaggy.AttachSubcommand(renderCommand, 1)
+	flaggy.AttachSubcommand(watchCommand, 1)
+	flaggy.AttachSubcommand(serveCommand, 1)
+	flaggy.AttachSubcommand(mcpCommand, 1)
+	flaggy.AttachSubcommand(cacheCommand, 1)
+	flaggy.AttachSubcommand(versionCommand, 1)
+	flaggy.AttachSubcommand(selfUpdateCommand, 1)
+	flaggy.AttachSubcommand(examplesCommand, 1)
+	flaggy.AttachSubcommand(completionCommand, 1)
 	flaggy.AttachSubcommand(environmentCommand, 1)
+	flaggy.AttachSubcommand(docsCommand, 1)
 
+	if len(args) > 1 && args[1] == completeCommand { // Its words aren't flags.
+		return complete(ctx, stdout, cfg, flaggy.DefaultParser, args[2:])
+	}
 	flaggy.ParseArgs(args[1:])
 
+	// The add prompts pick it otherwise, and test runs all the archetypes. The
+	// transformation defaults to the one of the archetype.
+	if !testCommand.Used && (!addCommand.Used || !cfg.prompts()) {
+		cfg.Archetype = cmp.Or(cfg.Archetype, defaultArchetype)
+	}
+
+	if err := setLang(cfg.Lang); err != nil {
+		return err
+	}
+	for i, set := range conflicts {
+		switch {
+		case !set:
+		case slices.Contains(conflicts[i+1:], true):
+			return garchetype.WithHint(errors.New("only one of --theirs, --ours, --manual and --mergetool can be given"), "conflicts",
+				"Pick the strategy resolving the conflicts")
+		default:
+			cfg.Conflicts = conflictFlags[i]
+		}
+	}
+	if cfg.PullRequest && cfg.NoGit {
+		return garchetype.WithHint(errors.New("--pr can't be used along with --no-git"), "pull-requests",
+			"A pull request needs the project under git, run it without --no-git")
+	}
+	if err := cfg.checkOutput(stdout); err != nil {
+		return err
+	}
+	if cfg.cacheMaxSize, err = garchetype.ParseSize(cfg.CacheMaxSize); err != nil {
+		return err
+	}
+	if cfg.Verbose {
+		cfg.LogLevel = "debug"
+	}
+	logger, err := newLogger(stderr, cfg.LogFormat, cfg.LogLevel, cfg.Plain)
+	if err != nil {
+		return err
+	}
+	structured := cfg.LogFormat == logFormatJSON
+	if t, err = loadTheme(cfg.Theme); err != nil {
+		return err
+	}
+	diag = newPrinter(stderr, cfg.Plain, t, logger, structured)
+	cfg.diag = diag
+	pageable := listCommand.Used || inspectCommand.Used || featuresCommand.Used || statsCommand.Used || statusCommand.Used ||
+		diffCommand.Used || examplesCommand.Used || (pruneCommand.Used && pruneDryRun)
+	if pageable && !cfg.NoPager && isTerminal(stdout) {
+		var buf bytes.Buffer
+		tty := stdout
+		stdout = &buf
+		defer func() { err = multierr.Append(err, page(tty, buf.Bytes())) }()
+	}
+	out := newPrinter(stdout, cfg.Plain, t, logger, structured)
+	status := out // Status lines and progress, silenced by --quiet.
+	if cfg.Output != "" && cfg.OutputFile == stdoutFile {
+		status = diag // The standard output is the archive.
+	}
+	if cfg.Quiet {
+		status = newPrinter(io.Discard, cfg.Plain, t, logger, structured)
+	}
+
 	switch {
 	case addCommand.Used:
-		if _, err := os.Stat("go.mod"); os.IsNotExist(err) {
-			return errors.New("go.mod file not found in the current folder")
+		return addFeature(ctx, stdout, status, cfg, flaggy.TrailingArguments...)
+	case listCommand.Used:
+		return list(ctx, out, status, cfg)
+	case indexCommand.Used:
+		return index(ctx, status, cfg)
+	case validateCommand.Used:
+		return validate(ctx, status, cfg, vo, flaggy.TrailingArguments)
+	case inspectCommand.Used:
+		return inspect(ctx, stdout, out, status, cfg, inspectJSON)
+	case testCommand.Used:
+		return testArchetypes(ctx, out, status, cfg, to, junitFile)
+	case featuresCommand.Used:
+		return features(stdout, out, status, featuresJSON)
+	case statsCommand.Used:
+		return stats(stdout, out, status, statsJSON)
+	case statusCommand.Used:
+		return updates(ctx, stdout, out, status, cfg, statusJSON)
+	case renameCommand.Used:
+		return rename(ctx, status, cfg, renameTo)
+	case reapplyCommand.Used:
+		return reapply(ctx, stdout, status, cfg, flaggy.TrailingArguments...)
+	case publishCommand.Used:
+		return publishArchetype(ctx, status, cfg, publish)
+	case exportCommand.Used:
+		return export(ctx, status, cfg, exportFrom)
+	case diffCommand.Used:
+		return diffVersions(ctx, out, status, cfg, diff, flaggy.TrailingArguments)
+	case watchCommand.Used:
+		return watch(ctx, status, diag, cfg, watchDest, flaggy.TrailingArguments)
+	case serveCommand.Used:
+		return serve(ctx, status, diag, cfg, serveAddr, serveToken, serveWorkspaces)
+	case mcpCommand.Used:
+		return mcp(ctx, os.Stdin, stdout, diag, cfg, mcpHooks)
+	case renderCommand.Used:
+		return renderTemplate(ctx, stdout, status, cfg, renderFile, renderInputs)
+	case pruneCommand.Used:
+		return pruneCache(ctx, status, pruneUnused, pruneDryRun)
+	case versionCommand.Used:
+		bi := getBuildInfo()
+		if versionJSON {
+			return bi.printJSON(stdout)
 		}
-		if err := setSource(stdout, cfg); err != nil {
-			return err
+		bi.print(stdout)
+		return nil
+	case selfUpdateCommand.Used:
+		return selfUpdate(ctx, status, updateCheck)
+	case manCommand.Used:
+		return writeDocs(flaggy.DefaultParser, docsDir, docsMarkdown)
+	case examplesCommand.Used:
+		return printExamples(stdout, examplesTopic)
+	case completionCommand.Used:
+		return printCompletion(stdout, completionShell)
+	case environmentCommand.Used:
+		switch {
+		case envJSON:
+			return layers.printJSON(stdout)
+		case envExport:
+			return layers.printExport(stdout)
 		}
-		if cfg.Archetype == "" {
-			err = multierr.Append(err, errors.New("archetype is required"))
+		return layers.print(stdout)
+	default:
+		flaggy.ShowHelp("")
+		return nil
+	}
+}
+
+// options returns the library options of the cfg config, reporting the
+// progress with p.
+func (cfg *Config) options(p *printer, args []string) garchetype.Options {
+	o := garchetype.Options{
+		SourceDir:          cfg.SourceDir,
+		SourceRepo:         cfg.SourceRepo,
+		SourceRelease:      cfg.SourceRelease,
+		SourceAuth:         garchetype.SourceAuth{Type: cfg.SourceAuth},
+		PluginsDir:         cfg.PluginsDir,
+		CacheMaxSize:       cfg.cacheMaxSize,
+		ArchetypesFolder:   cfg.ArchetypesFolder,
+		Archetype:          cfg.Archetype,
+		Transformation:     cfg.Transformation,
+		FeatureName:        cfg.FeatureName,
+		Module:             cfg.Module,
+		VarFile:            cfg.VarFile,
+		Args:               args,
+		Subpath:            cfg.Subpath,
+		Sentinel:           cfg.Sentinel,
+		NoSentinel:         cfg.NoGoMod,
+		Force:              cfg.Force,
+		NoGit:              cfg.NoGit,
+		Conflicts:          cfg.Conflicts,
+		AllSources:         cfg.AllSources,
+		MaxAge:             cfg.MaxAge,
+		LockTimeout:        cfg.LockTimeout,
+		Only:               cfg.Only,
+		Exclude:            cfg.Exclude,
+		Provenance:         cfg.Provenance,
+		LineEndings:        cfg.LineEndings,
+		StrictDeprecations: cfg.StrictDeprecations,
+		StrictVars:         cfg.StrictVars,
+		ForceLarge:         cfg.ForceLarge,
+		NoHooks:            cfg.NoHooks,
+		ToolVersion:        Version,
+		Logger:             p.log,
+		Hooks: garchetype.Hooks{
+			Started: func(r *garchetype.Report) {
+				p.printf(iconAdd, "Adding '%s' feature using '%s' archetype.", r.Feature, r.Archetype)
+				if r.Version != "" {
+					p.printf(iconSource, "Using version %s of the archetype, tagged %s.", r.Version, r.Tag)
+				}
+				p.printf(iconArchetype, "Using transformation file: %s", r.TransformationFile)
+			},
+			Busy:        p.spinner,
+			Progress:    p.counter("Writing files"),
+			GitProgress: p.gitProgress(),
+			Warn:        func(msg string) { p.warnf("%s", msg) },
+		},
+	}
+	if cfg.DebugTemplates {
+		o.Hooks.Template = debugTemplate(cfg.diag)
+	}
+	if cfg.Trace {
+		o.Hooks.Trace = traceOperation(cfg.diag)
+	}
+	if cfg.prompts() {
+		o.Hooks.FeatureName = func(err error, validate func(string) error) (string, error) {
+			p.warnf("%s", err)
+			return promptFeatureName(validate)
 		}
-		if cfg.FeatureName == "" {
-			cfg.FeatureName = cfg.Archetype
+		o.Hooks.Archetype = promptArchetype
+		o.Hooks.Transformation = promptTransformation
+		o.Hooks.Prerequisite = promptPrerequisite
+		o.Hooks.Input = promptInput
+		if cfg.Force && cfg.Conflicts == "" {
+			o.Hooks.Conflict = promptConflict
 		}
-		if cfg.SourceDir == "" {
-			err = multierr.Append(err, errors.New("source directory is required"))
+	}
+	return o
+}
+
+// debugTemplate returns the Template hook printing the variables of each
+// rendered template with p, along with its failure, for --debug-templates.
+func debugTemplate(p *printer) func(t garchetype.RenderedTemplate) {
+	return func(t garchetype.RenderedTemplate) {
+		p.printf(iconDebug, "Variables of the %s template:", t.File)
+		for _, k := range slices.Sorted(maps.Keys(t.Vars)) {
+			p.itemf("", "%s = %q", k, t.Vars[k])
 		}
-		if err != nil {
-			return err
+		if t.Err != nil {
+			p.itemf(iconError, "%s", t.Err)
+			if t.Err.Source != "" {
+				p.itemf("", "%s", t.Err.Source)
+			}
 		}
-		return addFeature(stdout, cfg, flaggy.TrailingArguments...)
-	case listCommand.Used:
-		if err := setSource(stdout, cfg); err != nil {
+	}
+}
+
+// traceOperation returns the Trace hook printing the operations of the
+// generation with p, for --trace.
+func traceOperation(p *printer) func(e garchetype.TraceEvent) {
+	return func(e garchetype.TraceEvent) {
+		line := e.Op + " " + e.Path
+		if e.Detail != "" {
+			line += " (" + e.Detail + ")"
+		}
+		p.printf(iconDebug, "%s", line)
+	}
+}
+
+// conflictFlags are the strategies of the --theirs, --ours, --manual and
+// --mergetool flags.
+var conflictFlags = [4]string{garchetype.ConflictsTheirs, garchetype.ConflictsOurs, garchetype.ConflictsManual, garchetype.ConflictsMergeTool}
+
+// prompts reports whether the user may be prompted, i.e. in a terminal and
+// without --yes.
+func (cfg *Config) prompts() bool {
+	return !cfg.Yes && isInteractive()
+}
+
+func addFeature(ctx context.Context, stdout io.Writer, p *printer, cfg *Config, args ...string) error {
+	o := cfg.options(p, args)
+	if cfg.StdinVars {
+		var err error
+		if o.Inputs, err = garchetype.ReadVars(os.Stdin); err != nil {
 			return err
 		}
-		if cfg.SourceDir == "" {
-			err = multierr.Append(err, errors.New("source directory is required"))
+		o.NoPrompt = true // The prompts would read the rest of the consumed stdin.
+	}
+	if cfg.Preview && !cfg.Yes { // Confirmed already.
+		if !isInteractive() {
+			return garchetype.WithHint(errors.New("preview needs an interactive terminal"), "conflicts",
+				"Run it without --preview")
 		}
-		if err != nil {
+		o.Hooks.Confirm = previewPlan(p, stdout, cfg.NoPager)
+	}
+	if len(cfg.Dests) > 0 || cfg.TargetsFile != "" {
+		return addTargets(ctx, p, cfg, o)
+	}
+	if cfg.Output != "" {
+		return addArchive(ctx, stdout, p, cfg, o)
+	}
+	r, err := garchetype.Add(ctx, o)
+	if errors.Is(err, garchetype.ErrAborted) {
+		p.printf(iconDone, "Nothing added.")
+		return nil
+	}
+	sendTelemetry(ctx, p.log, cfg, "add", r, err)
+	if err != nil {
+		return err
+	}
+	p.printf(iconDone, "Feature '%s' added.", r.Feature)
+	printSummary(p, r.Summary)
+	notifyUpdates(p, cfg)
+	if cfg.Open {
+		if err := openFiles(ctx, p, []*garchetype.Report{r}); err != nil {
 			return err
 		}
-		return list(stdout, cfg)
-	case environmentCommand.Used:
-		for _, e := range environment {
-			fmt.Fprintf(stdout, "%s\n", e)
-		}
+	}
+	if cfg.PullRequest {
+		return openPullRequest(ctx, p, cfg, o, []*garchetype.Report{r})
+	}
+	return nil
+}
+
+// checkOutput returns an error if the --output archive can't be written: an
+// unknown format, a flag needing the project, or a terminal standard output.
+func (cfg *Config) checkOutput(stdout io.Writer) error {
+	switch {
+	case cfg.Output == "":
 		return nil
-	default:
-		flaggy.ShowHelp("")
+	case cfg.Output != archiveTar && cfg.Output != archiveZip:
+		return garchetype.WithHint(fmt.Errorf("unknown archive format %q", cfg.Output), "editor-and-archives", "Use tar or zip")
+	case cfg.PullRequest || cfg.Open || len(cfg.Dests) > 0 || cfg.TargetsFile != "":
+		return garchetype.WithHint(errors.New("--output can't be used along with --pr, --open, --dest or --targets"), "editor-and-archives",
+			"The archive leaves the project untouched, add the feature into the project to use them")
+	case cfg.OutputFile != stdoutFile:
 		return nil
+	case cfg.Preview:
+		return garchetype.WithHint(errors.New("--preview can't be used writing the archive to the standard output"), "editor-and-archives",
+			"Pass --output-file to write the archive to a file")
+	case isTerminal(stdout):
+		return garchetype.WithHint(errors.New("won't write the archive to a terminal"), "editor-and-archives",
+			"Redirect the standard output to a file, or pass --output-file")
 	}
+	return nil
 }
 
-func setSource(stdout io.Writer, cfg *Config) error {
-	if cfg.SourceDir == "" {
-		return errors.New("source directory is required")
+// addArchive adds the feature into a temporary folder instead of the project,
+// and writes it as the --output archive.
+func addArchive(ctx context.Context, stdout io.Writer, p *printer, cfg *Config, o garchetype.Options) error {
+	dir, err := os.MkdirTemp("", exeName+"-output-")
+	if err != nil {
+		return err
 	}
-	g, err := git.Open(cfg.SourceDir)
-	switch err != nil {
-	case true:
-		if !errors.Is(err, os.ErrNotExist) {
+	defer os.RemoveAll(dir)
+	o.OutputDir = dir
+	r, err := garchetype.Add(ctx, o)
+	if errors.Is(err, garchetype.ErrAborted) {
+		p.printf(iconDone, "Nothing added.")
+		return nil
+	}
+	sendTelemetry(ctx, p.log, cfg, "add", r, err)
+	if err != nil {
+		return err
+	}
+	if cfg.OutputFile == stdoutFile {
+		if err := writeArchive(stdout, cfg.Output, r.Destination, r.Files); err != nil {
 			return err
 		}
-		switch cfg.SourceRepo == "" {
-		case true:
-			return fmt.Errorf("source directory not found: %s", cfg.SourceDir)
-		default:
-			if err := git.Clone(
-				cfg.SourceRepo, cfg.SourceDir,
-				git.CloneOptions{Depth: 1, Branch: "main"}, // Speed up the clone.
-			); err != nil {
-				switch strings.Contains(err.Error(), "ssh: Could not resolve hostname") {
-				case true:
-					fmt.Fprintln(stdout, "🚨 Could not connect to remote repository.")
-					return fmt.Errorf("source directory not found: %s", cfg.SourceDir)
-				default:
-					return err
-				}
-			}
+		p.printf(iconDone, "Feature '%s' written to the standard output as a %s archive.", r.Feature, cfg.Output)
+	} else {
+		f, err := os.Create(cfg.OutputFile)
+		if err != nil {
+			return err
 		}
-	default:
-		if _, err := g.RemoteGetURL("origin"); err == nil {
-			if err := g.Fetch(); err != nil {
-				switch strings.Contains(err.Error(), "ssh: Could not resolve hostname") {
-				case true:
-					fmt.Fprintln(stdout, "🚨 Could not connect to remote repository.")
-					return nil
-				default:
-					return err
-				}
-			}
-			if err := g.Pull(); err != nil {
-				return err
-			}
-		} else {
-			e := err.Error()
-			if !strings.Contains(e, "not a git repository") &&
-				!strings.Contains(e, "No such remote") {
-				return err
-			}
+		if err := multierr.Append(writeArchive(f, cfg.Output, r.Destination, r.Files), f.Close()); err != nil {
+			return err
 		}
+		p.printf(iconDone, "Feature '%s' written to the %s archive.", r.Feature, cfg.OutputFile)
 	}
+	printSummary(p, r.Summary)
 	return nil
 }
 
-func addFeature(stdout io.Writer, cfg *Config, args ...string) error {
-	dest := "."
-	dest, err := filepath.Abs(dest)
+// openPullRequest opens the pull request of the features of the rs reports.
+func openPullRequest(ctx context.Context, p *printer, cfg *Config, o garchetype.Options, rs []*garchetype.Report) error {
+	pr, err := garchetype.OpenPullRequest(ctx, o, garchetype.PullRequestOptions{Token: cfg.PRToken}, rs)
 	if err != nil {
 		return err
 	}
-	asd, err := getArchetypesFolder(cfg.SourceDir, cfg.ArchetypesFolder)
-	if err != nil {
-		return err
+	p.printf(iconDone, "Pull request of the '%s' branch opened: %s", pr.Branch, pr.URL)
+	return nil
+}
+
+// printSummary prints the counts of the changes of a generation.
+func printSummary(p *printer, s garchetype.Summary) {
+	p.itemf(iconTransformation, "%d files created, %d modified, %d unchanged, %d skipped, %d lines added, %d removed.",
+		s.Created, s.Modified, s.Unchanged, s.Skipped, s.LinesAdded, s.LinesRemoved)
+}
+
+// addTargets adds the feature to the --dest folders and the targets of the
+// --targets file.
+func addTargets(ctx context.Context, p *printer, cfg *Config, o garchetype.Options) error {
+	if cfg.Module != "" {
+		return garchetype.WithHint(errors.New("--module can't be used along with the targets"), "modules-and-targets",
+			"Pass the module folder with --dest instead")
 	}
-	ad, err := getArchetypeFolder(asd, cfg.Archetype)
-	if err != nil {
-		return err
+	targets := make([]garchetype.Target, 0, len(cfg.Dests))
+	for _, d := range cfg.Dests {
+		targets = append(targets, garchetype.Target{Dir: d})
 	}
-	tf, err := getTransformationFile(cfg.Transformation)
-	if err != nil {
-		return err
+	if cfg.TargetsFile != "" {
+		ts, err := garchetype.ReadTargets(cfg.TargetsFile)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, ts...)
 	}
-	fmt.Fprintf(stdout, "🌱 Adding '%s' feature using '%s' archetype.\n", cfg.FeatureName, cfg.Archetype)
-	tf = filepath.Join(ad, tf)
-	fi, err := os.Stat(tf)
-	if err != nil {
+	rs, err := garchetype.AddTargets(ctx, o, targets)
+	for _, r := range rs {
+		sendTelemetry(ctx, p.log, cfg, "add", r, nil)
+		p.printf(iconDone, "Feature '%s' added to %s.", r.Feature, r.Destination)
+		printSummary(p, r.Summary)
+	}
+	if errors.Is(err, garchetype.ErrAborted) {
+		p.printf(iconDone, "Nothing added to the remaining targets.")
+		return nil
+	}
+	if err == nil && cfg.Open {
+		err = openFiles(ctx, p, rs)
+	}
+	if err != nil || !cfg.PullRequest {
 		return err
 	}
-	if fi.IsDir() {
-		return fmt.Errorf("invalid transformation file: %s", tf)
+	return openPullRequest(ctx, p, cfg, o, rs)
+}
+
+func list(ctx context.Context, p, status *printer, cfg *Config) error {
+	listFn := garchetype.List
+	if cfg.Remote {
+		listFn = garchetype.ListRemote
 	}
-	fmt.Fprintf(stdout, "📦 Using transformation file: %s\n", tf)
-	gs, err := gitstat.Get()
+	as, err := listFn(ctx, cfg.options(status, nil))
 	if err != nil {
 		return err
 	}
-	if gs.Dirty && !cfg.Force {
-		return errors.New("git repository is dirty")
+	searchPath := len(filepath.SplitList(cfg.ArchetypesFolder)) > 1
+	var source string
+	for _, a := range as {
+		if cfg.AllSources && a.Source != source {
+			source = a.Source
+			p.printf(iconSource, "Source: %s", source)
+		}
+		var folder string
+		if searchPath {
+			folder = " [" + a.Folder + "]"
+		}
+		p.printf(iconArchetype, "Archetype: %s%s%s%s", a.Name, folder, deprecated(a.Deprecated), described(a.Description))
+		if len(a.Transformations) == 1 && a.Transformations[0].Default && a.Transformations[0].Deprecated == "" {
+			continue
+		}
+		for _, t := range a.Transformations {
+			p.itemf(iconTransformation, "Transformation: %s%s%s%s", t.Name, aliased(t.Aliases), deprecated(t.Deprecated), described(t.Description))
+		}
 	}
-	b, err := os.ReadFile(tf)
+	notifyUpdates(status, cfg)
+	return nil
+}
+
+// notifyUpdates tells how many applied features have archetype updates in the
+// source, at most once a day, if asked to. The check never fails the command.
+func notifyUpdates(p *printer, cfg *Config) {
+	if !cfg.CheckUpdates {
+		return
+	}
+	us, err := garchetype.CheckUpdates(cfg.options(p, nil))
+	switch {
+	case err != nil:
+		p.log.Debugf("Could not check the archetype updates: %s", err)
+	case len(us) == 1:
+		p.printf(iconHint, "1 feature has archetype updates available, run '%s status'.", exeName)
+	case len(us) > 1:
+		p.printf(iconHint, "%d features have archetype updates available, run '%s status'.", len(us), exeName)
+	}
+}
+
+func index(ctx context.Context, p *printer, cfg *Config) error {
+	f, err := garchetype.Index(ctx, cfg.options(p, nil))
 	if err != nil {
 		return err
 	}
-	if err := generator.OverlayGenerate(tf, ad, dest, getFeatureArgs(b, cfg, args), log.NewZeroLogger("warn")); err != nil {
+	p.printf(iconDone, "Catalog index written: %s", f)
+	return nil
+}
+
+func validate(ctx context.Context, p *printer, cfg *Config, vo garchetype.ValidateOptions, args []string) error {
+	if err := garchetype.Validate(ctx, cfg.options(p, args), vo); err != nil {
 		return err
 	}
-	fmt.Fprintf(stdout, "🎉 Feature '%s' added.\n", cfg.FeatureName)
+	p.printf(iconDone, "Archetype '%s' is valid.", cfg.Archetype)
 	return nil
 }
 
-func list(stdout io.Writer, cfg *Config) error {
-	ad, err := getArchetypesFolder(cfg.SourceDir, cfg.ArchetypesFolder)
+func inspect(ctx context.Context, w io.Writer, p, status *printer, cfg *Config, asJSON bool) error {
+	fs, err := garchetype.Inspect(ctx, cfg.options(status, nil))
 	if err != nil {
 		return err
 	}
-	as, err := getArchetypes(ad)
+	if asJSON {
+		if fs == nil {
+			fs = []garchetype.Finding{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fs)
+	}
+	if len(fs) == 0 {
+		status.printf(iconDone, "Nothing to review in archetype '%s'.", cfg.Archetype)
+		return nil
+	}
+	for _, f := range fs {
+		at := f.File
+		if f.Line > 0 {
+			at += fmt.Sprintf(":%d", f.Line)
+		}
+		p.printf(iconWarning, "%s: %s (%s)", f.Kind, f.Detail, at)
+	}
+	status.printf(iconArchetype, "%d findings to review in archetype '%s'.", len(fs), cfg.Archetype)
+	return nil
+}
+
+func testArchetypes(ctx context.Context, p, status *printer, cfg *Config, to garchetype.TestOptions, junitFile string) error {
+	tcs, err := garchetype.Test(ctx, cfg.options(status, nil), to)
 	if err != nil {
 		return err
 	}
-	for _, a := range as {
-		ts, err := getTransformations(filepath.Join(ad, a))
-		if err != nil {
+	if junitFile != "" {
+		if err := writeJUnit(junitFile, tcs); err != nil {
 			return err
 		}
-		if len(ts) == 0 {
-			continue
-		}
-		fmt.Fprintf(stdout, "📦 Archetype: %s\n", a)
-		if len(ts) == 1 && ts[0] == defaultTransformation {
-			continue
+	}
+	var failed int
+	for _, tc := range tcs {
+		switch {
+		case tc.Err != nil:
+			fmt.Fprintf(p.w, "--- ERROR: %s/%s\n%s\n", tc.Archetype, tc.Name, tc.Err)
+		case len(tc.Diffs) > 0:
+			fmt.Fprintf(p.w, "--- FAIL: %s/%s\n", tc.Archetype, tc.Name)
+			for _, d := range tc.Diffs {
+				fmt.Fprint(p.w, d.Patch)
+			}
+		case to.Update:
+			status.itemf(iconArchetype, "Updated: %s/%s", tc.Archetype, tc.Name)
+		default:
+			status.itemf(iconDone, "Passed: %s/%s", tc.Archetype, tc.Name)
 		}
-		for _, t := range ts {
-			fmt.Fprintf(stdout, " 📄 Transformation: %s\n", t)
+		if tc.Failed() {
+			failed++
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d golden cases failed", failed, len(tcs))
+	}
+	if to.Update {
+		status.printf(iconDone, "%d golden cases updated.", len(tcs))
+		return nil
+	}
+	status.printf(iconDone, "%d golden cases passed.", len(tcs))
 	return nil
 }
 
-func getArchetypesFolder(dir, archetypes string) (string, error) {
-	if dir == "" {
-		return "", errors.New("undefined dir")
+func features(w io.Writer, p, status *printer, asJSON bool) error {
+	fs, err := garchetype.Features(".")
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if fs == nil {
+			fs = []garchetype.Feature{} // An empty array for the dashboards.
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fs)
 	}
-	if archetypes == "" {
-		return "", errors.New("undefined archetypes")
+	if len(fs) == 0 {
+		status.printf(iconDone, "No features applied to the project.")
+		return nil
 	}
-	ad := filepath.Join(dir, archetypes)
-	fi, err := os.Stat(ad)
+	for _, f := range fs {
+		archetype := f.Archetype
+		if f.Version != "" {
+			archetype += " " + f.Version
+		}
+		into := ""
+		if f.Destination != "" {
+			into = " into " + f.Destination
+		}
+		p.printf(iconAdd, "Feature: %s - %s archetype, applied %s%s", f.Name, archetype, f.Applied.Format(time.DateOnly), into)
+	}
+	return nil
+}
+
+func stats(w io.Writer, p, status *printer, asJSON bool) error {
+	s, err := garchetype.ProjectStats(".")
 	if err != nil {
-		return "", err
+		return err
 	}
-	if !fi.IsDir() {
-		return "", fmt.Errorf("invalid archetypes folder: %s", ad)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
 	}
-	return ad, nil
+	if s.Features == 0 {
+		status.printf(iconDone, "No features applied to the project.")
+		return nil
+	}
+	for _, a := range s.Archetypes {
+		var versions []string
+		for _, v := range slices.Sorted(maps.Keys(a.Versions)) {
+			versions = append(versions, fmt.Sprintf("%s (%d)", v, a.Versions[v]))
+		}
+		if len(versions) == 0 {
+			p.printf(iconArchetype, "Archetype: %s - %d features", a.Archetype, a.Features)
+			continue
+		}
+		p.printf(iconArchetype, "Archetype: %s - %d features, versions %s", a.Archetype, a.Features, strings.Join(versions, ", "))
+	}
+	o := s.Oldest
+	archetype := o.Archetype
+	if o.Version != "" {
+		archetype += " " + o.Version
+	}
+	p.printf(iconAdd, "Oldest feature: %s - %s archetype, applied %s", o.Name, archetype, o.Applied.Format(time.DateOnly))
+	p.printf(iconDone, "%d features, %d generated files.", s.Features, s.Files)
+	return nil
 }
 
-func getArchetypeFolder(dir, archetype string) (string, error) {
-	if dir == "" {
-		return "", errors.New("undefined dir")
+func updates(ctx context.Context, w io.Writer, p, status *printer, cfg *Config, asJSON bool) error {
+	us, err := garchetype.Updates(ctx, cfg.options(status, nil))
+	if err != nil {
+		return err
 	}
-	if archetype == "" {
-		return "", errors.New("undefined archetype")
+	if asJSON {
+		if us == nil {
+			us = []garchetype.Update{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(us)
+	}
+	if len(us) == 0 {
+		status.printf(iconDone, "The archetypes of the applied features are up to date.")
+		return nil
+	}
+	for _, u := range us {
+		into := ""
+		if u.Destination != "" {
+			into = " into " + u.Destination
+		}
+		p.printf(iconAdd, "Feature: %s%s - %s archetype %s, %s available", u.Feature, into, u.Archetype, u.Version, u.Latest)
 	}
-	ad := filepath.Join(dir, archetype)
-	fi, err := os.Stat(ad)
+	return nil
+}
+
+// defaultPruneUnused is the default window of cache prune.
+const defaultPruneUnused = 30 * 24 * time.Hour
+
+func pruneCache(ctx context.Context, p *printer, unused time.Duration, dryRun bool) error {
+	es, err := garchetype.PruneCache(ctx, unused, dryRun)
 	if err != nil {
-		return "", err
+		return err
 	}
-	if !fi.IsDir() {
-		return "", fmt.Errorf("invalid archetype folder: %s", ad)
+	var size int64
+	for _, e := range es {
+		size += e.Size
+		p.itemf(iconTransformation, "%s (%s, last used %s)", e.Path, garchetype.FormatSize(e.Size), e.Used.Format(time.DateOnly))
 	}
-	return ad, nil
+	if dryRun {
+		p.printf(iconDone, "%d cache entries would be removed, reclaiming %s.", len(es), garchetype.FormatSize(size))
+		return nil
+	}
+	p.printf(iconDone, "%d cache entries removed, %s reclaimed.", len(es), garchetype.FormatSize(size))
+	return nil
 }
 
-func getTransformationFile(transformation string) (string, error) {
-	if transformation == "" {
-		return "", errors.New("undefined transformation")
+func rename(ctx context.Context, p *printer, cfg *Config, to string) error {
+	r, err := garchetype.Rename(ctx, cfg.options(p, nil), to)
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("%s%s.%s", transformationPrefix, transformation, transformationExt), nil
+	p.printf(iconTransformation, "%d files changed.", len(r.Files))
+	p.printf(iconDone, "Feature '%s' renamed to '%s'.", cfg.FeatureName, r.Feature)
+	return nil
 }
 
-func getArchetypes(dir string) ([]string, error) {
-	if dir == "" {
-		return nil, errors.New("undefined dir")
+// reapply applies the --transformation to the applied --feature.
+func reapply(ctx context.Context, stdout io.Writer, p *printer, cfg *Config, args ...string) error {
+	o := cfg.options(p, args)
+	o.Hooks.Started = func(r *garchetype.Report) {
+		p.printf(iconAdd, "Applying '%s' transformation to '%s' feature.", r.Transformation, r.Feature)
+		p.printf(iconArchetype, "Using transformation file: %s", r.TransformationFile)
+	}
+	if cfg.Preview && !cfg.Yes {
+		if !isInteractive() {
+			return garchetype.WithHint(errors.New("preview needs an interactive terminal"), "conflicts",
+				"Run it without --preview")
+		}
+		o.Hooks.Confirm = previewPlan(p, stdout, cfg.NoPager)
+	}
+	r, err := garchetype.Reapply(ctx, o)
+	if errors.Is(err, garchetype.ErrAborted) {
+		p.printf(iconDone, "Nothing applied.")
+		return nil
 	}
-	var as []string
-	f, err := os.Open(dir)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
-	entries, err := f.Readdirnames(-1)
+	p.printf(iconDone, "Transformation '%s' applied to '%s' feature.", r.Transformation, r.Feature)
+	printSummary(p, r.Summary)
+	return nil
+}
+
+func publishArchetype(ctx context.Context, p *printer, cfg *Config, po garchetype.PublishOptions) error {
+	pkg, err := garchetype.Publish(ctx, cfg.options(p, nil), po)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for _, f := range entries {
-		fi, err := os.Stat(filepath.Join(dir, f))
-		if err != nil {
-			return nil, err
-		}
-		if fi.IsDir() {
-			as = append(as, f)
-		}
+	p.printf(iconArchetype, "Package written: %s", pkg.File)
+	if pkg.URL != "" {
+		p.printf(iconDone, "Archetype '%s' %s published to %s", pkg.Archetype, pkg.Version, pkg.URL)
 	}
-	return as, nil
+	return nil
 }
 
-func getTransformations(dir string) ([]string, error) {
-	if dir == "" {
-		return nil, errors.New("undefined dir")
-	}
-	var ts []string
-	f, err := os.Open(dir)
+func export(ctx context.Context, p *printer, cfg *Config, from string) error {
+	r, err := garchetype.Export(ctx, cfg.options(p, nil), from)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
-	entries, err := f.Readdirnames(-1)
+	p.printf(iconArchetype, "Archetype written: %s (%d files)", r.Destination, len(r.Files))
+	p.printf(iconDone, "Feature '%s' exported as the '%s' archetype.", r.Feature, r.Archetype)
+	return nil
+}
+
+func diffVersions(ctx context.Context, p, status *printer, cfg *Config, do garchetype.DiffOptions, args []string) error {
+	diffs, err := garchetype.Diff(ctx, cfg.options(status, args), do)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for _, f := range entries {
-		if strings.HasPrefix(f, transformationPrefix) && strings.HasSuffix(f, transformationExt) {
-			t := strings.TrimSuffix(strings.TrimPrefix(f, transformationPrefix), "."+transformationExt)
-			ts = append(ts, t)
-		}
+	for _, d := range diffs {
+		fmt.Fprint(p.w, d.Patch)
+	}
+	if len(diffs) == 0 {
+		status.printf(iconDone, "No changes between %s and %s.", do.From, cmp.Or(do.To, "HEAD"))
+		return nil
 	}
-	return ts, nil
+	status.printf(iconTransformation, "%d files changed between %s and %s.", len(diffs), do.From, cmp.Or(do.To, "HEAD"))
+	return nil
 }
 
-func getFeatureArgs(transformation []byte, cfg *Config, args []string) []string {
-	var fn string
-	if bytes.Contains(transformation, []byte("- id: "+featureNameID)) {
-		fn = cfg.FeatureName
+func renderTemplate(ctx context.Context, w io.Writer, status *printer, cfg *Config, file string, inputs []string) error {
+	values := make(map[string]string, len(inputs))
+	for _, in := range inputs {
+		k, v, ok := strings.Cut(in, "=")
+		if !ok || k == "" {
+			return garchetype.WithHint(fmt.Errorf("invalid input %q", in), "inputs",
+				"Pass the inputs as --input key=value")
+		}
+		values[k] = v
 	}
-	var mod string
-	if bytes.Contains(transformation, []byte("- id: "+goModNameID)) {
-		goModBytes, err := os.ReadFile("go.mod")
-		if err == nil {
-			mod = modfile.ModulePath(goModBytes)
+	b, err := garchetype.Render(ctx, cfg.options(status, nil), file, values)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func watch(ctx context.Context, p, diag *printer, cfg *Config, dest string, args []string) error {
+	o := cfg.options(p, args)
+	o.Hooks.Rendered = func(r *garchetype.Report, err error) {
+		if err != nil {
+			diag.reportError(err)
+			return
 		}
+		p.printf(iconDone, "%s rendered %d files into %s", time.Now().Format(time.TimeOnly), len(r.Files), r.Destination)
 	}
-	as := []string{}
-	if fn != "" {
-		as = append(as, []string{"--" + featureNameID, fn}...)
+	p.printf(iconWatch, "Watching the '%s' archetype, press Ctrl+C to stop.", cfg.Archetype)
+	return garchetype.Watch(ctx, o, dest)
+}
+
+// aliased returns the suffix of a listed name with its aliases, if any.
+func aliased(aliases []string) string {
+	if len(aliases) == 0 {
+		return ""
 	}
-	if mod != "" {
-		as = append(as, []string{"--" + goModNameID, mod}...)
+	return " (" + strings.Join(aliases, ", ") + ")"
+}
+
+// deprecated returns the suffix of a listed name with its deprecation hint, if
+// any.
+func deprecated(hint string) string {
+	if hint == "" {
+		return ""
 	}
-	var removeNext bool
-	for _, a := range args {
-		switch {
-		case removeNext:
-			removeNext = false
-			continue
-		case a == "--"+featureNameID, a == "--"+goModNameID:
-			removeNext = true
-			continue
-		case strings.HasPrefix(a, "--"+featureNameID+"="), strings.HasPrefix(a, "--"+goModNameID+"="):
-			continue
-		default:
-			as = append(as, a)
-		}
+	return " [deprecated: " + hint + "]"
+}
+
+// described returns the suffix of a listed name with its description, if any.
+func described(description string) string {
+	if description == "" {
+		return ""
 	}
-	return as
+	return " - " + description
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision implemented.
+const mcpProtocolVersion = "2024-11-05"
+
+// mcpMaxMessage is the size limit of a message, one per line.
+const mcpMaxMessage = 1 << 20
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+type rpcRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool describes a tool, its arguments by their JSON schema.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpToolArgs are the arguments of all the tools.
+type mcpToolArgs struct {
+	Archetype      string            `json:"archetype"`
+	Transformation string            `json:"transformation"`
+	Feature        string            `json:"feature"`
+	Inputs         map[string]string `json:"inputs"`
+}
+
+// mcpContent is a text content block of a tool result.
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// mcpTools are the tools offered to the assistants.
+var mcpTools = []mcpTool{
+	{
+		Name:        "list_archetypes",
+		Description: "List the archetypes of the source, with their descriptions and transformations.",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{}},
+	},
+	{
+		Name:        "describe_inputs",
+		Description: "Describe the inputs of an archetype transformation, the builtin ones are answered by garchetype.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"archetype":      map[string]any{"type": "string", "description": "Archetype name."},
+				"transformation": map[string]any{"type": "string", "description": "Transformation name, the archetype default by default."},
+			},
+			"required": []string{"archetype"},
+		},
+	},
+	{
+		Name:        "add_feature",
+		Description: "Add a feature to the project in the current folder using an archetype, the git repository must be clean.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"archetype":      map[string]any{"type": "string", "description": "Archetype name."},
+				"transformation": map[string]any{"type": "string", "description": "Transformation name, the archetype default by default."},
+				"feature":        map[string]any{"type": "string", "description": "Feature name, e.g. payments-api."},
+				"inputs": map[string]any{
+					"type":                 "object",
+					"description":          "Input values by id.",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+			},
+			"required": []string{"archetype", "feature"},
+		},
+	},
+}
+
+// mcpServer serves the garchetype tools over the Model Context Protocol, one
+// JSON-RPC message per line.
+type mcpServer struct {
+	cfg  *Config
+	diag *printer
+	// hooks runs the hooks of the transformations, skipped by default as
+	// the assistants choose the archetypes.
+	hooks bool
+}
+
+// mcp runs the MCP server on r and w until r is closed.
+func mcp(ctx context.Context, r io.Reader, w io.Writer, diag *printer, cfg *Config, hooks bool) error {
+	s := &mcpServer{cfg: cfg, diag: diag, hooks: hooks}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), mcpMaxMessage)
+	enc := json.NewEncoder(w)
+	for sc.Scan() {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			if err := enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &rpcError{Code: rpcParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		result, rerr := s.handle(ctx, &req)
+		if len(req.ID) == 0 {
+			continue // A notification.
+		}
+		if err := enc.Encode(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr}); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func (s *mcpServer) handle(ctx context.Context, req *rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": exeName, "version": getBuildInfo().Version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var call struct {
+			Name      string      `json:"name"`
+			Arguments mcpToolArgs `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &call); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		return s.call(ctx, call.Name, call.Arguments)
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+// call runs the tool name, its failures are reported in the result so the
+// assistant can act on them.
+func (s *mcpServer) call(ctx context.Context, name string, args mcpToolArgs) (any, *rpcError) {
+	var warnings []string
+	o := garchetype.Options{
+		SourceDir:        s.cfg.SourceDir,
+		SourceRepo:       s.cfg.SourceRepo,
+		SourceRelease:    s.cfg.SourceRelease,
+		SourceAuth:       garchetype.SourceAuth{Type: s.cfg.SourceAuth},
+		PluginsDir:       s.cfg.PluginsDir,
+		CacheMaxSize:     s.cfg.cacheMaxSize,
+		ArchetypesFolder: s.cfg.ArchetypesFolder,
+		Archetype:        args.Archetype,
+		Transformation:   cmp.Or(args.Transformation, s.cfg.Transformation),
+		FeatureName:      args.Feature,
+		Inputs:           args.Inputs,
+		NoHooks:          !s.hooks,
+		MaxAge:           s.cfg.MaxAge,
+		NoPrompt:         true,
+		ToolVersion:      Version,
+		Logger:           s.diag.log,
+		Hooks:            garchetype.Hooks{Warn: func(msg string) { warnings = append(warnings, msg) }},
+	}
+	var v any
+	var err error
+	switch name {
+	case "list_archetypes":
+		v, err = garchetype.List(ctx, o)
+	case "describe_inputs":
+		v, err = garchetype.Inputs(ctx, o)
+	case "add_feature":
+		var r *garchetype.Report
+		if r, err = garchetype.Add(ctx, o); err == nil {
+			v = map[string]any{"feature": r.Feature, "files": r.Files, "warnings": warnings}
+		}
+	default:
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown tool: " + name}
+	}
+	if err != nil {
+		text := err.Error()
+		var he *garchetype.HintError
+		if errors.As(err, &he) {
+			text = fmt.Sprintf("%s\nHint: %s\nSee %s", text, he.Hint, he.Docs)
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}, IsError: true}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: string(b)}}}, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/diegosz/go-archetype/log"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// Status line icons, dropped in plain mode.
+const (
+	iconAdd            = "🌱"
+	iconSource         = "📚"
+	iconArchetype      = "📦"
+	iconTransformation = "📄"
+	iconDone           = "🎉"
+	iconWarning        = "🚨"
+	iconError          = "💥"
+	iconHint           = "💡"
+	iconDocs           = "📖"
+	iconWatch          = "👀"
+	iconDebug          = "🔎"
+)
+
+// plainIcons are the textual replacements of the icons that carry meaning on
+// their own, used in plain mode.
+var plainIcons = map[string]string{
+	iconWarning: "warning:",
+	iconHint:    "hint:",
+}
+
+// printer formats the user-facing output, either with emoji or plain text for
+// CI logs and terminals without emoji fonts.
+type printer struct {
+	w     io.Writer
+	plain bool
+	// theme sets the icons unless plain, colored on terminals.
+	theme *theme
+	color bool
+	// log gets the diagnostics. The warnings and errors are only routed to it
+	// when it writes structured logs, otherwise they are printed as well.
+	log        log.Logger
+	structured bool
+	// detail follows the label of the running spinner, see gitProgress.
+	detail atomic.Pointer[string]
+}
+
+func newPrinter(w io.Writer, plain bool, t *theme, logger log.Logger, structured bool) *printer {
+	return &printer{w: w, plain: plain, theme: t, color: isTerminal(w) && !noColor(), log: logger, structured: structured}
+}
+
+// noColor reports whether the NO_COLOR convention asks for plain output, see
+// https://no-color.org.
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// printf prints a line starting with icon, the format translated to the
+// language of the messages.
+func (p *printer) printf(icon, format string, a ...any) {
+	fmt.Fprintln(p.w, p.prefix(icon)+fmt.Sprintf(tr(format), a...))
+}
+
+// itemf prints a line starting with icon, indented under the previous one.
+func (p *printer) itemf(icon, format string, a ...any) {
+	fmt.Fprintln(p.w, " "+p.prefix(icon)+fmt.Sprintf(tr(format), a...))
+}
+
+// warnf prints a warning line or logs it.
+func (p *printer) warnf(format string, a ...any) {
+	if p.structured {
+		p.log.Warnf(format, a...)
+		return
+	}
+	p.printf(iconWarning, format, a...)
+}
+
+// reportError prints the err error line, along with its suggested fix, or logs
+// it.
+func (p *printer) reportError(err error) {
+	var he *garchetype.HintError
+	hinted := errors.As(err, &he)
+	switch {
+	case p.structured && hinted:
+		p.log.Errorf("%s error: %s (hint: %s, see %s)", exeName, err, cliHint(he), he.Docs)
+	case p.structured:
+		p.log.Errorf("%s error: %s", exeName, err)
+	default:
+		p.printf(iconError, "%s error: %s", exeName, err)
+		if hinted {
+			p.printf(iconHint, "%s", cliHint(he))
+			p.printf(iconDocs, "See %s", he.Docs)
+		}
+	}
+}
+
+func (p *printer) prefix(icon string) string {
+	if p.plain {
+		icon = tr(plainIcons[icon])
+	} else {
+		icon = p.theme.symbol(icon, p.color)
+	}
+	if icon == "" {
+		return ""
+	}
+	return icon + " "
+}
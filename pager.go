@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// defaultPager is the pager without GARCHETYPE_PAGER or PAGER, keeping the
+// colors.
+const defaultPager = "less -R"
+
+// pagerCommand returns the command line of the pager: GARCHETYPE_PAGER, PAGER
+// or less, in that order.
+func pagerCommand() string {
+	return cmp.Or(os.Getenv(envPrefix+"_PAGER"), os.Getenv("PAGER"), defaultPager)
+}
+
+// page writes out to w, through the pager when w is a terminal and out
+// exceeds its height. It falls back to writing it directly if the pager can't
+// be started.
+func page(w io.Writer, out []byte) error {
+	f, ok := w.(*os.File)
+	if !ok || !isTerminal(w) {
+		_, err := w.Write(out)
+		return err
+	}
+	_, height, err := term.GetSize(int(f.Fd()))
+	pager := strings.Fields(pagerCommand())
+	if err != nil || bytes.Count(out, []byte("\n")) < height || len(pager) == 0 {
+		_, err := w.Write(out)
+		return err
+	}
+	cmd := exec.Command(pager[0], pager[1:]...) //nolint:gosec // The user pager.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(out), f, os.Stderr
+	if err := cmd.Start(); err != nil {
+		_, err := w.Write(out)
+		return err
+	}
+	return cmd.Wait()
+}
@@ -0,0 +1,613 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+// Add adds a feature to the project using an archetype of the source. The
+// Module must be a member of the go.work workspace, if set.
+func Add(ctx context.Context, opts Options) (*Report, error) {
+	o := opts.withDefaults()
+	var err error
+	if o.Archetype == "" && o.Hooks.Archetype == nil {
+		err = multierr.Append(err, errors.New("archetype is required"))
+	}
+	if o.SourceDir == "" {
+		err = multierr.Append(err, WithHint(errors.New("source directory is required"), "archetypes",
+			"Pass %s with the archetypes source folder", optSourceDir))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConflicts(o.Conflicts); err != nil {
+		return nil, err
+	}
+	if o.Module != "" && !o.target && !o.reapply {
+		if err := checkWorkspaceModule(o.Module); err != nil {
+			return nil, err
+		}
+	}
+	if !o.synced {
+		if err := syncSource(ctx, o); err != nil {
+			return nil, err
+		}
+	}
+	var constraint string
+	o.Archetype, constraint = splitArchetypeVersion(o.Archetype)
+	if o.Archetype == "" {
+		if err := o.pickArchetype(ctx, opts.FeatureName); err != nil {
+			return nil, err
+		}
+	}
+	root, err := filepath.Abs(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	dest, err := filepath.Abs(o.moduleDir())
+	if err != nil {
+		return nil, err
+	}
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return nil, err
+	}
+	var rv *resolvedVersion
+	if constraint != "" {
+		vd, err := os.MkdirTemp("", toolName+"-version-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(vd)
+		if rv, err = o.checkoutVersion(ctx, o.Archetype, constraint, vd); err != nil {
+			return nil, err
+		}
+		ad = vd
+	}
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	if err := md.checkToolVersion(o.Archetype, o.ToolVersion); err != nil {
+		return nil, err
+	}
+	if err := md.validateFeatureName(o.FeatureName); err != nil {
+		if o.Hooks.FeatureName == nil {
+			return nil, err
+		}
+		if o.FeatureName, err = o.Hooks.FeatureName(err, md.validateFeatureName); err != nil {
+			return nil, err
+		}
+	}
+	eco, err := getEcosystem(md.Ecosystem)
+	if err != nil {
+		return nil, err
+	}
+	if sentinel := cmp.Or(o.Sentinel, eco.Sentinel); !o.NoSentinel && sentinel != "" {
+		mr := findUp(dest, sentinel)
+		if mr == "" {
+			err := fmt.Errorf("%s file not found in the %s folder nor its parents", sentinel, cmp.Or(o.Module, "current"))
+			if sentinel == goModFile {
+				return nil, WithHint(err, "errors-and-environment", "Run 'go mod init' first, or pass %s to skip the check", optNoSentinel)
+			}
+			return nil, WithHint(err, "modules-and-targets", "Create the %s file first, or pass %s or %s", sentinel, optSentinel, optNoSentinel)
+		}
+		// Run from a subfolder of the module, e.g. internal, the module folder
+		// is the project one, and the feature is generated into the subfolder.
+		if rel, err := filepath.Rel(mr, root); err == nil && filepath.IsLocal(rel) {
+			root = mr
+		}
+	}
+	if o.Transformation == "" && o.Hooks.Transformation != nil {
+		if err := o.pickTransformation(ad, md); err != nil {
+			return nil, err
+		}
+	}
+	pc, err := readProjectConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	o.Transformation = md.transformation(pc.transformation(o.Transformation))
+	tf, err := getTransformationFile(o.Transformation)
+	if err != nil {
+		return nil, err
+	}
+	tf = filepath.Join(ad, tf)
+	fi, err := os.Stat(tf)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, WithHint(fmt.Errorf("unknown transformation %q of the %q archetype", o.Transformation, o.Archetype), "archetypes",
+			"Run '%s list' to see the available transformations", toolName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("invalid transformation file: %s", tf)
+	}
+	spec, err := readTransformationSpec(tf)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkDeprecations(md, spec); err != nil {
+		return nil, err
+	}
+	r := &Report{
+		Feature:            o.FeatureName,
+		Archetype:          o.Archetype,
+		Transformation:     o.Transformation,
+		TransformationFile: tf,
+		Destination:        dest,
+	}
+	version := md.Version
+	if rv != nil {
+		r.Version, r.Tag, version = rv.Version, rv.Tag, rv.Version
+	}
+	if o.Hooks.Started != nil {
+		o.Hooks.Started(r)
+	}
+	gs, err := o.projectStatus(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if gs.Dirty && !o.Force && !o.target && o.OutputDir == "" {
+		return nil, WithHint(dirtyError(gs.Files), "errors-and-environment",
+			"Commit or stash your changes first, so the generated files are easy to review, or pass %s", optForce)
+	}
+	if gs.Detached {
+		o.Hooks.warn("HEAD is detached, the feature won't be added to a branch.")
+	}
+	if gs.Behind > 0 {
+		o.Hooks.warn(fmt.Sprintf("Your branch is %d commits behind %s, consider pulling first.", gs.Behind, gs.Upstream))
+	}
+	fr, err := readFeatureRegistry(root)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, dest)
+	if err != nil {
+		return nil, err
+	}
+	destination := strings.TrimPrefix(filepath.ToSlash(rel), ".")
+	if !o.Force && !o.reapply && o.OutputDir == "" && fr.has(o.FeatureName, o.Archetype, destination) {
+		return nil, WithHint(fmt.Errorf("feature %q was already added with the %q archetype", o.FeatureName, o.Archetype), "generated-files",
+			"Pick another feature name, or pass %s to generate it again", optForce)
+	}
+	o.fresh = !o.Force && !o.reapply && o.OutputDir == ""
+	if o.OutputDir == "" {
+		if err := o.applyRequirements(ctx, fr, md.Requires); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, err := o.render(ad, tf, dest, md, builtinVars(o, gs), pc)
+	if err != nil {
+		return nil, err
+	}
+	r.Files, r.Summary, r.Subpath = res.Files, res.Summary, res.Subpath
+	if r.Primary, err = primaryFiles(md.Open, res); err != nil {
+		return nil, err
+	}
+	var output string
+	if md.Ecosystem != "" && !o.NoFormat {
+		eol, _ := o.eol(md) // Checked by the generation.
+		if output, err = eco.format(cmp.Or(o.OutputDir, dest), res.Files, eol); err != nil {
+			return nil, err
+		}
+	}
+	if o.OutputDir != "" {
+		r.Destination = o.OutputDir
+		return r, nil
+	}
+	now, source, commit := time.Now(), cmp.Or(o.SourceRepo, o.SourceRelease, o.SourceDir), sourceCommit(ctx, o.status, o.SourceDir)
+	if rv != nil {
+		commit = rv.Commit
+	}
+	if err := pc.Runs.write(root, &runReport{
+		Time:            now,
+		User:            currentUser(o.NoGit),
+		Feature:         o.FeatureName,
+		Archetype:       o.Archetype,
+		Transformation:  o.Transformation,
+		Source:          source,
+		Commit:          commit,
+		Destination:     destination,
+		Inputs:          res.Inputs,
+		Files:           res.Files,
+		Summary:         res.Summary,
+		FormatterOutput: output,
+	}); err != nil {
+		return nil, fmt.Errorf("run report: %w", err)
+	}
+	op := operationAdd
+	if o.reapply {
+		op = operationReapply
+	}
+	if err := pc.History.append(root, &historyEntry{
+		Time:           now,
+		User:           currentUser(o.NoGit),
+		Operation:      op,
+		Feature:        o.FeatureName,
+		Archetype:      o.Archetype,
+		Transformation: o.Transformation,
+		Source:         source,
+		Commit:         commit,
+		Files:          res.Files,
+	}); err != nil {
+		return nil, fmt.Errorf("history log: %w", err)
+	}
+	if err := record(root, Feature{
+		Name:           o.FeatureName,
+		Archetype:      o.Archetype,
+		Transformation: o.Transformation,
+		Version:        version,
+		Constraint:     constraint,
+		Inputs:         res.Inputs,
+		Source:         source,
+		Commit:         commit,
+		Destination:    destination,
+		Applied:        now,
+		Files:          res.Files,
+		Created:        res.Created,
+	}); err != nil {
+		return nil, fmt.Errorf("feature registry: %w", err)
+	}
+	return r, nil
+}
+
+// primaryFiles returns the generated files of res matching the open globs of
+// the archetype, relative to its destination folder.
+func primaryFiles(open []string, res *generationResult) ([]string, error) {
+	if len(open) == 0 {
+		return nil, nil
+	}
+	pp, err := compilePatterns(open)
+	if err != nil {
+		return nil, WithHint(err, "archetype-metadata", "Fix the open globs of the archetype metadata")
+	}
+	var primary []string
+	for _, f := range res.Files {
+		if rel, err := filepath.Rel(filepath.FromSlash(res.Subpath), filepath.FromSlash(f)); err == nil && filepath.IsLocal(rel) && pp.match(rel) {
+			primary = append(primary, f)
+		}
+	}
+	return primary, nil
+}
+
+// limits returns the limits of the archetypes of the pc project configuration,
+// none with ForceLarge.
+func (o *Options) limits(pc *projectConfig) *limitsConfig {
+	if o.ForceLarge {
+		return nil
+	}
+	return &pc.Limits
+}
+
+// projectStatus returns the git status of the project in root, an empty one
+// with NoGit, or outside a repository writing into the OutputDir, as the
+// project is left untouched. The status is read through the status cache.
+func (o *Options) projectStatus(ctx context.Context, root string) (*gitstat.Status, error) {
+	if o.NoGit {
+		return &gitstat.Status{}, nil
+	}
+	gs, err := o.status.Get(ctx, root, gitstat.Options{Submodules: true})
+	if errors.Is(err, gitstat.ErrNotRepository) && o.OutputDir != "" {
+		return &gitstat.Status{}, nil
+	}
+	if errors.Is(err, gitstat.ErrNotRepository) {
+		return nil, WithHint(err, "errors-and-environment", "Run 'git init' first, or pass %s to skip the git checks", optNoGit)
+	}
+	return gs, err
+}
+
+// applyRequirements checks that the required archetypes were applied to the
+// project, as recorded in the fr registry, applying the missing ones first if
+// the Prerequisite hook confirms it.
+func (o *Options) applyRequirements(ctx context.Context, fr *featureRegistry, requires []string) error {
+	for _, req := range requires {
+		if fr.applied(req) {
+			continue
+		}
+		if req == o.Archetype || slices.Contains(o.requiredBy, req) {
+			return fmt.Errorf("archetype dependency cycle: %s", strings.Join(append(o.requiredBy, o.Archetype, req), " -> "))
+		}
+		err := WithHint(fmt.Errorf("the %q archetype requires the %q one, not applied to the project yet", o.Archetype, req),
+			"archetype-metadata", "Add the %s archetype first", req)
+		if o.Hooks.Prerequisite == nil {
+			return err
+		}
+		ok, perr := o.Hooks.Prerequisite(o.Archetype, req)
+		if perr != nil {
+			return perr
+		}
+		if !ok {
+			return err
+		}
+		p := Options{
+			SourceDir:          o.SourceDir,
+			SourceRepo:         o.SourceRepo,
+			ArchetypesFolder:   o.ArchetypesFolder,
+			Archetype:          req,
+			Module:             o.Module,
+			Sentinel:           o.Sentinel,
+			NoSentinel:         o.NoSentinel,
+			StrictDeprecations: o.StrictDeprecations,
+			StrictVars:         o.StrictVars,
+			NoGit:              o.NoGit,
+			ForceLarge:         o.ForceLarge,
+			NoHooks:            o.NoHooks,
+			Conflicts:          o.Conflicts,
+			PluginsDir:         o.PluginsDir,
+			CacheMaxSize:       o.CacheMaxSize,
+			ToolVersion:        o.ToolVersion,
+			LineEndings:        o.LineEndings,
+			Force:              true, // The repository was clean, and it's going to be dirty.
+			Logger:             o.Logger,
+			Hooks:              o.Hooks,
+			requiredBy:         append(slices.Clone(o.requiredBy), o.Archetype),
+			status:             o.status,
+		}
+		if _, err := Add(ctx, p); err != nil {
+			return fmt.Errorf("prerequisite %q: %w", req, err)
+		}
+	}
+	return nil
+}
+
+// pickArchetype sets the archetype picked by the Archetype hook among the ones
+// of the source, and the feature name defaulting to it.
+func (o *Options) pickArchetype(ctx context.Context, featureName string) error {
+	as, err := listSource(ctx, o.SourceDir, o.ArchetypesFolder)
+	if err != nil {
+		return err
+	}
+	if len(as) == 0 {
+		return fmt.Errorf("no archetypes in %s", filepath.Join(o.SourceDir, o.ArchetypesFolder))
+	}
+	if o.Archetype, err = o.Hooks.Archetype(as); err != nil {
+		return err
+	}
+	o.FeatureName = cmp.Or(featureName, archetypeBaseName(o.Archetype))
+	return nil
+}
+
+// checkDeprecations warns about the archetype with the md metadata, and its
+// transformation spec, when they're deprecated, or fails with
+// StrictDeprecations.
+func (o *Options) checkDeprecations(md *archetypeMetadata, spec *transformationSpec) error {
+	var errs error
+	for _, d := range []struct{ what, hint string }{
+		{fmt.Sprintf("archetype %q", o.Archetype), md.Deprecated},
+		{fmt.Sprintf("transformation %q of the %q archetype", o.Transformation, o.Archetype), spec.Deprecated},
+	} {
+		if d.hint == "" {
+			continue
+		}
+		msg := fmt.Sprintf("%s is deprecated: %s", d.what, strings.TrimSpace(d.hint))
+		if !o.StrictDeprecations {
+			o.Hooks.warn("The " + msg)
+			continue
+		}
+		errs = multierr.Append(errs, errors.New(msg))
+	}
+	if errs != nil {
+		return WithHint(errs, "archetype-metadata", "Follow the replacement hint, or run it without %s", optStrictDeprecations)
+	}
+	return nil
+}
+
+// pickTransformation sets the transformation picked by the Transformation hook
+// among the ones of the archetype in ad, with the md metadata, when it has more
+// than one.
+func (o *Options) pickTransformation(ad string, md *archetypeMetadata) error {
+	ts, err := archetypeTransformations(ad, md)
+	if err != nil {
+		return err
+	}
+	switch len(ts) {
+	case 0:
+		return nil
+	case 1:
+		o.Transformation = ts[0].Name
+		return nil
+	}
+	o.Transformation, err = o.Hooks.Transformation(ts)
+	return err
+}
+
+// maxDirtyFiles is the number of changed files named by the dirty error.
+const maxDirtyFiles = 5
+
+// dirtyError returns the error of a dirty repository naming its changed files.
+func dirtyError(files []gitstat.FileStatus) error {
+	names := make([]string, 0, maxDirtyFiles)
+	for _, f := range files[:min(len(files), maxDirtyFiles)] {
+		names = append(names, f.Path)
+	}
+	if n := len(files) - len(names); n > 0 {
+		names = append(names, fmt.Sprintf("and %d more", n))
+	}
+	return fmt.Errorf("git repository is dirty: %s", strings.Join(names, ", "))
+}
+
+// render generates the archetype in the ad folder with its transformation file
+// tf into dest, with the base variables along with the feature name variants,
+// the project config ones and the input values of the var file.
+func (o *Options) render(ad, tf, dest string, md *archetypeMetadata, base map[string]string, pc *projectConfig) (*generationResult, error) {
+	spec, err := readTransformationSpec(tf)
+	if err != nil {
+		return nil, err
+	}
+	fid := featureInputID(md, spec)
+	values := maps.Clone(o.recorded)
+	if values == nil {
+		values = map[string]string{}
+	}
+	if o.VarFile != "" {
+		vf, err := readVarFile(o.VarFile)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(values, vf)
+	}
+	maps.Copy(values, o.Inputs)
+	ia, extra := inputArgs(spec, values)
+	cv, err := spec.conditionVars(dest)
+	if err != nil {
+		return nil, err
+	}
+	vars := maps.Clone(base)
+	addCaseVariants(vars, fid, o.FeatureName)
+	maps.Copy(vars, cv)
+	maps.Copy(vars, pc.Vars)
+	maps.Copy(vars, extra)
+	args := getFeatureArgs(spec, fid, o, append(ia, o.Args...))
+	var header string
+	if o.Provenance || pc.Provenance {
+		header = provenanceHeader(o.Archetype, md.Version, time.Now())
+	}
+	license, err := pc.License.header(licenseData{Year: time.Now().Year(), Feature: o.FeatureName, Archetype: o.Archetype, Vars: vars})
+	if err != nil {
+		return nil, err
+	}
+	eol, err := o.eol(md)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.validateValues(argValues(args)); err != nil {
+		return nil, err
+	}
+	switch missing := missingInputs(spec, args); {
+	case len(missing) > 0 && o.NoPrompt:
+		return nil, WithHint(fmt.Errorf("missing inputs: %s", strings.Join(missing, ", ")), "inputs",
+			"Provide a value for each input, or a default in the transformation file")
+	case o.Hooks.Input != nil:
+		for _, id := range missing {
+			in, _ := spec.input(id)
+			v, err := o.Hooks.Input(in.public(false), in.validate)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "--"+id+"="+v)
+		}
+	}
+	res, err := generate(&generation{
+		TransformationFile: tf,
+		Source:             ad,
+		Destination:        dest,
+		Subpath:            cmp.Or(o.Subpath, md.Destination),
+		Args:               args,
+		Vars:               vars,
+		Symlinks:           md.Symlinks,
+		Directories:        md.Directories,
+		Only:               o.Only,
+		Exclude:            o.Exclude,
+		Confirm:            o.Hooks.Confirm,
+		Conflicts:          o.Conflicts,
+		Conflict:           o.Hooks.Conflict,
+		Output:             o.OutputDir,
+		Progress:           o.Hooks.Progress,
+		Template:           o.Hooks.Template,
+		Trace:              o.Hooks.Trace,
+		StrictVars:         o.StrictVars,
+		Limits:             o.limits(pc),
+		Inputs:             spec.Inputs,
+		Fresh:              o.fresh,
+		Header:             header,
+		License:            license,
+		LicenseExclude:     pc.License.Exclude,
+		EOL:                eol,
+		NoHooks:            o.NoHooks,
+		HooksConfig:        pc.Hooks,
+		HooksDir:           cmp.Or(o.hooksDir, o.Dir),
+		Wasm:               spec.Wasm,
+		Warn:               o.Hooks.warn,
+		Logger:             o.Logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Inputs = argValues(args)
+	for _, in := range spec.Inputs {
+		if _, ok := res.Inputs[in.ID]; ok && in.Secret {
+			res.Inputs[in.ID] = maskedSecret
+		}
+	}
+	return res, nil
+}
+
+// getTransformationFile returns the name of the file of the transformation,
+// in the archetype folder. The names with path separators are rejected, so a
+// name coming from a request can't load a file outside the archetype.
+func getTransformationFile(transformation string) (string, error) {
+	if transformation == "" {
+		return "", errors.New("undefined transformation")
+	}
+	f := fmt.Sprintf("%s%s.%s", transformationPrefix, transformation, transformationExt)
+	if strings.ContainsAny(transformation, `/\`) || !filepath.IsLocal(f) || filepath.Base(f) != f {
+		return "", WithHint(fmt.Errorf("invalid transformation name %q", transformation), "archetypes",
+			"Run '%s list' to see the available transformations", toolName)
+	}
+	return f, nil
+}
+
+// missingInputs returns the ids of the declared inputs the CLI arguments args
+// don't answer.
+func missingInputs(spec *transformationSpec, args []string) []string {
+	var missing []string
+	for _, in := range spec.Inputs {
+		if !slices.ContainsFunc(args, func(a string) bool { return a == "--"+in.ID || strings.HasPrefix(a, "--"+in.ID+"=") }) {
+			missing = append(missing, in.ID)
+		}
+	}
+	return missing
+}
+
+// getFeatureArgs returns the CLI arguments for the generator, answering the
+// feature name input (featureID) and the module path inputs on behalf of the
+// user.
+func getFeatureArgs(spec *transformationSpec, featureID string, o *Options, args []string) []string {
+	mod := goModulePath(o.moduleDir())
+	answers := []struct{ id, value string }{
+		{featureID, o.FeatureName},
+		{goModNameID, mod},
+		{modulePathID, mod},
+	}
+	as := []string{}
+	var ids []string
+	for _, a := range answers {
+		if _, ok := spec.input(a.id); ok && a.value != "" {
+			as = append(as, "--"+a.id, a.value)
+			ids = append(ids, a.id)
+		}
+	}
+	var removeNext bool
+	for _, a := range args {
+		switch {
+		case removeNext:
+			removeNext = false
+			continue
+		case slices.ContainsFunc(ids, func(id string) bool { return a == "--"+id }):
+			removeNext = true
+			continue
+		case slices.ContainsFunc(ids, func(id string) bool { return strings.HasPrefix(a, "--"+id+"=") }):
+			continue
+		default:
+			as = append(as, a)
+		}
+	}
+	return as
+}
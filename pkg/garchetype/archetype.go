@@ -0,0 +1,196 @@
+package garchetype
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// archetypeMetadataFile is the name of the optional metadata file, looked up in
+// the archetype folder. It's never generated.
+const archetypeMetadataFile = "archetype.yaml"
+
+// featureRole is the role of the input taking the feature name.
+const featureRole = "feature"
+
+// archetypeMetadata holds the archetype settings that apply to all of its
+// transformations.
+type archetypeMetadata struct {
+	// Description is shown by list, only its first line.
+	Description string `yaml:"description"`
+	// Version of the archetype, listed in the catalog index.
+	Version     string          `yaml:"version"`
+	FeatureName featureNameSpec `yaml:"featureName"`
+	// Destination is the folder within the project the archetype lands in, it
+	// may use template actions, e.g. internal/features/{{ .feature_name }}.
+	Destination string `yaml:"destination"`
+	// Ecosystem is the target language of the archetype: go (default), node,
+	// python, rust or generic. Declaring it also enables the formatter.
+	Ecosystem string `yaml:"ecosystem"`
+	// Symlinks is the handling of the archetype symlinks: follow (default)
+	// copies the target contents, preserve recreates the symlinks.
+	Symlinks string `yaml:"symlinks"`
+	// Directories must exist in the generated output even when empty, e.g.
+	// migrations, they may use template actions.
+	Directories []string `yaml:"directories"`
+	// Requires are the archetypes that must be applied to the project first,
+	// e.g. grpc-service for grpc-endpoint.
+	Requires []string `yaml:"requires"`
+	// DefaultTransformation is used when none is given, DefaultTransformation
+	// by default.
+	DefaultTransformation string `yaml:"defaultTransformation"`
+	// TransformationAliases are short names of the transformations, e.g. min
+	// for minimal-no-tests.
+	TransformationAliases map[string]string `yaml:"transformationAliases"`
+	// Deprecated marks the archetype as deprecated, with the hint of its
+	// replacement, e.g. Use the http-service archetype instead.
+	Deprecated string `yaml:"deprecated"`
+	// MinGarchetypeVersion is the oldest garchetype version able to generate
+	// the archetype, e.g. 0.9.0.
+	MinGarchetypeVersion string `yaml:"minGarchetypeVersion"`
+	// LineEndings of the generated text files: lf, crlf or auto, the
+	// rendered ones by default.
+	LineEndings string `yaml:"lineEndings"`
+	// Open are the globs of the primary generated files, relative to the
+	// destination folder, e.g. handler.go, opened by add --open.
+	Open []string `yaml:"open"`
+}
+
+// canonicalVersion returns the semantic version v with the v prefix, or an
+// empty string if it's invalid.
+func canonicalVersion(v string) string {
+	if v != "" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	return semver.Canonical(v)
+}
+
+// checkToolVersion returns an error if the tool version is older than the
+// minimum one of the archetype. Unknown versions, e.g. development builds,
+// are never rejected.
+func (md *archetypeMetadata) checkToolVersion(archetype, version string) error {
+	required, v := canonicalVersion(md.MinGarchetypeVersion), canonicalVersion(version)
+	if required == "" || v == "" || semver.Compare(v, required) >= 0 {
+		return nil
+	}
+	return WithHint(fmt.Errorf("the %q archetype requires %s %s or newer, this is %s", archetype, toolName, required, v), "archetype-metadata",
+		"Upgrade with '%s self-update'", toolName)
+}
+
+// transformation returns the name of the transformation to use, the archetype
+// default one if name is empty, resolving the aliases.
+func (md *archetypeMetadata) transformation(name string) string {
+	name = cmp.Or(name, md.DefaultTransformation, DefaultTransformation)
+	if t, ok := md.TransformationAliases[name]; ok {
+		return t
+	}
+	return name
+}
+
+// aliases returns the sorted aliases of the transformation t.
+func (md *archetypeMetadata) aliases(t string) []string {
+	var as []string
+	for a, name := range md.TransformationAliases {
+		if name == t {
+			as = append(as, a)
+		}
+	}
+	slices.Sort(as)
+	return as
+}
+
+// featureNameSpec describes how the archetype takes the feature name.
+type featureNameSpec struct {
+	// Input is the id of the input taking the feature name, feature_name by
+	// default.
+	Input string `yaml:"input"`
+	// Pattern is a regular expression the feature name must match.
+	Pattern   string `yaml:"pattern"`
+	MinLength int    `yaml:"minLength"`
+	MaxLength int    `yaml:"maxLength"`
+}
+
+// validate returns an error if name doesn't comply with the spec rules.
+func (s featureNameSpec) validate(name string) error {
+	n := utf8.RuneCountInString(name)
+	switch {
+	case s.MinLength > 0 && n < s.MinLength:
+		return fmt.Errorf("feature name %q is too short, the minimum length is %d", name, s.MinLength)
+	case s.MaxLength > 0 && n > s.MaxLength:
+		return fmt.Errorf("feature name %q is too long, the maximum length is %d", name, s.MaxLength)
+	case s.Pattern != "":
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid feature name pattern: %w", err)
+		}
+		if !re.MatchString(name) {
+			return fmt.Errorf("feature name %q doesn't match the pattern %s", name, s.Pattern)
+		}
+	}
+	return nil
+}
+
+// validateFeatureName returns an error if name is not a valid identifier for
+// the archetype ecosystem, or doesn't comply with its feature name rules.
+func (md *archetypeMetadata) validateFeatureName(name string) error {
+	if err := checkFeatureName(name, md.Ecosystem); err != nil {
+		return err
+	}
+	return md.FeatureName.validate(name)
+}
+
+// archetypeBaseName returns the last element of the archetype name, e.g.
+// postgres for db/postgres.
+func archetypeBaseName(archetype string) string {
+	if archetype == "" {
+		return ""
+	}
+	return path.Base(archetype)
+}
+
+// readArchetypeMetadata reads the metadata file in the archetype folder dir. A
+// missing file yields empty metadata.
+func readArchetypeMetadata(dir string) (*archetypeMetadata, error) {
+	md := &archetypeMetadata{}
+	f := filepath.Join(dir, archetypeMetadataFile)
+	b, err := os.ReadFile(f)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return md, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, md); err != nil {
+		return nil, fmt.Errorf("invalid archetype metadata %s: %w", f, err)
+	}
+	switch md.Symlinks {
+	case "", symlinksFollow, symlinksPreserve:
+	default:
+		return nil, fmt.Errorf("invalid archetype metadata %s: unknown symlinks mode %q", f, md.Symlinks)
+	}
+	return md, nil
+}
+
+// featureInputID returns the id of the input taking the feature name: the one
+// named in the metadata, or the one with the feature role, or feature_name.
+func featureInputID(md *archetypeMetadata, ts *transformationSpec) string {
+	if md.FeatureName.Input != "" {
+		return md.FeatureName.Input
+	}
+	for _, in := range ts.Inputs {
+		if in.Role == featureRole {
+			return in.ID
+		}
+	}
+	return featureNameID
+}
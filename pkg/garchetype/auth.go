@@ -0,0 +1,272 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Authentication types of the sources, see SourceAuth.
+const (
+	AuthGitHubApp      = "github-app"
+	AuthGitLabJobToken = "gitlab-job-token"
+	AuthGiteaToken     = "gitea-token"
+)
+
+// SourceAuth authenticates the HTTPS clones and pulls of a source repository
+// with the built-in flow of its host, e.g. in CI jobs. The settings left empty
+// come from the environment variables of the platform.
+type SourceAuth struct {
+	// Type is AuthGitHubApp, AuthGitLabJobToken or AuthGiteaToken, none by
+	// default.
+	Type string `yaml:"type"`
+	// TokenEnv names the environment variable holding the token of the
+	// GitLab job, CI_JOB_TOKEN by default, or Gitea, GITEA_TOKEN by default.
+	TokenEnv string `yaml:"tokenEnv"`
+	// AppID and InstallationID identify the installation of the GitHub App,
+	// GITHUB_APP_ID and GITHUB_APP_INSTALLATION_ID by default.
+	AppID          string `yaml:"appID"`
+	InstallationID string `yaml:"installationID"`
+	// PrivateKeyFile is the PEM private key of the GitHub App, by default the
+	// GITHUB_APP_PRIVATE_KEY contents.
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+}
+
+// auth returns the authentication of the repository at url, the one of a,
+// or the ssh default one without it.
+func (a SourceAuth) auth(ctx context.Context, url string) (transport.AuthMethod, error) {
+	switch a.Type {
+	case "":
+		return sshAuth(url), nil
+	case AuthGitLabJobToken:
+		return envTokenAuth("gitlab-ci-token", cmp.Or(a.TokenEnv, "CI_JOB_TOKEN"))
+	case AuthGiteaToken:
+		return envTokenAuth(toolName, cmp.Or(a.TokenEnv, "GITEA_TOKEN"))
+	case AuthGitHubApp:
+		ep, err := transport.NewEndpoint(url)
+		if err != nil {
+			return nil, err
+		}
+		token, err := a.installationToken(ctx, ep.Host)
+		if err != nil {
+			return nil, WithHint(fmt.Errorf("could not get the GitHub App installation token: %w", err), "project-configuration",
+				"Check the GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY of the app")
+		}
+		return &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+	}
+	return nil, WithHint(fmt.Errorf("invalid source auth type %q", a.Type), "project-configuration",
+		"Use %s, %s or %s", AuthGitHubApp, AuthGitLabJobToken, AuthGiteaToken)
+}
+
+// do runs fn with the authentication of the repository at url. Without an
+// auth type, if the HTTPS repository requires authentication, fn is retried
+// with the credentials of the git credential helpers, e.g. osxkeychain or
+// manager-core, which are told whether they worked.
+func (a SourceAuth) do(ctx context.Context, url string, fn func(auth transport.AuthMethod) error) error {
+	auth, err := a.auth(ctx, url)
+	if err != nil {
+		return err
+	}
+	err = fn(auth)
+	if a.Type != "" || !isAuthError(err) {
+		return err
+	}
+	cred, cerr := credentialFill(ctx, url)
+	if cerr != nil {
+		return err
+	}
+	err = fn(cred)
+	switch {
+	case err == nil:
+		_ = gitCredential(ctx, "approve", url, cred)
+	case isAuthError(err):
+		_ = gitCredential(ctx, "reject", url, cred)
+	}
+	return err
+}
+
+// isAuthError reports whether err is a missing or rejected authentication.
+func isAuthError(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed)
+}
+
+// credentialFill returns the credentials of the HTTPS repository at url from
+// the git credential helpers, with `git credential fill`. The user isn't
+// prompted for them.
+func credentialFill(ctx context.Context, url string) (*githttp.BasicAuth, error) {
+	out, err := gitCredentialOutput(ctx, "fill", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	cred := &githttp.BasicAuth{}
+	for _, l := range strings.Split(out, "\n") {
+		k, v, _ := strings.Cut(l, "=")
+		switch k {
+		case "username":
+			cred.Username = v
+		case "password":
+			cred.Password = v
+		}
+	}
+	if cred.Password == "" {
+		return nil, errors.New("no credentials")
+	}
+	return cred, nil
+}
+
+// gitCredential tells the git credential helpers whether the cred credentials
+// of the repository at url worked, the action being approve or reject.
+func gitCredential(ctx context.Context, action, url string, cred *githttp.BasicAuth) error {
+	_, err := gitCredentialOutput(ctx, action, url, cred)
+	return err
+}
+
+// gitCredentialOutput runs `git credential action` for the HTTPS repository at
+// url, with the cred credentials if any, and returns its output.
+func gitCredentialOutput(ctx context.Context, action, url string, cred *githttp.BasicAuth) (string, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return "", err
+	}
+	if ep.Protocol != "https" && ep.Protocol != "http" {
+		return "", fmt.Errorf("no credential helpers for %s URLs", ep.Protocol)
+	}
+	host := ep.Host
+	if ep.Port != 0 {
+		host += ":" + strconv.Itoa(ep.Port)
+	}
+	in := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n", ep.Protocol, host, strings.TrimPrefix(ep.Path, "/"))
+	if cred != nil {
+		in += fmt.Sprintf("username=%s\npassword=%s\n", cred.Username, cred.Password)
+	}
+	cmd := exec.CommandContext(ctx, "git", "credential", action)
+	cmd.Stdin = strings.NewReader(in + "\n")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// envTokenAuth returns the basic authentication of user with the token of the
+// env variable.
+func envTokenAuth(user, env string) (transport.AuthMethod, error) {
+	token := os.Getenv(env)
+	if token == "" {
+		return nil, WithHint(fmt.Errorf("%s is not set", env), "project-configuration",
+			"Set the token of the source repository in %s", env)
+	}
+	return &githttp.BasicAuth{Username: user, Password: token}, nil
+}
+
+// githubAppJWTTTL is the lifetime of the JWTs authenticating as the GitHub
+// App, GitHub allows up to 10 minutes.
+const githubAppJWTTTL = 9 * time.Minute
+
+// installationToken returns a token of the installation of the GitHub App on
+// the host, GitHub or a GitHub Enterprise Server.
+func (a SourceAuth) installationToken(ctx context.Context, host string) (string, error) {
+	appID := cmp.Or(a.AppID, os.Getenv("GITHUB_APP_ID"))
+	installation := cmp.Or(a.InstallationID, os.Getenv("GITHUB_APP_INSTALLATION_ID"))
+	if appID == "" || installation == "" {
+		return "", errors.New("undefined app or installation id")
+	}
+	key := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if a.PrivateKeyFile != "" {
+		var err error
+		if key, err = os.ReadFile(a.PrivateKeyFile); err != nil {
+			return "", err
+		}
+	}
+	jwt, err := githubAppJWT(appID, key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	api := githubAPI
+	if host != "github.com" {
+		api = "https://" + host + "/api/v3"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/app/installations/%s/access_tokens", api, installation), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("POST %s: %s", req.URL, res.Status)
+	}
+	var t struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	return t.Token, nil
+}
+
+// githubAppJWT returns the RS256 JWT authenticating as the GitHub App appID
+// with its PEM private key, issued at now.
+func githubAppJWT(appID string, key []byte, now time.Time) (string, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return "", errors.New("invalid private key, it must be PEM encoded")
+	}
+	var pk *rsa.PrivateKey
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err == nil {
+		var ok bool
+		if pk, ok = k.(*rsa.PrivateKey); !ok {
+			return "", errors.New("invalid private key, it must be an RSA key")
+		}
+	} else if pk, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(), // Allow for clock drift.
+		"exp": now.Add(githubAppJWTTTL).Unix(),
+		"iss": appIDClaim(appID),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// appIDClaim returns the iss claim of the GitHub App appID, a number unless
+// it's the client id of the app.
+func appIDClaim(appID string) any {
+	if n, err := strconv.ParseInt(appID, 10, 64); err == nil {
+		return n
+	}
+	return appID
+}
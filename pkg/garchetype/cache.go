@@ -0,0 +1,96 @@
+package garchetype
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+// listCache is the cached listing of a source, stored in the user cache folder.
+type listCache struct {
+	// Synced is the last time the source was synced with its remote.
+	Synced time.Time `json:"synced"`
+	// Commit and ArchetypesFolder identify the listing of Archetypes.
+	Commit           string      `json:"commit"`
+	ArchetypesFolder string      `json:"archetypesFolder"`
+	Archetypes       []Archetype `json:"archetypes"`
+}
+
+// listCacheFile returns the cache file of the source in dir.
+func listCacheFile(dir string) (string, error) {
+	cd, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cd, toolName, "list", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// readListCache reads the cached listing of the source in dir. A missing or
+// unreadable cache yields an empty one.
+func readListCache(dir string) *listCache {
+	lc := &listCache{}
+	f, err := listCacheFile(dir)
+	if err != nil {
+		return lc
+	}
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return lc
+	}
+	if err := json.Unmarshal(b, lc); err != nil {
+		return &listCache{}
+	}
+	return lc
+}
+
+// write stores the cached listing of the source in dir. The cache is best
+// effort, so the callers may ignore the error.
+func (lc *listCache) write(dir string) error {
+	f, err := listCacheFile(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil { //nolint:mnd,gosec // Standard permissions.
+		return err
+	}
+	b, err := json.Marshal(lc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f, b, 0o644) //nolint:mnd,gosec // Standard permissions.
+}
+
+// fresh reports whether the source was synced within maxAge.
+func (lc *listCache) fresh(maxAge time.Duration) bool {
+	return maxAge > 0 && time.Since(lc.Synced) < maxAge
+}
+
+// cachedListSource is like listSource, reusing the cached listing of a clean
+// source at the same commit. The status of the source is read through the c
+// cache.
+func cachedListSource(ctx context.Context, c *gitstat.Cache, lc *listCache, dir, archetypesFolder string) ([]Archetype, error) {
+	var commit string
+	if gs, err := c.Get(ctx, dir, gitstat.Options{}); err == nil && !gs.Dirty {
+		commit = gs.Hash
+	}
+	if commit != "" && lc.Commit == commit && lc.ArchetypesFolder == archetypesFolder && lc.Archetypes != nil {
+		return lc.Archetypes, nil
+	}
+	as, err := listSource(ctx, dir, archetypesFolder)
+	if err != nil {
+		return nil, err
+	}
+	lc.Commit, lc.ArchetypesFolder, lc.Archetypes = commit, archetypesFolder, as
+	return as, nil
+}
@@ -0,0 +1,147 @@
+package garchetype
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gopkg.in/yaml.v2"
+)
+
+// catalogIndexFile is the catalog index of a source, in its archetypes folder.
+const catalogIndexFile = "index.yaml"
+
+// catalog is the index of the archetypes of a source.
+type catalog struct {
+	Archetypes []Archetype `yaml:"archetypes"`
+}
+
+// catalogHeader heads the generated catalog index files.
+const catalogHeader = "# Code generated by " + toolName + " index. DO NOT EDIT.\n"
+
+// Index writes the catalog index of the source folder, the archetypes with
+// their descriptions, versions and transformations, for ListRemote. The source
+// isn't synced, as its maintainers index their working copy. It returns the
+// path of the index file.
+func Index(ctx context.Context, opts Options) (string, error) {
+	o := opts.withDefaults()
+	if o.SourceDir == "" {
+		return "", WithHint(errors.New("source directory is required"), "sources-and-cache",
+			"Pass %s with the archetypes source folder", optSourceDir)
+	}
+	as, err := listSource(ctx, o.SourceDir, o.ArchetypesFolder)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(&catalog{Archetypes: as})
+	if err != nil {
+		return "", err
+	}
+	f := filepath.Join(o.SourceDir, o.firstArchetypesFolder(), catalogIndexFile)
+	if err := os.WriteFile(f, append([]byte(catalogHeader), b...), 0o644); err != nil { //nolint:mnd,gosec // Standard permissions.
+		return "", err
+	}
+	return f, nil
+}
+
+// ListRemote returns the archetypes of the catalog index of the source
+// repository, fetched on its own instead of cloning the repository.
+func ListRemote(ctx context.Context, opts Options) ([]Archetype, error) {
+	o := opts.withDefaults()
+	if o.SourceRepo == "" {
+		return nil, WithHint(errors.New("source repository is required"), "sources-and-cache",
+			"Pass %s with the archetypes repository URL", optSourceRepo)
+	}
+	stop := o.Hooks.busy("Fetching the catalog of " + o.SourceRepo)
+	b, err := fetchRemoteFile(ctx, o.SourceRepo, path.Join(filepath.ToSlash(o.firstArchetypesFolder()), catalogIndexFile))
+	stop()
+	if err != nil {
+		return nil, WithHint(fmt.Errorf("could not fetch the catalog of %s: %w", o.SourceRepo, err), "sources-and-cache",
+			"Check that the source has a catalog index, or pass %s to list a clone", optSourceDir)
+	}
+	c := &catalog{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("invalid catalog of %s: %w", o.SourceRepo, err)
+	}
+	for i := range c.Archetypes {
+		c.Archetypes[i].Source = o.SourceRepo
+	}
+	return c.Archetypes, nil
+}
+
+// fetchRemoteFile returns the file at path p of the source branch of repo,
+// downloaded over HTTPS from the hosts serving raw files, or with `git archive`
+// otherwise.
+func fetchRemoteFile(ctx context.Context, repo, p string) ([]byte, error) {
+	if u := rawFileURL(repo, p); u != "" {
+		return httpGet(ctx, u)
+	}
+	return gitArchiveFile(ctx, repo, p)
+}
+
+// rawFileURL returns the URL of the raw file at path p of repo, empty if its
+// host isn't known to serve them.
+func rawFileURL(repo, p string) string {
+	ep, err := transport.NewEndpoint(repo)
+	if err != nil || ep.Protocol == "file" {
+		return ""
+	}
+	project := strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git")
+	switch {
+	case ep.Host == "github.com":
+		return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s", project, sourceBranch, p)
+	case strings.Contains(ep.Host, "gitlab"):
+		return fmt.Sprintf("https://%s/%s/-/raw/%s/%s", ep.Host, project, sourceBranch, p)
+	default:
+		return ""
+	}
+}
+
+func httpGet(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// gitArchiveFile returns the file at path p of the source branch of repo, with
+// `git archive --remote`, which the server must allow.
+func gitArchiveFile(ctx context.Context, repo, p string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "archive", "--remote="+repo, sourceBranch, p)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		return nil, fmt.Errorf("git archive: %w: %s", err, strings.TrimSpace(msg))
+	}
+	tr := tar.NewReader(bytes.NewReader(out))
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("git archive: %s: %w", p, err)
+		}
+		if h.Name == p {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package garchetype
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+// conditionSpec is a predicate on the destination project, setting its ID
+// variable to true when all of its checks hold, so the conditions of the
+// include transformations can select the matching branches of the archetype.
+type conditionSpec struct {
+	ID string `yaml:"id"`
+	// Exists is the glob of a file that must exist in the module folder.
+	Exists string `yaml:"exists"`
+	// Marker is a text, e.g. a marker comment, that one of the Exists files
+	// must contain.
+	Marker string `yaml:"marker"`
+	// Requires is a module the go.mod of the module folder must require,
+	// e.g. github.com/go-chi/chi, whatever its major version.
+	Requires string `yaml:"requires"`
+}
+
+// conditionVars returns the variables of the conditions of the transformation
+// evaluated against the module folder dir, true or empty.
+func (ts *transformationSpec) conditionVars(dir string) (map[string]string, error) {
+	vars := make(map[string]string, len(ts.Conditions))
+	for _, c := range ts.Conditions {
+		ok, err := c.holds(dir)
+		if err != nil {
+			return nil, err
+		}
+		vars[c.ID] = ""
+		if ok {
+			vars[c.ID] = "true"
+		}
+	}
+	return vars, nil
+}
+
+// holds reports whether the checks of the condition hold in the module folder
+// dir.
+func (c conditionSpec) holds(dir string) (bool, error) {
+	switch {
+	case c.ID == "":
+		return false, WithHint(errors.New("condition without id"), "templates",
+			"Set the id of the variable each condition sets")
+	case c.Exists == "" && c.Requires == "":
+		return false, WithHint(fmt.Errorf("condition %s checks nothing", c.ID), "templates",
+			"Set its exists glob, its marker along with it, or the module it requires")
+	case c.Marker != "" && c.Exists == "":
+		return false, WithHint(fmt.Errorf("condition %s has a marker without files", c.ID), "templates",
+			"Set the exists glob of the files the marker is looked for in")
+	}
+	if c.Requires != "" && !requiresModule(dir, c.Requires) {
+		return false, nil
+	}
+	if c.Exists == "" {
+		return true, nil
+	}
+	return c.existing(dir)
+}
+
+// existing reports whether a file of the module folder dir matches the Exists
+// glob, and has the Marker if set.
+func (c conditionSpec) existing(dir string) (bool, error) {
+	pp, err := compilePatterns([]string{c.Exists})
+	if err != nil {
+		return false, WithHint(fmt.Errorf("condition %s: %w", c.ID, err), "templates",
+			"Fix the exists glob of the condition")
+	}
+	found := false
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || !pp.match(rel) {
+			return err
+		}
+		if c.Marker != "" {
+			b, err := os.ReadFile(p)
+			if err != nil || !bytes.Contains(b, []byte(c.Marker)) {
+				return err
+			}
+		}
+		found = true
+		return filepath.SkipAll
+	})
+	return found, err
+}
+
+// requiresModule reports whether the nearest go.mod of the dir folder or its
+// parents requires the module path, with or without its major version suffix.
+func requiresModule(dir, path string) bool {
+	mr := findUp(dir, goModFile)
+	if mr == "" {
+		return false
+	}
+	f := filepath.Join(mr, goModFile)
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return false
+	}
+	mf, err := modfile.ParseLax(f, b, nil)
+	if err != nil {
+		return false
+	}
+	for _, r := range mf.Require {
+		if r.Mod.Path == path || majorVersionSuffix.ReplaceAllString(r.Mod.Path, "") == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package garchetype
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Strategies resolving the conflicts of a generation, i.e. the existing files
+// of the destination it would change.
+const (
+	// ConflictsTheirs writes the generated files over the existing ones.
+	ConflictsTheirs = "theirs"
+	// ConflictsOurs keeps the existing files as they are.
+	ConflictsOurs = "ours"
+	// ConflictsManual writes the files with conflict markers around the lines
+	// the existing and generated ones differ in, to be resolved by hand.
+	ConflictsManual = "manual"
+	// ConflictsMergeTool runs the merge tool of the git config, merge.tool,
+	// with the existing and generated files.
+	ConflictsMergeTool = "mergetool"
+)
+
+// conflictStrategies are the valid strategies, in the order they're offered.
+var conflictStrategies = []string{ConflictsTheirs, ConflictsOurs, ConflictsManual, ConflictsMergeTool}
+
+// Conflict markers of ConflictsManual.
+const (
+	markerCurrent   = "<<<<<<< current\n"
+	markerSeparator = "=======\n"
+	markerGenerated = ">>>>>>> generated\n"
+)
+
+// mergeTools are the command lines of the merge tools git knows without a
+// mergetool.<tool>.cmd config.
+var mergeTools = map[string]string{
+	"meld":     `meld "$LOCAL" "$MERGED" "$REMOTE"`,
+	"vimdiff":  `vimdiff "$LOCAL" "$MERGED" "$REMOTE"`,
+	"nvimdiff": `nvim -d "$LOCAL" "$MERGED" "$REMOTE"`,
+	"kdiff3":   `kdiff3 "$BASE" "$LOCAL" "$REMOTE" -o "$MERGED"`,
+	"vscode":   `code --wait --merge "$LOCAL" "$REMOTE" "$BASE" "$MERGED"`,
+	"opendiff": `opendiff "$LOCAL" "$REMOTE" -merge "$MERGED"`,
+	"bc":       `bcompare "$LOCAL" "$REMOTE" "$BASE" -mergeoutput="$MERGED"`,
+}
+
+// checkConflicts returns an error if strategy isn't a valid one.
+func checkConflicts(strategy string) error {
+	if strategy == "" || slices.Contains(conflictStrategies, strategy) {
+		return nil
+	}
+	return WithHint(fmt.Errorf("unknown conflicts strategy %q", strategy), "conflicts",
+		"Use one of %s", strings.Join(conflictStrategies, ", "))
+}
+
+// resolveConflicts rewrites the generated files of the entries that modify an
+// existing file of destination, as the plan tells, following the strategy of
+// each, the one the conflict hook picks or the default one.
+func resolveConflicts(entries []outputEntry, plan []FileDiff, destination, strategy string, conflict func(path string) (string, error)) error {
+	modified := make(map[string]bool)
+	for _, fd := range plan {
+		if fd.Change == FileModified {
+			modified[fd.Path] = true
+		}
+	}
+	for _, e := range entries {
+		rel := filepath.ToSlash(e.rel)
+		if !modified[rel] || !e.d.Type().IsRegular() {
+			continue
+		}
+		dst := filepath.Join(destination, e.rel)
+		if fi, err := os.Lstat(dst); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		s := cmp.Or(strategy, ConflictsTheirs)
+		if conflict != nil {
+			var err error
+			if s, err = conflict(rel); err != nil {
+				return err
+			}
+		}
+		if err := resolveConflict(e.path, dst, s); err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// resolveConflict rewrites the generated file of the existing dst one
+// following the strategy.
+func resolveConflict(generated, dst, strategy string) error {
+	current, err := os.ReadFile(dst)
+	if err != nil {
+		return err
+	}
+	theirs, err := os.ReadFile(generated)
+	if err != nil {
+		return err
+	}
+	switch strategy {
+	case ConflictsTheirs:
+		return nil
+	case ConflictsOurs:
+		return os.WriteFile(generated, current, 0o644) //nolint:mnd,gosec // The mode of the generated file is kept.
+	case ConflictsManual:
+		return os.WriteFile(generated, conflictMarkers(current, theirs), 0o644) //nolint:mnd,gosec // Idem.
+	case ConflictsMergeTool:
+		return runMergeTool(current, generated, conflictMarkers(current, theirs))
+	default:
+		return checkConflicts(strategy)
+	}
+}
+
+// conflictMarkers returns the contents of a file with the conflict markers
+// around the lines the current and generated ones differ in.
+func conflictMarkers(current, generated []byte) []byte {
+	a, b := markerLines(current), markerLines(generated)
+	var buf bytes.Buffer
+	writeLines := func(ls []string) {
+		for _, l := range ls {
+			buf.WriteString(l)
+		}
+		if n := len(ls); n > 0 && !strings.HasSuffix(ls[n-1], "\n") {
+			buf.WriteString("\n")
+		}
+	}
+	for _, op := range difflib.NewMatcher(a, b).GetOpCodes() {
+		if op.Tag == 'e' {
+			for _, l := range a[op.I1:op.I2] {
+				buf.WriteString(l)
+			}
+			continue
+		}
+		buf.WriteString(markerCurrent)
+		writeLines(a[op.I1:op.I2])
+		buf.WriteString(markerSeparator)
+		writeLines(b[op.J1:op.J2])
+		buf.WriteString(markerGenerated)
+	}
+	return buf.Bytes()
+}
+
+// markerLines splits b after its line breaks, for conflictMarkers.
+func markerLines(b []byte) []string {
+	ls := strings.SplitAfter(string(b), "\n")
+	if ls[len(ls)-1] == "" {
+		ls = ls[:len(ls)-1]
+	}
+	return ls
+}
+
+// runMergeTool runs the merge tool of the git config with the current file as
+// LOCAL and the generated one as REMOTE, and writes the result, MERGED,
+// starting with the conflict markers, into the generated file.
+// There's no BASE, the archetype version the file was generated from isn't
+// kept, so it's empty.
+func runMergeTool(current []byte, generated string, markers []byte) error {
+	tool := gitConfig("merge.tool")
+	if tool == "" {
+		return WithHint(errors.New("no merge tool configured"), "conflicts",
+			"Configure one with 'git config --global merge.tool meld', or pass another conflicts strategy")
+	}
+	cmd := gitConfig("mergetool." + tool + ".cmd")
+	if cmd == "" {
+		if cmd = mergeTools[tool]; cmd == "" {
+			return WithHint(fmt.Errorf("unknown merge tool %q", tool), "conflicts",
+				"Configure its command line with 'git config --global mergetool.%s.cmd'", tool)
+		}
+	}
+	work, err := os.MkdirTemp("", toolName+"-merge-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	name := filepath.Base(generated)
+	files := map[string][]byte{"LOCAL": current, "BASE": nil, "MERGED": markers}
+	env := os.Environ()
+	for k, b := range files {
+		f := filepath.Join(work, strings.ToLower(k)+"-"+name)
+		if err := os.WriteFile(f, b, 0o600); err != nil { //nolint:mnd // Private.
+			return err
+		}
+		env = append(env, k+"="+f)
+	}
+	merged := filepath.Join(work, "merged-"+name)
+	c := exec.CommandContext(context.Background(), "sh", "-c", cmd)
+	c.Env = append(env, "REMOTE="+generated)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("merge tool %s: %w", tool, err)
+	}
+	b, err := os.ReadFile(merged)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(generated, b, 0o644) //nolint:mnd,gosec // The mode of the generated file is kept.
+}
@@ -0,0 +1,54 @@
+package garchetype
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// Input describes an input of a transformation.
+type Input struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	// Type is text, int, yesno or select, with the Options to select from.
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"`
+	Default string   `json:"default,omitempty"`
+	// Pattern is a regular expression the value must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Secret is set for the inputs to ask for without echo.
+	Secret bool `json:"secret,omitempty"`
+	// Builtin is set for the inputs garchetype answers on its own, e.g. the
+	// feature name or the module path.
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+// Inputs describes the inputs of the Transformation of the Archetype.
+func Inputs(_ context.Context, opts Options) ([]Input, error) {
+	o := opts.withDefaults()
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return nil, err
+	}
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := readProjectConfig(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	tf, err := getTransformationFile(md.transformation(pc.transformation(o.Transformation)))
+	if err != nil {
+		return nil, err
+	}
+	spec, err := readTransformationSpec(filepath.Join(ad, tf))
+	if err != nil {
+		return nil, err
+	}
+	fid := featureInputID(md, spec)
+	ins := make([]Input, 0, len(spec.Inputs))
+	for _, in := range spec.Inputs {
+		ins = append(ins, in.public(in.ID == fid || in.ID == goModNameID || in.ID == modulePathID))
+	}
+	return ins, nil
+}
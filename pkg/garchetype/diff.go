@@ -0,0 +1,235 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffOptions are the settings of Diff.
+type DiffOptions struct {
+	// From and To are the git revisions of the source to compare, e.g. tags.
+	// To is HEAD by default.
+	From string
+	To   string
+}
+
+// File change kinds of a FileDiff.
+const (
+	FileAdded    = "added"
+	FileRemoved  = "removed"
+	FileModified = "modified"
+)
+
+// FileDiff is a generated file that changed between two archetype versions.
+type FileDiff struct {
+	// Path is relative to the destination.
+	Path string
+	// Change is FileAdded, FileRemoved or FileModified.
+	Change string
+	// Patch is the unified diff of the file.
+	Patch string
+}
+
+// Diff renders the Archetype of the source at two revisions with the same
+// inputs, and returns the generated files that changed between them, so the
+// impact of an archetype upgrade can be assessed before running it.
+func Diff(ctx context.Context, opts Options, do DiffOptions) ([]FileDiff, error) {
+	o := opts.withDefaults()
+	o.Hooks.Progress, o.Hooks.Confirm = nil, nil
+	// The hooks would run in the working folder, not in the render one, and
+	// the revisions of the archetype aren't reviewed.
+	o.NoHooks = true
+	if do.From == "" {
+		return nil, WithHint(errors.New("revision to diff from is required"), "publishing",
+			"Pass %s with a tag or commit of the source", optFrom)
+	}
+	do.To = cmp.Or(do.To, "HEAD")
+	r, err := git.PlainOpenWithOptions(o.SourceDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %w", o.SourceDir, err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return nil, err
+	}
+	if ad, err = filepath.Abs(ad); err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(wt.Filesystem.Root(), ad)
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.ToSlash(rel)
+	pc, err := readProjectConfig(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	gs, err := o.projectStatus(ctx, o.projectDir())
+	if err != nil {
+		gs = nil
+	}
+	base := builtinVars(o, gs) // The same for both, e.g. uuid.
+	// Both are rendered as if they were added to the destination.
+	dest, err := filepath.Abs(o.moduleDir())
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(base, systemVars(ad, dest))
+	work, err := os.MkdirTemp("", toolName+"-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+	var outputs [2]map[string][]byte
+	for i, rev := range []string{do.From, do.To} {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vd := filepath.Join(work, fmt.Sprintf("archetype-%d", i))
+		if err := checkoutArchetype(r, rev, prefix, vd); err != nil {
+			return nil, err
+		}
+		if outputs[i], err = o.renderVersion(vd, filepath.Join(work, fmt.Sprintf("output-%d", i)), base, pc); err != nil {
+			return nil, fmt.Errorf("%s at %s: %w", o.Archetype, rev, err)
+		}
+	}
+	return diffOutputs(outputs[0], outputs[1], do.From, do.To)
+}
+
+// checkoutArchetype writes into dir the files of the folder prefix of the
+// source repository r at the revision rev.
+func checkoutArchetype(r *git.Repository, rev, prefix, dir string) error {
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return WithHint(fmt.Errorf("unknown revision %q of the source: %w", rev, err), "publishing",
+			"Fetch the tags of the source first, e.g. 'git fetch --tags --unshallow'")
+	}
+	c, err := r.CommitObject(*h)
+	if err != nil {
+		return err
+	}
+	t, err := c.Tree()
+	if err != nil {
+		return err
+	}
+	if t, err = t.Tree(prefix); err != nil {
+		return fmt.Errorf("archetype folder %s not found at %s: %w", prefix, rev, err)
+	}
+	return t.Files().ForEach(func(f *object.File) error {
+		contents, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(f.Name))
+		switch f.Mode {
+		case filemode.Symlink:
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil { //nolint:mnd // Standard permissions.
+				return err
+			}
+			return os.Symlink(contents, dst)
+		case filemode.Executable:
+			return writeFile(dst, []byte(contents), 0o755) //nolint:mnd // Standard permissions.
+		default:
+			return writeFile(dst, []byte(contents), 0o644) //nolint:mnd // Standard permissions.
+		}
+	})
+}
+
+// renderVersion renders the archetype checked out in ad into dest and returns
+// the generated files by path.
+func (o *Options) renderVersion(ad, dest string, base map[string]string, pc *projectConfig) (map[string][]byte, error) {
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := getTransformationFile(md.transformation(pc.transformation(o.Transformation)))
+	if err != nil {
+		return nil, err
+	}
+	res, err := o.render(ad, filepath.Join(ad, tf), dest, md, base, pc)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(res.Files))
+	for _, f := range res.Files {
+		b, err := readOutput(filepath.Join(dest, f))
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.ToSlash(f)] = b
+	}
+	return files, nil
+}
+
+// diffOutputs returns the changes from the files a to the files b, sorted by
+// path.
+func diffOutputs(a, b map[string][]byte, from, to string) ([]FileDiff, error) {
+	paths := slices.Sorted(maps.Keys(a))
+	for p := range b {
+		if _, ok := a[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+	var diffs []FileDiff
+	for _, p := range paths {
+		ab, inA := a[p]
+		bb, inB := b[p]
+		fd := FileDiff{Path: p, Change: FileModified}
+		switch {
+		case !inA:
+			fd.Change = FileAdded
+		case !inB:
+			fd.Change = FileRemoved
+		case string(ab) == string(bb):
+			continue
+		}
+		if isBinary(p, ab) || isBinary(p, bb) {
+			fd.Patch = fmt.Sprintf("Binary file %s %s\n", p, fd.Change)
+			diffs = append(diffs, fd)
+			continue
+		}
+		patch, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(ab),
+			B:        splitLines(bb),
+			FromFile: fmt.Sprintf("a/%s (%s)", p, from),
+			ToFile:   fmt.Sprintf("b/%s (%s)", p, to),
+			Context:  3, //nolint:mnd // The git default.
+		})
+		if err != nil {
+			return nil, err
+		}
+		fd.Patch = patch
+		diffs = append(diffs, fd)
+	}
+	return diffs, nil
+}
+
+// splitLines splits the contents b into lines for the diff, each one ending
+// with a newline.
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if last := lines[len(lines)-1]; last == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] = last + "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
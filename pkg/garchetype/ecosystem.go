@@ -0,0 +1,97 @@
+package garchetype
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+const defaultEcosystem = "go"
+
+// ecosystem describes the conventions of a target language.
+type ecosystem struct {
+	// Sentinel is the file that must exist in the project folder.
+	Sentinel string
+	// Formatter is the command run with the generated files of the Exts
+	// extensions appended, it's skipped if it's not installed.
+	Formatter []string
+	Exts      []string
+}
+
+var ecosystems = map[string]ecosystem{
+	"go": {
+		Sentinel:  goModFile,
+		Formatter: []string{"gofmt", "-w"},
+		Exts:      []string{".go"},
+	},
+	"node": {
+		Sentinel:  "package.json",
+		Formatter: []string{"prettier", "--write", "--log-level", "warn"},
+		Exts:      []string{".js", ".jsx", ".ts", ".tsx", ".json", ".css"},
+	},
+	"python": {
+		Sentinel:  "pyproject.toml",
+		Formatter: []string{"black", "--quiet"},
+		Exts:      []string{".py"},
+	},
+	"rust": {
+		Sentinel:  "Cargo.toml",
+		Formatter: []string{"rustfmt"},
+		Exts:      []string{".rs"},
+	},
+	"generic": {},
+}
+
+// getEcosystem returns the ecosystem named name, go by default.
+func getEcosystem(name string) (ecosystem, error) {
+	if name == "" {
+		name = defaultEcosystem
+	}
+	e, ok := ecosystems[name]
+	if !ok {
+		return ecosystem{}, fmt.Errorf("unknown ecosystem: %s", name)
+	}
+	return e, nil
+}
+
+// format runs the ecosystem formatter on the files in dir it applies to, and
+// returns its output. The formatted files get the eol line endings back, if
+// set.
+func (e ecosystem) format(dir string, files []string, eol string) (string, error) {
+	if len(e.Formatter) == 0 {
+		return "", nil
+	}
+	if _, err := exec.LookPath(e.Formatter[0]); err != nil {
+		return "", nil //nolint:nilerr // The formatter is optional.
+	}
+	var fs []string
+	for _, f := range files {
+		if slices.Contains(e.Exts, filepath.Ext(f)) {
+			fs = append(fs, f)
+		}
+	}
+	if len(fs) == 0 {
+		return "", nil
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(e.Formatter[0], append(e.Formatter[1:], fs...)...) //nolint:gosec // Known formatters only.
+	cmd.Dir = dir
+	cmd.Stdout = io.MultiWriter(os.Stderr, &out)
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("formatting generated files: %w", err)
+	}
+	if eol == "" {
+		return out.String(), nil
+	}
+	for _, f := range fs {
+		if err := convertLineEndings(filepath.Join(dir, f), eol, pathAttributes{}); err != nil {
+			return out.String(), err
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,198 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// minVariantLen is the length of the shortest feature name variant substituted
+// by Export, the shorter ones would match too much code.
+const minVariantLen = 3
+
+// exportSpec is the transformation file written by Export.
+type exportSpec struct {
+	Ignore          []string          `yaml:"ignore"`
+	Inputs          []exportInput     `yaml:"inputs"`
+	Transformations []exportTransform `yaml:"transformations,omitempty"`
+}
+
+type exportInput struct {
+	ID   string `yaml:"id"`
+	Text string `yaml:"text"`
+	Type string `yaml:"type"`
+}
+
+type exportTransform struct {
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"`
+	Pattern     string   `yaml:"pattern"`
+	Replacement string   `yaml:"replacement"`
+	Files       []string `yaml:"files"`
+}
+
+// exportMetadata is the archetype metadata written by Export.
+type exportMetadata struct {
+	Description string `yaml:"description"`
+	Destination string `yaml:"destination,omitempty"`
+}
+
+// variant is a case variant of the feature name and its template placeholder.
+type variant struct {
+	value, id string
+}
+
+// Export copies the working feature in the from folder into a new Archetype of
+// the source, substituting the case variants of FeatureName, by default the
+// from folder name, back into template placeholders. The files using them
+// become templates, and the paths using them are renamed by the default
+// transformation. Force overwrites an existing archetype.
+func Export(_ context.Context, opts Options, from string) (*Report, error) {
+	o := opts.withDefaults()
+	if o.Archetype == "" {
+		return nil, errors.New("archetype is required")
+	}
+	fi, err := os.Stat(from)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("invalid feature folder: %s", from)
+	}
+	ads, err := archetypesFolders(o.SourceDir, o.ArchetypesFolder)
+	if err != nil {
+		return nil, err
+	}
+	ad := filepath.Join(ads[0], filepath.FromSlash(o.Archetype)) // The first folder of the search path.
+	if _, err := os.Stat(ad); err == nil && !o.Force {
+		return nil, WithHint(fmt.Errorf("archetype %q already exists", o.Archetype), "publishing",
+			"Pass another %s name, or %s to overwrite it", optArchetype, optForce)
+	}
+	name := cmp.Or(opts.FeatureName, filepath.Base(filepath.Clean(from)))
+	variants := featureVariants(name)
+	text := variantReplacer(variants, true)
+	names := variantReplacer(variants, false)
+	r := &Report{Feature: name, Archetype: o.Archetype, Destination: ad}
+	renames := make(map[string]string)
+	err = filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			if strings.Contains(rel, v.value) {
+				renames[v.value] = v.id
+			}
+		}
+		dst := filepath.Join(ad, rel)
+		if d.Type()&fs.ModeSymlink != 0 {
+			r.Files = append(r.Files, rel)
+			return copyEntry(path, dst, d)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if t := text.Replace(string(b)); !isBinary(rel, b) && names.Replace(string(b)) != string(b) {
+			b, dst, rel = []byte(t), dst+templateExt, rel+templateExt
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		r.Files = append(r.Files, rel)
+		return writeFile(dst, b, fi.Mode().Perm())
+	})
+	if err != nil {
+		return nil, err
+	}
+	spec := exportSpec{
+		Ignore: []string{transformationPrefix + "*." + transformationExt},
+		Inputs: []exportInput{{ID: featureNameID, Text: "Feature name", Type: "text"}},
+	}
+	for _, v := range variants {
+		if id, ok := renames[v.value]; ok {
+			spec.Transformations = append(spec.Transformations, exportTransform{
+				Name:        "feature path " + v.value,
+				Type:        "rename",
+				Pattern:     v.value,
+				Replacement: "{{ ." + id + " }}",
+				Files:       []string{"**"},
+			})
+		}
+	}
+	md := exportMetadata{Description: fmt.Sprintf("Exported from %s.", filepath.ToSlash(from))}
+	if rel, err := filepath.Rel(".", from); err == nil && filepath.IsLocal(rel) {
+		md.Destination = filepath.ToSlash(text.Replace(rel))
+	}
+	tf, err := getTransformationFile(DefaultTransformation)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeYAML(filepath.Join(ad, tf), spec); err != nil {
+		return nil, err
+	}
+	if err := writeYAML(filepath.Join(ad, archetypeMetadataFile), md); err != nil {
+		return nil, err
+	}
+	r.Transformation, r.TransformationFile = DefaultTransformation, filepath.Join(ad, tf)
+	return r, nil
+}
+
+// featureVariants returns the case variants of the feature name, the longest
+// first so they are substituted before the ones they contain.
+func featureVariants(name string) []variant {
+	vars := map[string]string{}
+	addCaseVariants(vars, featureNameID, name)
+	var vs []variant
+	// The plain name wins over the variants with the same value.
+	for _, suffix := range []string{"", "_snake", "_kebab", "_camel", "_pascal"} {
+		id := featureNameID + suffix
+		v, ok := vars[id]
+		if !ok || len(v) < minVariantLen || slices.ContainsFunc(vs, func(w variant) bool { return w.value == v }) {
+			continue
+		}
+		vs = append(vs, variant{value: v, id: id})
+	}
+	slices.SortStableFunc(vs, func(a, b variant) int { return len(b.value) - len(a.value) })
+	return vs
+}
+
+// variantReplacer returns the replacer of the variants by their placeholders.
+// For templates it also escapes the existing template delimiters.
+func variantReplacer(vs []variant, template bool) *strings.Replacer {
+	var oldnew []string
+	for _, v := range vs {
+		oldnew = append(oldnew, v.value, "{{ ."+v.id+" }}")
+	}
+	if template {
+		oldnew = append(oldnew, "{{", `{{ "{{" }}`, "}}", `{{ "}}" }}`)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// writeYAML writes v into the YAML file name.
+func writeYAML(name string, v any) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(name, b, 0o644) //nolint:mnd // Standard permissions.
+}
@@ -0,0 +1,106 @@
+package garchetype
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// featuresFile is the feature registry, relative to the project folder. It's
+// meant to be committed along with the generated files.
+const featuresFile = ".garchetype/features.yaml"
+
+// featureRegistry records the features applied to the project.
+type featureRegistry struct {
+	Features []Feature `yaml:"features"`
+}
+
+// Feature is a feature applied to the project, as recorded in its registry.
+type Feature struct {
+	Name           string `json:"name" yaml:"name"`
+	Archetype      string `json:"archetype" yaml:"archetype"`
+	Transformation string `json:"transformation" yaml:"transformation"`
+	// Version is the archetype metadata version, or the one resolved from
+	// the Constraint, if any.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Constraint is the semver range the archetype version was picked with,
+	// e.g. ^1.2, if any.
+	Constraint string `json:"constraint,omitempty" yaml:"constraint,omitempty"`
+	Source     string `json:"source" yaml:"source"`
+	Commit     string `json:"commit,omitempty" yaml:"commit,omitempty"` // archetype source commit
+	// Destination is the module folder relative to the project folder, empty
+	// for the project folder itself.
+	Destination string    `json:"destination,omitempty" yaml:"destination,omitempty"`
+	Applied     time.Time `json:"applied" yaml:"applied"`
+	// Files are the generated files, relative to the Destination.
+	Files []string `json:"files" yaml:"files"`
+	// Created are the Files the generation created, the others existed
+	// already, e.g. a routes file. Only these are changed by rename.
+	Created []string `json:"created,omitempty" yaml:"created,omitempty"`
+	// Inputs are the input values of the generation, the secret ones masked,
+	// for Reapply.
+	Inputs map[string]string `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+}
+
+// Features returns the features applied to the project in dir, in the order
+// they were applied, none if it has no feature registry.
+func Features(dir string) ([]Feature, error) {
+	fr, err := readFeatureRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	return fr.Features, nil
+}
+
+// readFeatureRegistry reads the feature registry of the project in dir. A
+// missing file yields an empty registry.
+func readFeatureRegistry(dir string) (*featureRegistry, error) {
+	fr := &featureRegistry{}
+	f := filepath.Join(dir, featuresFile)
+	b, err := os.ReadFile(f)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fr, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, fr); err != nil {
+		return nil, fmt.Errorf("invalid feature registry %s: %w", f, err)
+	}
+	return fr, nil
+}
+
+// write stores the feature registry of the project in dir.
+func (fr *featureRegistry) write(dir string) error {
+	return writeYAML(filepath.Join(dir, featuresFile), fr)
+}
+
+// applied reports whether a feature of the archetype was applied.
+func (fr *featureRegistry) applied(archetype string) bool {
+	return slices.ContainsFunc(fr.Features, func(r Feature) bool {
+		return r.Archetype == archetype
+	})
+}
+
+// has reports whether the feature name was applied with the archetype into
+// the destination module folder.
+func (fr *featureRegistry) has(name, archetype, destination string) bool {
+	return slices.ContainsFunc(fr.Features, func(r Feature) bool {
+		return r.Name == name && r.Archetype == archetype && r.Destination == destination
+	})
+}
+
+// record adds the feature r to the registry of the project in dir.
+func record(dir string, r Feature) error {
+	fr, err := readFeatureRegistry(dir)
+	if err != nil {
+		return err
+	}
+	fr.Features = append(fr.Features, r)
+	return fr.write(dir)
+}
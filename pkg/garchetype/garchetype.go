@@ -0,0 +1,346 @@
+// Package garchetype scaffolds features into a project using archetypes, it's
+// the library behind the garchetype CLI, so other tools can embed it instead
+// of shelling out to the binary.
+package garchetype
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/diegosz/go-archetype/log"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+// toolName names the temporary folders and the commands in the hints.
+const toolName = "garchetype"
+
+// Defaults of the options.
+const (
+	DefaultArchetypesFolder = "archetypes"
+	DefaultTransformation   = "default"
+)
+
+const (
+	transformationPrefix = "transformations-"
+	transformationExt    = "yaml"
+	featureNameID        = "feature_name"
+	goModNameID          = "gomod_name"
+)
+
+// ErrAborted is returned when the Confirm hook declines the generation.
+var ErrAborted = errors.New("generation aborted")
+
+// Options are the settings of the operations. The paths are relative to the
+// current folder, but the Module one.
+type Options struct {
+	// Dir is the project folder the features are added to, the current
+	// folder by default.
+	Dir string
+	// SourceDir is the archetypes source folder. If it doesn't exist and
+	// SourceRepo is set, the repository is cloned into it, otherwise an
+	// existing clone is synced with its remote.
+	SourceDir  string
+	SourceRepo string
+	// SourceRelease is the org/repo@tag GitHub release whose archetype
+	// packages are the source, downloaded into SourceDir, by default a
+	// folder of the user cache.
+	SourceRelease string
+	// SourceAuth authenticates the clones and pulls of SourceRepo.
+	SourceAuth SourceAuth
+	// CacheMaxSize bounds the size in bytes of the source folders cloned or
+	// downloaded, see PruneCache. Before cloning or downloading another
+	// one, the least recently used ones are evicted to fit in it. Unbounded
+	// by default.
+	CacheMaxSize int64
+	// ArchetypesFolder is the folder of the archetypes within the source,
+	// DefaultArchetypesFolder by default. It may be a search path of several
+	// folders, separated by os.PathListSeparator, where the archetypes are
+	// looked up in order.
+	ArchetypesFolder string
+	Archetype        string
+	// Transformation is the name of the archetype transformation file, the
+	// default one of the archetype metadata, or DefaultTransformation, by
+	// default.
+	Transformation string
+	// FeatureName is the name of the feature to add, the archetype name by
+	// default, its last element for the nested archetypes.
+	FeatureName string
+	// Module is the destination module folder in a go.work workspace,
+	// relative to Dir, the project folder by default.
+	Module string
+	// VarFile is a YAML file with the input values.
+	VarFile string
+	// Inputs are input values by id, taking precedence over the VarFile ones.
+	Inputs map[string]string
+	// Args are the generator input arguments, e.g. --salutation=Hi.
+	Args []string
+	// NoPrompt fails on the inputs without a value instead of asking for them,
+	// e.g. in a server.
+	NoPrompt bool
+	// Subpath is the destination folder within the module, by default the
+	// one declared by the archetype.
+	Subpath string
+	// Sentinel is the file that must exist in the destination folder, by
+	// default the one of the archetype ecosystem. NoSentinel skips the check.
+	Sentinel   string
+	NoSentinel bool
+	// AllSources lists the sources of the project config too.
+	AllSources bool
+	// MaxAge skips syncing the sources listed within it, none by default.
+	MaxAge time.Duration
+	// LockTimeout is how long to wait for another process syncing the same
+	// source folder, DefaultLockTimeout if zero. A negative one fails at once.
+	LockTimeout time.Duration
+	// Force allows adding on a dirty repository, or over an existing feature.
+	Force bool
+	// OutputDir, when set, is the folder Add writes the feature into instead
+	// of the project, e.g. to package it as an archive, reported as the
+	// Destination. The project is left untouched: it may be dirty, or not a
+	// repository, the prerequisites, the hooks and the conflicts strategies
+	// are skipped, and nothing is recorded.
+	OutputDir string
+	// ForceLarge generates from the archetypes over the limits of the
+	// project configuration.
+	ForceLarge bool
+	// NoGit skips the git checks and the git variables of the project, e.g.
+	// a new folder not under version control yet. The git source is still
+	// cloned and synced.
+	NoGit bool
+	// Conflicts is the strategy resolving the conflicts of the generation,
+	// the existing files it changes, ConflictsTheirs by default, i.e. the
+	// generated files are written over them. See Hooks.Conflict.
+	Conflicts string
+	// Only and Exclude select the generated files with globs.
+	Only    []string
+	Exclude []string
+	// Provenance prepends a comment to the generated source files telling
+	// the archetype, its version and the time they were generated.
+	Provenance bool
+	// LineEndings of the generated text files: LineEndingsLF,
+	// LineEndingsCRLF or LineEndingsAuto, by default the ones of the archetype
+	// metadata, or the rendered ones.
+	LineEndings string
+	// ToolVersion is the version of the program using the package, checked
+	// against the minimum version the archetypes require. The check is
+	// skipped without it.
+	ToolVersion string
+	// StrictDeprecations fails adding a deprecated archetype or
+	// transformation, instead of warning about it.
+	StrictDeprecations bool
+	// StrictVars fails the templates referencing a variable without a value,
+	// e.g. a typo or a missing input, instead of rendering an empty string.
+	StrictVars bool
+	// PluginsDir is the folder of the plugins providing template functions
+	// to the archetypes, by default the plugins folder of garchetype in the
+	// user config folder.
+	PluginsDir string
+	// NoHooks skips the shell commands of the before and after operations of
+	// the transformations, which the project config may otherwise restrict.
+	NoHooks bool
+	// NoFormat skips the ecosystem formatter on the generated files, e.g. in
+	// a server, as it runs a command found in the PATH, reading the config
+	// files of the generated tree.
+	NoFormat bool
+	// Logger gets the diagnostics, none by default.
+	Logger log.Logger
+	Hooks  Hooks
+	// requiredBy are the archetypes requiring this one, to detect cycles.
+	requiredBy []string
+	// target tells Add it's run by AddTargets, which checked the repository
+	// is clean, and the Module doesn't need to be a workspace member.
+	target bool
+	// synced tells Add the source was synced already, by AddTargets.
+	synced bool
+	// reapply tells Add it's run by Reapply, over the existing feature.
+	reapply bool
+	// recorded are the input values recorded for the feature by the
+	// registry, see Reapply, overridden by the VarFile and Inputs ones.
+	recorded map[string]string
+	// fresh requires the destination subpath not to exist yet, see
+	// generation.
+	fresh bool
+	// hooksDir is the folder the hooks run in, the Dir one by default,
+	// e.g. the sandbox of a golden case.
+	hooksDir string
+	// status memoizes the git statuses of the run, shared with the
+	// prerequisites and the targets.
+	status *gitstat.Cache
+}
+
+// Hooks let the caller follow an operation, e.g. to show its progress. All of
+// them are optional.
+type Hooks struct {
+	// Started is called once the archetype and its transformation file are
+	// resolved, before generating anything.
+	Started func(r *Report)
+	// Busy is called when a long task starts, e.g. cloning the source, and
+	// returns the function to call once it's done.
+	Busy func(task string) (done func())
+	// Progress is called as the generated files are written.
+	Progress func(done, total int)
+	// GitProgress gets the progress messages of the remote while cloning,
+	// pulling or fetching the source, e.g. "Receiving objects:  42% (21/50)".
+	GitProgress io.Writer
+	// Warn gets the problems that don't stop the operation.
+	Warn func(msg string)
+	// FeatureName is called to ask for another feature name when the given
+	// one is invalid, with the validation error and function. Without it the
+	// operation fails.
+	FeatureName func(err error, validate func(string) error) (string, error)
+	// Archetype is called to pick one of the archetypes of the source when
+	// none is given. Without it the archetype is required.
+	Archetype func(as []Archetype) (string, error)
+	// Transformation is called to pick one of the transformations of the
+	// archetype when none is given and it has several. Without it the
+	// default one of the archetype is used.
+	Transformation func(ts []Transformation) (string, error)
+	// Prerequisite is called when the archetype requires another one not
+	// applied to the project yet, to confirm applying it first. Without it
+	// the operation fails.
+	Prerequisite func(archetype, required string) (bool, error)
+	// Input is called to ask for the value of an input the arguments, the
+	// VarFile and the defaults don't answer, with its validation function.
+	// Without it go-archetype asks for it, and it's validated afterwards.
+	Input func(in Input, validate func(string) error) (string, error)
+	// Rendered is called by Watch after each render, with its error if it
+	// failed.
+	Rendered func(r *Report, err error)
+	// Template is called after rendering each template of a generation, with
+	// its variables and failure, e.g. to debug an archetype.
+	Template func(t RenderedTemplate)
+	// Trace gets the operations of a generation on the files, in order: the
+	// ones staged, rendered, transformed, skipped and why, and written.
+	Trace func(e TraceEvent)
+	// Conflict is called for each existing file a generation changes, its
+	// path relative to the destination, to pick the strategy resolving the
+	// conflict. Without it the Conflicts one is used.
+	Conflict func(path string) (string, error)
+	// Confirm is called with the plan of a generation, the files to be
+	// created or modified along with their diffs, before writing them.
+	// Declining it aborts the operation with ErrAborted.
+	Confirm func(plan []FileDiff) (bool, error)
+}
+
+// Report describes the outcome of an operation.
+type Report struct {
+	Feature            string `json:"feature"`
+	Archetype          string `json:"archetype"`
+	Transformation     string `json:"transformation"`
+	TransformationFile string `json:"transformationFile"`
+	// Version is the archetype version resolved from the constraint of the
+	// archetype, e.g. grpc-service@^1.2, and Tag its tag in the source.
+	Version string `json:"version,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	// Destination is the absolute path of the destination module folder.
+	Destination string `json:"destination"`
+	// Files are the generated files, relative to Destination.
+	Files   []string `json:"files"`
+	Summary Summary  `json:"summary"`
+	// Subpath is the folder within Destination the feature landed in, if
+	// the archetype has a destination folder.
+	Subpath string `json:"subpath,omitempty"`
+	// Primary are the Files the archetype marks as the ones to start working
+	// on.
+	Primary []string `json:"primary,omitempty"`
+}
+
+// Summary counts the changes of a generation.
+type Summary struct {
+	Created   int `json:"created" yaml:"created"`
+	Modified  int `json:"modified" yaml:"modified"`
+	Unchanged int `json:"unchanged" yaml:"unchanged"`
+	// Skipped are the files left out by Only and Exclude.
+	Skipped      int `json:"skipped" yaml:"skipped"`
+	LinesAdded   int `json:"linesAdded" yaml:"linesAdded"`
+	LinesRemoved int `json:"linesRemoved" yaml:"linesRemoved"`
+}
+
+// Archetype describes an archetype of the source.
+type Archetype struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description,omitempty"`
+	Version     string `json:"version" yaml:"version,omitempty"`
+	// Source is the folder of the source the archetype belongs to, or its
+	// repository for the remote listings.
+	Source string `json:"source" yaml:"-"`
+	// Deprecated is the replacement hint of a deprecated archetype.
+	Deprecated string `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	// Folder is the archetypes folder of the source the archetype was found
+	// in, see Options.ArchetypesFolder.
+	Folder          string           `json:"folder" yaml:"folder,omitempty"`
+	Transformations []Transformation `json:"transformations" yaml:"transformations"`
+}
+
+// Transformation describes a transformation of an archetype.
+type Transformation struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description,omitempty"`
+	// Default is set for the transformation used when none is given.
+	Default bool `json:"default,omitempty" yaml:"default,omitempty"`
+	// Aliases are the short names of the transformation.
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	// Deprecated is the replacement hint of a deprecated transformation.
+	Deprecated string `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+}
+
+// Source is an archetypes source, the folder and the repository cloned into it
+// if it doesn't exist.
+type Source struct {
+	Dir  string `yaml:"dir"`
+	Repo string `yaml:"repo"`
+	// Release is the org/repo@tag GitHub release downloaded into the folder,
+	// see Options.SourceRelease.
+	Release string `yaml:"release"`
+	// Auth authenticates the clones and pulls of the repository.
+	Auth SourceAuth `yaml:"auth"`
+}
+
+// withDefaults returns a copy of the options with the defaults set.
+func (o Options) withDefaults() *Options {
+	o.ArchetypesFolder = cmp.Or(o.ArchetypesFolder, DefaultArchetypesFolder)
+	o.FeatureName = cmp.Or(o.FeatureName, archetypeBaseName(o.Archetype))
+	if o.SourceRelease != "" && o.SourceDir == "" {
+		o.SourceDir = releaseDir(o.SourceRelease)
+	}
+	if o.Logger == nil {
+		o.Logger = log.NopLogger{}
+	}
+	if o.PluginsDir == "" {
+		o.PluginsDir = defaultPluginsDir()
+	}
+	plugins.load(o.PluginsDir, o.Hooks.warn)
+	if o.status == nil {
+		o.status = &gitstat.Cache{}
+	}
+	return &o
+}
+
+// projectDir returns the project folder.
+func (o *Options) projectDir() string {
+	return cmp.Or(o.Dir, ".")
+}
+
+// moduleDir returns the folder of the destination module.
+func (o *Options) moduleDir() string {
+	if filepath.IsAbs(o.Module) {
+		return o.Module
+	}
+	return filepath.Join(o.projectDir(), o.Module)
+}
+
+func (h Hooks) busy(task string) (done func()) {
+	if h.Busy == nil {
+		return func() {}
+	}
+	return h.Busy(task)
+}
+
+func (h Hooks) warn(msg string) {
+	if h.Warn != nil {
+		h.Warn(msg)
+	}
+}
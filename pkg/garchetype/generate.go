@@ -0,0 +1,519 @@
+package garchetype
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/diegosz/go-archetype/inputs"
+	"github.com/diegosz/go-archetype/log"
+	"github.com/diegosz/go-archetype/transformer"
+)
+
+// templateExt is the extension of the archetype files that are rendered with
+// the Go template engine before the transformations are applied. The extension
+// is dropped from the generated file name.
+const templateExt = ".tmpl"
+
+// generation describes an archetype generation.
+type generation struct {
+	TransformationFile string
+	Source             string // archetype folder
+	Destination        string
+	// Subpath is the folder within the destination the archetype lands in, it
+	// may use template actions, e.g. internal/{{ .feature_name }}.
+	Subpath string
+	Args    []string          // input arguments
+	Vars    map[string]string // extra variables
+	// Symlinks is the handling of the archetype symlinks, see
+	// archetypeMetadata.
+	Symlinks string
+	// Directories are created within the subpath even when empty, they may
+	// use template actions.
+	Directories []string
+	// Only and Exclude select the generated files by their path relative to
+	// the subpath.
+	Only    []string
+	Exclude []string
+	// Confirm, when set, is called with the plan before writing the files.
+	Confirm func(plan []FileDiff) (bool, error)
+	// Conflicts is the strategy resolving the existing files the generation
+	// changes, ConflictsTheirs by default, unless Conflict picks one per file.
+	Conflicts string
+	Conflict  func(path string) (string, error)
+	// Progress, when set, is called as the generated files are written.
+	Progress func(done, total int)
+	// Template, when set, is called after rendering each template.
+	Template func(t RenderedTemplate)
+	// Trace, when set, gets the operations on the files, in order.
+	Trace func(e TraceEvent)
+	// StrictVars fails the templates referencing a missing variable.
+	StrictVars bool
+	// Limits, when set, bounds the archetype files.
+	Limits *limitsConfig
+	// Inputs are the declared inputs, their values are validated once
+	// collected.
+	Inputs []inputSpec
+	// Fresh fails the generation if the Subpath folder already has files,
+	// which heuristically tells the feature was generated already.
+	Fresh bool
+	// Header, when set, is the provenance header prepended as a comment to
+	// the generated files of the known types.
+	Header string
+	// License, when set, is the license header prepended before it, but to
+	// the files matching the LicenseExclude globs.
+	License        string
+	LicenseExclude []string
+	// EOL, when set, is the line ending sequence of the generated text files.
+	EOL string
+	// Output, when set, is the folder the files are written to instead of
+	// the Destination, which is only read: the plan still diffs against it,
+	// and the hooks and the conflicts strategies are skipped.
+	Output string
+	// NoHooks skips the before and after hooks of the transformation,
+	// otherwise their commands must be allowed by HooksConfig.
+	NoHooks     bool
+	HooksConfig hooksConfig
+	// HooksDir is the folder the hooks run in, the working one if empty.
+	HooksDir string
+	// Wasm are the WASM modules transforming the generated files.
+	Wasm []wasmSpec
+	// Warn, when set, gets the warnings of the generation.
+	Warn   func(msg string)
+	Logger log.Logger
+}
+
+// generationResult describes the outcome of a generation.
+type generationResult struct {
+	// Files are the generated files, relative to the destination.
+	Files []string
+	// Created are the Files that didn't exist before.
+	Created []string
+	Summary Summary
+	// Subpath is the folder within the destination the files landed in.
+	Subpath string
+	// Inputs are the input values given, the secret ones masked.
+	Inputs map[string]string
+}
+
+// generate renders the archetype into the destination, overlaying any existing
+// files. It follows generator.OverlayGenerate, but garchetype owns the
+// variables and the template step, so archetype templates get the sprig
+// function library and the extra vars, which take precedence over the system
+// variables but not over the user inputs.
+//
+// The archetype is rendered into a work folder first and then applied to the
+// destination, so garchetype knows exactly which files are generated. That's
+// why the before and after operations are run here instead of by go-archetype.
+func generate(g *generation) (*generationResult, error) {
+	work, err := os.MkdirTemp("", toolName+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+	tf, before, after, err := splitOperations(g.TransformationFile, work)
+	if err != nil {
+		return nil, err
+	}
+	staged, logger := filepath.Join(work, "archetype"), g.Logger
+	if g.Trace != nil {
+		logger = traceLogger{Logger: g.Logger, dir: staged, trace: g.Trace}
+	}
+	ts, err := transformer.Read(tf, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := inputs.ParseCLIArgsInputs(ts, g.Args); err != nil {
+		return nil, err
+	}
+	if err := inputs.CollectUserInputs(ts); err != nil {
+		return nil, err
+	}
+	vars := systemVars(g.Source, g.Destination)
+	maps.Copy(vars, g.Vars)
+	if err := ts.Template(vars); err != nil { // Also adds the user inputs to vars.
+		return nil, err
+	}
+	if err := (&transformationSpec{Inputs: g.Inputs}).validateValues(vars); err != nil {
+		return nil, err
+	}
+	if n := len(before) + len(after); (g.NoHooks || g.Output != "") && n > 0 {
+		if g.Warn != nil {
+			g.Warn(fmt.Sprintf("Skipping the %d hooks of the transformation.", n))
+		}
+		before, after = nil, nil
+	}
+	for _, hs := range [][]hook{before, after} {
+		if err := templateHooks(hs, vars); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.HooksConfig.check(slices.Concat(before, after)); err != nil {
+		return nil, err
+	}
+	var sp string
+	if g.Subpath != "" {
+		b, err := renderTemplate("subpath", []byte(g.Subpath), vars, g.StrictVars)
+		if err != nil {
+			return nil, err
+		}
+		if sp = string(b); !filepath.IsLocal(sp) {
+			return nil, fmt.Errorf("invalid destination subpath: %s", sp)
+		}
+		if es, err := os.ReadDir(filepath.Join(g.Destination, sp)); g.Fresh && err == nil && len(es) > 0 {
+			return nil, WithHint(fmt.Errorf("the %s folder already exists, the feature seems generated already", filepath.ToSlash(sp)), "generated-files",
+				"Pick another feature name, or pass %s to generate it anyway", optForce)
+		}
+	}
+	if err := runHooks(before, g.HooksDir, g.Logger); err != nil {
+		return nil, err
+	}
+	ignore, err := readIgnoreFile(g.Source)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := readAttributesFile(g.Source)
+	if err != nil {
+		return nil, err
+	}
+	only, err := compilePatterns(g.Only)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(g.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	st := &staging{
+		Ignore:     ignore,
+		Attributes: attrs,
+		Dir:        staged,
+		Verbatim:   filepath.Join(work, "verbatim"),
+		Vars:       vars,
+		Symlinks:   g.Symlinks,
+		Trace:      g.Trace,
+		Strict:     g.StrictVars,
+		Limits:     g.Limits,
+		Modules:    wasmModules(g.Wasm),
+	}
+	if g.Template != nil {
+		dv := debugVars(vars, g.Inputs)
+		st.Rendered = func(rel string, err error) {
+			t := RenderedTemplate{File: filepath.ToSlash(rel), Vars: maps.Clone(dv)}
+			errors.As(err, &t.Err)
+			g.Template(t)
+		}
+	}
+	if err := st.stage(g.Source); err != nil {
+		return nil, err
+	}
+	out := filepath.Join(work, "output")
+	if err := transformer.Transform(st.Dir, out, *ts, logger); err != nil {
+		return nil, err
+	}
+	if err := passthrough(st.Verbatim, out, ts); err != nil {
+		return nil, err
+	}
+	if err := transformWasm(context.Background(), g.Wasm, g.Source, out, g.Trace); err != nil {
+		return nil, err
+	}
+	res := &generationResult{Subpath: filepath.ToSlash(sp)}
+	selected := func(rel string) bool {
+		ok := (len(only) == 0 || only.match(rel)) && !exclude.match(rel)
+		if !ok && g.Trace != nil {
+			g.Trace(TraceEvent{Op: TraceSkipped, Path: filepath.ToSlash(rel), Detail: "left out by the only and exclude globs"})
+		}
+		return ok
+	}
+	entries, skipped, err := outputEntries(out, sp, selected)
+	if err != nil {
+		return nil, err
+	}
+	licenseExclude, err := compilePatterns(g.LicenseExclude)
+	if err != nil {
+		return nil, err
+	}
+	if g.License != "" || g.Header != "" {
+		for _, e := range entries {
+			rel, err := filepath.Rel(out, e.path)
+			if err != nil {
+				return nil, err
+			}
+			license := g.License
+			if licenseExclude.match(rel) {
+				license = ""
+			}
+			if err := addHeaders(e.path, license, g.Header); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, e := range entries {
+		rel, err := filepath.Rel(out, e.path)
+		if err != nil {
+			return nil, err
+		}
+		if err := convertLineEndings(e.path, g.EOL, attrs.lookup(filepath.ToSlash(rel))); err != nil {
+			return nil, err
+		}
+	}
+	plan, err := planEntries(entries, g.Destination)
+	if err != nil {
+		return nil, err
+	}
+	res.Summary = summarize(plan, len(entries), skipped)
+	if g.Confirm != nil {
+		ok, err := g.Confirm(plan)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrAborted
+		}
+	}
+	if g.Output == "" && (cmp.Or(g.Conflicts, ConflictsTheirs) != ConflictsTheirs || g.Conflict != nil) {
+		if err := resolveConflicts(entries, plan, g.Destination, g.Conflicts, g.Conflict); err != nil {
+			return nil, err
+		}
+		if plan, err = planEntries(entries, g.Destination); err != nil {
+			return nil, err
+		}
+		res.Summary = summarize(plan, len(entries), skipped)
+	}
+	if res.Files, err = apply(entries, cmp.Or(g.Output, g.Destination), g.Progress); err != nil {
+		return nil, err
+	}
+	changes := make(map[string]string, len(plan))
+	for _, fd := range plan {
+		changes[fd.Path] = fd.Change
+	}
+	for _, f := range res.Files {
+		if changes[f] == FileAdded {
+			res.Created = append(res.Created, f)
+		}
+	}
+	if g.Trace != nil {
+		for _, f := range res.Files {
+			g.Trace(TraceEvent{Op: TraceWritten, Path: f, Detail: cmp.Or(changes[f], "unchanged")})
+		}
+	}
+	for _, d := range g.Directories {
+		b, err := renderTemplate("directory", []byte(d), vars, g.StrictVars)
+		if err != nil {
+			return nil, err
+		}
+		if d = string(b); !filepath.IsLocal(d) {
+			return nil, fmt.Errorf("invalid directory: %s", d)
+		}
+		if err := os.MkdirAll(filepath.Join(cmp.Or(g.Output, g.Destination), sp, d), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	if err := runHooks(after, g.HooksDir, g.Logger); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// outputEntry is a rendered file in path, to be written at rel within the
+// destination.
+type outputEntry struct {
+	path, rel string
+	d         fs.DirEntry
+}
+
+// outputEntries returns the selected rendered files in out, to be written into
+// the subpath of the destination, and the number of the skipped ones.
+func outputEntries(out, subpath string, selected func(string) bool) ([]outputEntry, int, error) {
+	var entries []outputEntry
+	var skipped int
+	err := filepath.WalkDir(out, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(out, path)
+		if err != nil {
+			return err
+		}
+		if selected(rel) {
+			entries = append(entries, outputEntry{path: path, rel: filepath.Join(subpath, rel), d: d})
+		} else {
+			skipped++
+		}
+		return nil
+	})
+	return entries, skipped, err
+}
+
+// planEntries returns the files the entries create or modify in destination,
+// with their diffs. The unchanged files are left out.
+func planEntries(entries []outputEntry, destination string) ([]FileDiff, error) {
+	current := make(map[string][]byte)
+	generated := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		rel := filepath.ToSlash(e.rel)
+		b, err := readOutput(e.path)
+		if err != nil {
+			return nil, err
+		}
+		generated[rel] = b
+		b, err = readOutput(filepath.Join(destination, e.rel))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		current[rel] = b
+	}
+	return diffOutputs(current, generated, "current", "generated")
+}
+
+// summarize counts the changes of the plan of a generation of total files,
+// besides the skipped ones.
+func summarize(plan []FileDiff, total, skipped int) Summary {
+	s := Summary{Unchanged: total - len(plan), Skipped: skipped}
+	for _, fd := range plan {
+		if fd.Change == FileAdded {
+			s.Created++
+		} else {
+			s.Modified++
+		}
+		for _, l := range strings.Split(fd.Patch, "\n") {
+			switch {
+			case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			case strings.HasPrefix(l, "+"):
+				s.LinesAdded++
+			case strings.HasPrefix(l, "-"):
+				s.LinesRemoved++
+			}
+		}
+	}
+	return s
+}
+
+// readOutput reads the file p, or describes its target if it's a symlink.
+func readOutput(p string) ([]byte, error) {
+	fi, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return os.ReadFile(p)
+	}
+	t, err := os.Readlink(p)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("-> " + t + "\n"), nil
+}
+
+// apply copies the entries into destination and returns their slash-separated
+// paths relative to destination, the same on every platform for the feature
+// registry. The files are copied in parallel, bounded by GOMAXPROCS, reporting
+// to the optional progress function.
+func apply(entries []outputEntry, destination string, progress func(done, total int)) ([]string, error) {
+	files := make([]string, len(entries))
+	for i, e := range entries {
+		files[i] = filepath.ToSlash(e.rel)
+	}
+	var done atomic.Int64
+	return files, parallel(entries, func(e outputEntry) error {
+		err := copyEntry(e.path, filepath.Join(destination, e.rel), e.d)
+		if progress != nil {
+			progress(int(done.Add(1)), len(entries))
+		}
+		return err
+	})
+}
+
+// copyEntry copies the file src to dst, recreating it if it's a symlink.
+func copyEntry(src, dst string, d fs.DirEntry) error {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return copyFile(src, dst)
+	}
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+// copyFile copies the regular file src to dst, creating the missing folders.
+func copyFile(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, b, fi.Mode().Perm())
+}
+
+// systemVars returns the environment variables along with the source and
+// destination variables, the same set go-archetype exposes to transformations.
+func systemVars(source, destination string) map[string]string {
+	vars := make(map[string]string)
+	for _, e := range os.Environ() {
+		k, v, _ := strings.Cut(e, "=")
+		vars[k] = v
+	}
+	vars["source"] = source
+	vars["destination"] = destination
+	vars["source_dirname"] = filepath.Base(source)
+	vars["destination_dirname"] = filepath.Base(destination)
+	return vars
+}
+
+// templateFuncs returns the functions available to archetype templates, the
+// sprig ones, the ones of the plugins and the project ones, see projectFuncs.
+func templateFuncs() template.FuncMap {
+	fm := sprig.TxtFuncMap()
+	maps.Copy(fm, plugins.templateFuncs())
+	maps.Copy(fm, projectFuncs(""))
+	return fm
+}
+
+// renderTemplate executes the template text named name with vars. Missing
+// variables render as empty strings, e.g. module_path outside Go projects,
+// unless strict, which fails on them. The project functions read the files of
+// the destination variable folder.
+func renderTemplate(name string, text []byte, vars map[string]string, strict bool) ([]byte, error) {
+	missingkey := "missingkey=zero"
+	if strict {
+		missingkey = "missingkey=error"
+	}
+	fm := templateFuncs()
+	maps.Copy(fm, projectFuncs(vars["destination"]))
+	t, err := template.New(name).Funcs(fm).Option(missingkey).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
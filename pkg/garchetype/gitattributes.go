@@ -0,0 +1,106 @@
+package garchetype
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// attributesFile is the name of the optional git attributes file in the
+// archetype folder, telling the text and binary files and their line endings.
+const attributesFile = ".gitattributes"
+
+// pathAttributes are the attributes of a file set by the attributes file.
+type pathAttributes struct {
+	// Text tells whether the file is text or binary, nil to tell it by its
+	// name and contents.
+	Text *bool
+	// EOL is the line endings of the file, LineEndingsLF or LineEndingsCRLF,
+	// empty if unset.
+	EOL string
+}
+
+// attributeRule is a line of the attributes file: the pattern and the
+// attributes it sets, or unsets.
+type attributeRule struct {
+	pattern pathPatterns
+	text    *bool // set, or unset with setText
+	setText bool
+	eol     string // set, or unset with setEOL
+	setEOL  bool
+}
+
+// gitattributes are the rules of the attributes file, in order. As in git, the
+// later rules take precedence over the earlier ones matching the same path.
+type gitattributes []attributeRule
+
+// readAttributesFile reads the attributes file in the archetype folder dir,
+// keeping the text, binary and eol attributes. A missing file yields no rules.
+func readAttributesFile(dir string) (gitattributes, error) {
+	b, err := os.ReadFile(filepath.Join(dir, attributesFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ga gitattributes
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) < 2 || strings.HasPrefix(fs[0], "#") {
+			continue
+		}
+		var r attributeRule
+		for _, a := range fs[1:] {
+			switch a {
+			case "text", "-text", "binary":
+				t := a == "text"
+				r.text, r.setText = &t, true
+			case "!text", "text=auto":
+				r.text, r.setText = nil, true
+			case "eol=" + LineEndingsLF, "eol=" + LineEndingsCRLF:
+				r.eol, r.setEOL = strings.TrimPrefix(a, "eol="), true
+			case "-eol", "!eol":
+				r.eol, r.setEOL = "", true
+			}
+		}
+		if !r.setText && !r.setEOL {
+			continue
+		}
+		if r.pattern, err = compilePatterns([]string{strings.TrimPrefix(fs[0], "/")}); err != nil {
+			return nil, WithHint(err, "templates", "Fix the pattern in %s", attributesFile)
+		}
+		ga = append(ga, r)
+	}
+	return ga, nil
+}
+
+// lookup returns the attributes of the file rel.
+func (ga gitattributes) lookup(rel string) pathAttributes {
+	var pa pathAttributes
+	for _, r := range ga {
+		if !r.pattern.match(rel) {
+			continue
+		}
+		if r.setText {
+			pa.Text = r.text
+		}
+		if r.setEOL {
+			pa.EOL = r.eol
+		}
+	}
+	return pa
+}
+
+// binary reports whether the file rel with contents b is a binary file, as
+// its text attribute tells, otherwise by its name and contents.
+func (ga gitattributes) binary(rel string, b []byte) bool {
+	if t := ga.lookup(rel).Text; t != nil {
+		return !*t
+	}
+	return isBinary(rel, b)
+}
@@ -0,0 +1,226 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// goldenFolder is the folder of the golden cases within the source, with
+	// a folder per archetype and a folder per case within it.
+	goldenFolder = "testdata"
+	// goldenCaseFile holds the settings of a golden case, it's optional.
+	goldenCaseFile = "case.yaml"
+	// goldenOutputFolder holds the expected output of a golden case.
+	goldenOutputFolder = "golden"
+)
+
+// goldenTime pins the time variables of the golden cases.
+var goldenTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// TestOptions are the settings of Test.
+type TestOptions struct {
+	// Update rewrites the golden output with the rendered one instead of
+	// comparing them.
+	Update bool
+}
+
+// TestCase is the outcome of a golden case.
+type TestCase struct {
+	Archetype string
+	Name      string
+	Duration  time.Duration
+	// Diffs are the differences of the rendered output from the golden one,
+	// sorted by path.
+	Diffs []FileDiff
+	// Err is the error rendering the case.
+	Err error
+}
+
+// Failed reports whether the case failed to render or differs from its golden
+// output.
+func (tc *TestCase) Failed() bool {
+	return tc.Err != nil || len(tc.Diffs) > 0
+}
+
+// goldenCase holds the settings of a golden case.
+type goldenCase struct {
+	// Feature is the feature name, the archetype name by default.
+	Feature string `yaml:"feature"`
+	// Transformation is the default one of the archetype by default.
+	Transformation string            `yaml:"transformation"`
+	Inputs         map[string]string `yaml:"inputs"`
+	// Vars take precedence over the builtin and system variables, e.g. to pin
+	// the destination folder.
+	Vars map[string]string `yaml:"vars"`
+}
+
+// Test renders the golden cases of the source, the folders within its
+// testdata/<archetype> ones, and compares them with their golden output, so
+// archetype repositories can check their archetypes in CI. Every case renders
+// its settings of the optional case.yaml file, the volatile builtin variables
+// like the time and uuid are pinned, and the output is expected in its golden
+// folder. The hooks run in the temporary folder of each case, unless NoHooks.
+// Without an Archetype, the cases of all of them are run.
+func Test(ctx context.Context, opts Options, to TestOptions) ([]TestCase, error) {
+	o := opts.withDefaults()
+	o.Hooks.Progress, o.Hooks.Confirm = nil, nil
+	o.NoPrompt = true
+	gd := filepath.Join(o.SourceDir, goldenFolder)
+	archetypes := []string{o.Archetype}
+	if o.Archetype == "" {
+		as, err := listSource(ctx, o.SourceDir, o.ArchetypesFolder)
+		if err != nil {
+			return nil, err
+		}
+		archetypes = nil
+		for _, a := range as {
+			if _, err := os.Stat(filepath.Join(gd, filepath.FromSlash(a.Name))); err == nil {
+				archetypes = append(archetypes, a.Name)
+			}
+		}
+	}
+	var tcs []TestCase
+	for _, a := range archetypes {
+		ad, err := o.archetypeFolder(a)
+		if err != nil {
+			return nil, err
+		}
+		cases, err := subfolders(filepath.Join(gd, filepath.FromSlash(a)))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cases {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			tc := TestCase{Archetype: a, Name: c}
+			tc.Diffs, tc.Err = o.runGoldenCase(ad, a, filepath.Join(gd, filepath.FromSlash(a), c), to.Update)
+			tc.Duration = time.Since(start)
+			tcs = append(tcs, tc)
+		}
+	}
+	if len(tcs) == 0 {
+		return nil, WithHint(fmt.Errorf("no golden cases in %s", gd), "publishing",
+			"Add a folder per case in %s, with its expected output in the %s folder",
+			filepath.Join(gd, cmp.Or(o.Archetype, "<archetype>")), goldenOutputFolder)
+	}
+	return tcs, nil
+}
+
+// runGoldenCase renders the archetype a in ad with the settings of the case in
+// dir, and returns the differences from its golden output, or rewrites it with
+// update.
+func (o *Options) runGoldenCase(ad, a, dir string, update bool) ([]FileDiff, error) {
+	gc := &goldenCase{}
+	b, err := os.ReadFile(filepath.Join(dir, goldenCaseFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := yaml.Unmarshal(b, gc); err != nil {
+			return nil, fmt.Errorf("invalid golden case %s: %w", filepath.Join(dir, goldenCaseFile), err)
+		}
+	}
+	co := *o
+	co.Archetype = a
+	co.FeatureName = cmp.Or(gc.Feature, archetypeBaseName(a))
+	co.Transformation = gc.Transformation
+	co.Inputs, co.VarFile, co.Args = gc.Inputs, "", nil
+	work, err := os.MkdirTemp("", toolName+"-test-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+	co.Module, co.hooksDir = work, work
+	got, err := co.renderVersion(ad, work, goldenVars(&co), &projectConfig{Vars: gc.Vars})
+	if err != nil {
+		return nil, err
+	}
+	out := filepath.Join(dir, goldenOutputFolder)
+	if update {
+		if err := os.RemoveAll(out); err != nil {
+			return nil, err
+		}
+		for p, b := range got {
+			if err := writeFile(filepath.Join(out, filepath.FromSlash(p)), b, 0o644); err != nil { //nolint:mnd // Standard permissions.
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	want, err := readGolden(out)
+	if err != nil {
+		return nil, err
+	}
+	return diffOutputs(want, got, "golden", "rendered")
+}
+
+// goldenVars returns the builtin variables of o with the volatile ones pinned,
+// so the rendered output is the same on every run.
+func goldenVars(o *Options) map[string]string {
+	vars := builtinVars(o, nil)
+	vars[gitUserNameID] = toolName
+	vars[gitUserEmailID] = toolName + "@example.com"
+	vars[nowRFC3339ID] = goldenTime.Format(time.RFC3339)
+	vars[timestampID] = goldenTime.Format("20060102150405")
+	vars[dateID] = goldenTime.Format(time.DateOnly)
+	vars[yearID] = strconv.Itoa(goldenTime.Year())
+	vars[uuidID] = "00000000-0000-0000-0000-000000000000"
+	return vars
+}
+
+// readGolden returns the files of the golden output folder dir by path, none
+// if it doesn't exist.
+func readGolden(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := readOutput(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	return files, err
+}
+
+// subfolders returns the names of the folders in dir, sorted, none if it
+// doesn't exist.
+func subfolders(dir string) ([]string, error) {
+	es, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range es {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
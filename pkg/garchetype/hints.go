@@ -0,0 +1,76 @@
+package garchetype
+
+import (
+	"fmt"
+	"slices"
+)
+
+// docsURL is the garchetype documentation, the hints point to its sections.
+const docsURL = "https://github.com/diegosz/garchetype"
+
+// Option names a setting of an operation in a hint, e.g. Options.Force, so
+// the callers can name it in their own terms, see HintError.Format.
+type Option string
+
+// The options named by the hints.
+const (
+	optSourceDir          Option = "Options.SourceDir"
+	optSourceRepo         Option = "Options.SourceRepo"
+	optSourceRelease      Option = "Options.SourceRelease"
+	optArchetypesFolder   Option = "Options.ArchetypesFolder"
+	optArchetype          Option = "Options.Archetype"
+	optFeatureName        Option = "Options.FeatureName"
+	optTransformation     Option = "Options.Transformation"
+	optModule             Option = "Options.Module"
+	optForce              Option = "Options.Force"
+	optForceLarge         Option = "Options.ForceLarge"
+	optNoGit              Option = "Options.NoGit"
+	optNoHooks            Option = "Options.NoHooks"
+	optSentinel           Option = "Options.Sentinel"
+	optNoSentinel         Option = "Options.NoSentinel"
+	optStrictDeprecations Option = "Options.StrictDeprecations"
+	optLockTimeout        Option = "Options.LockTimeout"
+	optFrom               Option = "DiffOptions.From"
+	optVersion            Option = "PublishOptions.Version"
+	optRegistry           Option = "PublishOptions.Registry"
+	optRegistryToken      Option = "PublishOptions.RegistryToken"
+	optBuild              Option = "ValidateOptions.Build"
+	optRenameTo           Option = "Rename.to"
+	optWatchDest          Option = "Watch.dest"
+)
+
+// HintError is an error of a common failure mode, along with a one-line
+// suggested fix and a pointer to the docs section covering it.
+type HintError struct {
+	Err  error
+	Hint string
+	Docs string // link to the docs section
+	// format and args render the Hint, the Option args naming the options.
+	format string
+	args   []any
+}
+
+func (e *HintError) Error() string { return e.Err.Error() }
+
+func (e *HintError) Unwrap() error { return e.Err }
+
+// Format returns the Hint with the options it names replaced by name(o), e.g.
+// the command line flags setting them.
+func (e *HintError) Format(name func(o Option) string) string {
+	if e.format == "" {
+		return e.Hint
+	}
+	args := slices.Clone(e.args)
+	for i, a := range args {
+		if o, ok := a.(Option); ok {
+			args[i] = name(o)
+		}
+	}
+	return fmt.Sprintf(e.format, args...)
+}
+
+// WithHint returns err with the suggested fix and the link to the docs section,
+// given by its README anchor. The Option args of the hint name the options.
+func WithHint(err error, section, hint string, a ...any) error {
+	return &HintError{Err: err, Hint: fmt.Sprintf(hint, a...), Docs: docsURL + "#" + section, format: hint, args: a}
+}
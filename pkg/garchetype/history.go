@@ -0,0 +1,99 @@
+package garchetype
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+// defaultHistoryFile is the audit log of the generations, relative to the
+// project folder.
+const defaultHistoryFile = ".garchetype/history.log"
+
+// Audited operations.
+const (
+	operationAdd     = "add"
+	operationRename  = "rename"
+	operationReapply = "reapply"
+)
+
+// historyConfig enables the audit log of the generations run in the project.
+type historyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// File is the audit log path relative to the project folder,
+	// .garchetype/history.log by default.
+	File string `yaml:"file"`
+}
+
+// historyEntry is the audit log record of an operation, written as a JSON line.
+type historyEntry struct {
+	Time           time.Time `json:"time"`
+	User           string    `json:"user"`
+	Operation      string    `json:"operation"`
+	Feature        string    `json:"feature"`
+	Archetype      string    `json:"archetype"`
+	Transformation string    `json:"transformation"`
+	Source         string    `json:"source"`
+	Commit         string    `json:"commit,omitempty"` // archetype source commit
+	Files          []string  `json:"files"`
+}
+
+// append appends e to the audit log of the project in dir, if enabled.
+func (hc historyConfig) append(dir string, e *historyEntry) error {
+	if !hc.Enabled {
+		return nil
+	}
+	f := filepath.Join(dir, defaultHistoryFile)
+	if hc.File != "" {
+		f = filepath.Join(dir, hc.File)
+	}
+	if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+		return err
+	}
+	fh, err := os.OpenFile(f, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fh)
+	enc.SetEscapeHTML(false) // Keep the user emails readable.
+	if err := enc.Encode(e); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// currentUser returns the git user running garchetype, falling back to the
+// system user, the only one with noGit.
+func currentUser(noGit bool) string {
+	var name, email string
+	if !noGit {
+		name, email = gitConfig("user.name"), gitConfig("user.email")
+	}
+	switch {
+	case name != "" && email != "":
+		return name + " <" + email + ">"
+	case name != "" || email != "":
+		return name + email
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// sourceCommit returns the commit the archetypes source folder dir is at, or an
+// empty string if it's not a git repository. The status is read through the c
+// cache.
+func sourceCommit(ctx context.Context, c *gitstat.Cache, dir string) string {
+	gs, err := c.Get(ctx, dir, gitstat.Options{})
+	if err != nil {
+		return ""
+	}
+	return gs.Hash
+}
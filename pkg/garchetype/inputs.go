@@ -0,0 +1,172 @@
+package garchetype
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v2"
+)
+
+// Input types, the go-archetype ones along with int.
+const (
+	inputText   = "text"
+	inputInt    = "int"
+	inputYesNo  = "yesno"
+	inputSelect = "select"
+)
+
+// maskedSecret replaces the values of the secret inputs in the reports and the
+// feature registry.
+const maskedSecret = "****"
+
+// inputTypeAliases are the alternative names of the input types.
+var inputTypeAliases = map[string]string{
+	"":       inputText,
+	"string": inputText,
+	"bool":   inputYesNo,
+	"enum":   inputSelect,
+}
+
+// kind returns the input type, with the aliases resolved.
+func (in inputSpec) kind() string {
+	if t, ok := inputTypeAliases[in.Type]; ok {
+		return t
+	}
+	return in.Type
+}
+
+// public returns the description of the input, builtin tells whether
+// garchetype answers it on its own.
+func (in inputSpec) public(builtin bool) Input {
+	return Input{
+		ID:      in.ID,
+		Text:    in.Text,
+		Type:    in.kind(),
+		Options: in.Options,
+		Default: in.Default,
+		Pattern: in.Pattern,
+		Secret:  in.Secret,
+		Builtin: builtin,
+	}
+}
+
+// check returns an error if the declaration of the input is invalid: its type
+// is unknown, its pattern doesn't compile or its default isn't valid.
+func (in inputSpec) check() error {
+	switch in.kind() {
+	case inputText, inputInt, inputYesNo:
+	case inputSelect:
+		if len(in.Options) == 0 {
+			return fmt.Errorf("input %s: no options to select from", in.ID)
+		}
+	default:
+		return fmt.Errorf("input %s: unknown type %q", in.ID, in.Type)
+	}
+	if in.Pattern != "" {
+		if _, err := regexp.Compile(in.Pattern); err != nil {
+			return fmt.Errorf("input %s: invalid pattern: %w", in.ID, err)
+		}
+	}
+	if in.Default != "" && !envReference.MatchString(in.Default) {
+		return in.validate(in.Default)
+	}
+	return nil
+}
+
+// validate returns an error if the value v doesn't suit the input type and
+// pattern, without showing it if it's secret.
+func (in inputSpec) validate(v string) error {
+	shown := strconv.Quote(v)
+	if in.Secret {
+		shown = "the secret value"
+	}
+	switch in.kind() {
+	case inputInt:
+		if _, err := strconv.Atoi(v); err != nil {
+			return fmt.Errorf("input %s: %s is not an integer", in.ID, shown)
+		}
+	case inputYesNo:
+		// go-archetype takes yes and no too, and answers false as empty.
+		if _, err := strconv.ParseBool(v); err != nil && !slices.Contains([]string{"", "yes", "no"}, strings.ToLower(v)) {
+			return fmt.Errorf("input %s: %s is not a boolean, use true or false", in.ID, shown)
+		}
+	case inputSelect:
+		if !slices.Contains(in.Options, v) {
+			return fmt.Errorf("input %s: %s is not one of %s", in.ID, shown, strings.Join(in.Options, ", "))
+		}
+	}
+	if in.Pattern != "" {
+		re, err := regexp.Compile(in.Pattern)
+		if err != nil {
+			return fmt.Errorf("input %s: invalid pattern: %w", in.ID, err)
+		}
+		if !re.MatchString(v) {
+			return fmt.Errorf("input %s: %s doesn't match the pattern %s", in.ID, shown, in.Pattern)
+		}
+	}
+	return nil
+}
+
+// validateValues returns the errors of the values of the declared inputs, by
+// id.
+func (ts *transformationSpec) validateValues(values map[string]string) error {
+	var errs error
+	for _, in := range ts.Inputs {
+		if v, ok := values[in.ID]; ok {
+			errs = multierr.Append(errs, in.validate(v))
+		}
+	}
+	if errs != nil {
+		return WithHint(errs, "inputs", "Provide values matching the types and patterns of the inputs")
+	}
+	return nil
+}
+
+// argValues returns the input values of the CLI arguments args, given as
+// --id=value or --id value, by id.
+func argValues(args []string) map[string]string {
+	values := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		name, ok := strings.CutPrefix(args[i], "--")
+		if !ok {
+			continue
+		}
+		if k, v, ok := strings.Cut(name, "="); ok {
+			values[k] = v
+			continue
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			values[name] = args[i+1]
+			i++
+		}
+	}
+	return values
+}
+
+// generatorInputTypes replaces the input types of the transformation file
+// items ms by the go-archetype ones: the aliases are resolved and the int
+// inputs are text ones, garchetype validates them.
+func generatorInputTypes(ms yaml.MapSlice) {
+	for _, mi := range ms {
+		if mi.Key != "inputs" {
+			continue
+		}
+		ins, _ := mi.Value.([]any)
+		for _, in := range ins {
+			m, _ := in.(yaml.MapSlice)
+			for i := range m {
+				if t, ok := m[i].Value.(string); ok && m[i].Key == "type" {
+					t = inputSpec{Type: t}.kind()
+					if t == inputInt {
+						t = inputText
+					}
+					m[i].Value = t
+				}
+			}
+		}
+	}
+}
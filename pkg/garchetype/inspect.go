@@ -0,0 +1,237 @@
+package garchetype
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Kinds of the findings of Inspect.
+const (
+	// FindingHook is a shell command run by a transformation.
+	FindingHook = "hook"
+	// FindingOutsideSubpath is a file written outside a feature subpath, or
+	// a symlink pointing outside the archetype.
+	FindingOutsideSubpath = "outside-subpath"
+	// FindingShell is a generated shell script or executable file.
+	FindingShell = "shell"
+	// FindingNetwork is a hook, or a line of a generated file, reaching the
+	// network.
+	FindingNetwork = "network"
+	// FindingRequires is an archetype applied first, inspect it too.
+	FindingRequires = "requires"
+	// FindingWasm is a WASM module transforming the generated files,
+	// sandboxed but opaque.
+	FindingWasm = "wasm"
+)
+
+// Finding is something an archetype would do that deserves a security review.
+type Finding struct {
+	Kind string `json:"kind"`
+	// File is the archetype file, or transformation file, of the finding,
+	// relative to the archetype folder, and Line its line, if known.
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// scriptExts are the extensions of the shell scripts.
+var scriptExts = []string{".sh", ".bash", ".zsh", ".fish", ".ps1", ".bat", ".cmd"}
+
+// stepFiles are the files of the steps run by the build tools, besides the
+// scripts.
+var stepFiles = []string{"Makefile", "GNUmakefile", "Dockerfile", "Containerfile", "Justfile", "justfile", "Taskfile.yml", "Taskfile.yaml"}
+
+// networkCommand matches the commands reaching the network.
+var networkCommand = regexp.MustCompile(`(^|[\s;&|(` + "`" + `])(curl|wget|nc|ssh|scp|rsync|` +
+	`git\s+(clone|fetch|pull|push|submodule)|go\s+(get|install|mod\s+(download|tidy))|` +
+	`npm\s+(install|i|ci)|npx|yarn\s+(add|install)|pnpm\s+(add|install)|pip3?\s+install|` +
+	`docker\s+(pull|push|build|run)|apt(-get)?\s+install|apk\s+add|brew\s+install)($|\s)`)
+
+// urlPattern matches the URLs in the hook commands.
+var urlPattern = regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://\S+`)
+
+// Inspect statically lists everything potentially dangerous the Archetype of
+// the source would do, without generating it: the hooks and WASM modules of
+// its transformations, the files written outside a feature subpath, the shell
+// scripts among its files and the steps reaching the network, so it can be
+// reviewed before its first use.
+func Inspect(ctx context.Context, opts Options) ([]Finding, error) {
+	o := opts.withDefaults()
+	if o.Archetype == "" {
+		return nil, WithHint(errors.New("archetype is required"), "hooks",
+			"Pass the archetype to inspect with %s", optArchetype)
+	}
+	if err := syncSource(ctx, o); err != nil {
+		return nil, err
+	}
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return nil, err
+	}
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, req := range md.Requires {
+		findings = append(findings, Finding{Kind: FindingRequires, File: archetypeMetadataFile,
+			Detail: fmt.Sprintf("adds the %s archetype first", req)})
+	}
+	ts, err := getTransformations(ad)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(ts)
+	var modules []string
+	for _, t := range ts {
+		tf, err := getTransformationFile(t)
+		if err != nil {
+			return nil, err
+		}
+		before, after, err := readHooks(filepath.Join(ad, tf))
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, inspectHooks(tf, "before", before)...)
+		findings = append(findings, inspectHooks(tf, "after", after)...)
+		spec, err := readTransformationSpec(filepath.Join(ad, tf))
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, wasmModules(spec.Wasm)...)
+		for _, w := range spec.Wasm {
+			findings = append(findings, Finding{Kind: FindingWasm, File: tf,
+				Detail: fmt.Sprintf("runs the %s module on %s", w.Module, strings.Join(w.Files, ", "))})
+		}
+	}
+	ff, err := inspectFiles(ad, md, modules)
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, ff...), nil
+}
+
+// inspectHooks returns the findings of the hooks of the when operations of
+// the transformation file tf.
+func inspectHooks(tf, when string, hs []hook) []Finding {
+	var findings []Finding
+	for _, h := range hs {
+		for _, cmd := range h.commands() {
+			if strings.TrimSpace(cmd) == "" {
+				continue
+			}
+			findings = append(findings, Finding{Kind: FindingHook, File: tf, Detail: fmt.Sprintf("runs %q %s generating", cmd, when)})
+			if networkCommand.MatchString(cmd) || urlPattern.MatchString(cmd) {
+				findings = append(findings, Finding{Kind: FindingNetwork, File: tf, Detail: fmt.Sprintf("hook %q reaches the network", cmd)})
+			}
+		}
+	}
+	return findings
+}
+
+// inspectFiles returns the findings of the files of the archetype in ad, the
+// ones a generation may write.
+func inspectFiles(ad string, md *archetypeMetadata, modules []string) ([]Finding, error) {
+	ignore, err := readIgnoreFile(ad)
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	err = filepath.WalkDir(ad, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ad, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if d.IsDir() {
+			if rel == goldenFolder || rel == ".git" || ignore.match(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignore.match(rel) || rel == archetypeMetadataFile || rel == ignoreFile || slices.Contains(modules, rel) ||
+			strings.HasPrefix(rel, transformationPrefix) && strings.HasSuffix(rel, "."+transformationExt) {
+			return nil
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, templateExt))
+		if md.Destination == "" {
+			findings = append(findings, Finding{Kind: FindingOutsideSubpath, File: filepath.ToSlash(rel),
+				Detail: fmt.Sprintf("writes %s in the module folder, the archetype declares no destination subpath", name)})
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			if f, ok := escapingLink(ad, path, md.Symlinks); ok {
+				findings = append(findings, f)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		ff, err := inspectFile(path, filepath.ToSlash(rel), name)
+		findings = append(findings, ff...)
+		return err
+	})
+	return findings, err
+}
+
+// escapingLink returns the finding of the symlink in path of the archetype in
+// ad, if it points outside the archetype.
+func escapingLink(ad, path, symlinks string) (Finding, bool) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return Finding{}, false
+	}
+	rel, err := filepath.Rel(ad, filepath.Join(filepath.Dir(path), target))
+	if err == nil && !filepath.IsAbs(target) && filepath.IsLocal(rel) {
+		return Finding{}, false
+	}
+	detail := "copies the contents of %s, outside the archetype"
+	if symlinks == symlinksPreserve {
+		detail = "links to %s, outside the archetype"
+	}
+	lrel, _ := filepath.Rel(ad, path)
+	return Finding{Kind: FindingOutsideSubpath, File: filepath.ToSlash(lrel), Detail: fmt.Sprintf(detail, target)}, true
+}
+
+// inspectFile returns the findings of the archetype file in path, rel within
+// the archetype, generated as name.
+func inspectFile(path, rel, name string) ([]Finding, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	script := slices.Contains(scriptExts, filepath.Ext(name)) || bytes.HasPrefix(b, []byte("#!"))
+	switch {
+	case script:
+		findings = append(findings, Finding{Kind: FindingShell, File: rel, Detail: fmt.Sprintf("generates the %s script", name)})
+	case info.Mode().Perm()&0o111 != 0:
+		findings = append(findings, Finding{Kind: FindingShell, File: rel, Detail: fmt.Sprintf("generates the %s executable file", name)})
+	}
+	if !script && !slices.Contains(stepFiles, filepath.Base(name)) && filepath.Ext(name) != ".mk" {
+		return findings, nil
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(nil, len(b)+1)
+	for n := 1; s.Scan(); n++ {
+		if l := strings.TrimSpace(s.Text()); networkCommand.MatchString(l) {
+			findings = append(findings, Finding{Kind: FindingNetwork, File: rel, Line: n, Detail: fmt.Sprintf("%s runs %q", name, l)})
+		}
+	}
+	return findings, s.Err()
+}
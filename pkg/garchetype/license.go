@@ -0,0 +1,46 @@
+package garchetype
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// licenseConfig sets the license header of the generated files of the
+// project, so the archetypes don't have to embed it.
+type licenseConfig struct {
+	// Header is the template of the license header, executed with the
+	// licenseData, e.g. "Copyright {{.Year}} Acme Inc.".
+	Header string `yaml:"header"`
+	// Exclude are the globs of the generated files left without it, relative
+	// to the module folder.
+	Exclude []string `yaml:"exclude"`
+}
+
+// licenseData is what the license header template is executed with.
+type licenseData struct {
+	Year      int
+	Feature   string
+	Archetype string
+	// Vars are the variables of the generation, e.g. the project ones.
+	Vars map[string]string
+}
+
+// header returns the license header executed with data, empty if unset.
+func (lc licenseConfig) header(data licenseData) (string, error) {
+	if strings.TrimSpace(lc.Header) == "" {
+		return "", nil
+	}
+	t, err := template.New("license").Funcs(templateFuncs()).Parse(lc.Header)
+	if err != nil {
+		return "", WithHint(fmt.Errorf("invalid license header template: %w", err), "project-configuration",
+			"Fix the license settings of the %s file", projectConfigFile)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", WithHint(fmt.Errorf("license header template: %w", err), "project-configuration",
+			"Fix the license settings of the %s file", projectConfigFile)
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
@@ -0,0 +1,80 @@
+package garchetype
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Default limits of the archetypes, generous for any sensible archetype.
+const (
+	defaultMaxFiles     = 5000
+	defaultMaxTotalSize = 100 << 20
+	defaultMaxFileSize  = 10 << 20
+)
+
+// limitsConfig bounds the archetypes the project generates from, so a
+// mis-scoped archetype or a wrong source path can't flood it.
+type limitsConfig struct {
+	// MaxFiles is the number of archetype files, 5000 by default.
+	MaxFiles int `yaml:"maxFiles"`
+	// MaxTotalSize is the size of the archetype files, e.g. 200MiB, 100MiB
+	// by default.
+	MaxTotalSize string `yaml:"maxTotalSize"`
+	// MaxFileSize is the size of each archetype file, 10MiB by default.
+	MaxFileSize string `yaml:"maxFileSize"`
+}
+
+// check returns an error if the archetype files of the jobs exceed the limits.
+func (lc limitsConfig) check(jobs []stageJob) error {
+	maxFiles := lc.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFiles
+	}
+	maxTotal, err := lc.size(lc.MaxTotalSize, defaultMaxTotalSize)
+	if err != nil {
+		return err
+	}
+	maxFile, err := lc.size(lc.MaxFileSize, defaultMaxFileSize)
+	if err != nil {
+		return err
+	}
+	if len(jobs) > maxFiles {
+		return lc.exceeded(fmt.Errorf("the archetype has %d files, over the limit of %d", len(jobs), maxFiles), "maxFiles")
+	}
+	var total int64
+	for _, j := range jobs {
+		fi, err := os.Stat(j.path)
+		if err != nil {
+			return err
+		}
+		if fi.Size() > maxFile {
+			return lc.exceeded(fmt.Errorf("the archetype file %s is %s, over the limit of %s",
+				filepath.ToSlash(j.rel), FormatSize(fi.Size()), FormatSize(maxFile)), "maxFileSize")
+		}
+		if total += fi.Size(); total > maxTotal {
+			return lc.exceeded(fmt.Errorf("the archetype files are over the limit of %s", FormatSize(maxTotal)), "maxTotalSize")
+		}
+	}
+	return nil
+}
+
+// size returns the bytes of the limit s, or def if unset.
+func (lc limitsConfig) size(s string, def int64) (int64, error) {
+	n, err := ParseSize(s)
+	if err != nil {
+		return 0, WithHint(fmt.Errorf("limits: %w", err), "project-configuration",
+			"Fix the limits of the %s file", projectConfigFile)
+	}
+	if n == 0 {
+		return def, nil
+	}
+	return n, nil
+}
+
+// exceeded returns the err error of exceeding the limit, with the suggested
+// fixes.
+func (lc limitsConfig) exceeded(err error, limit string) error {
+	return WithHint(err, "project-configuration",
+		"Check the source folder and the archetype, raise limits.%s in the %s file, or pass %s", limit, projectConfigFile, optForceLarge)
+}
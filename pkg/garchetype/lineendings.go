@@ -0,0 +1,78 @@
+package garchetype
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Line endings of the generated text files.
+const (
+	LineEndingsLF   = "lf"
+	LineEndingsCRLF = "crlf"
+	// LineEndingsAuto uses the native line endings of the platform, CRLF on
+	// Windows and LF elsewhere.
+	LineEndingsAuto = "auto"
+)
+
+// eolSequence returns the line ending sequence of the line endings setting,
+// empty to keep the rendered ones.
+func eolSequence(lineEndings string) (string, error) {
+	switch lineEndings {
+	case "":
+		return "", nil
+	case LineEndingsLF:
+		return "\n", nil
+	case LineEndingsCRLF:
+		return "\r\n", nil
+	case LineEndingsAuto:
+		if runtime.GOOS == "windows" {
+			return "\r\n", nil
+		}
+		return "\n", nil
+	}
+	return "", WithHint(fmt.Errorf("invalid line endings %q", lineEndings), "generated-files",
+		"Use %s, %s or %s", LineEndingsLF, LineEndingsCRLF, LineEndingsAuto)
+}
+
+// eol returns the line ending sequence of the generated text files of the
+// archetype with the md metadata.
+func (o *Options) eol(md *archetypeMetadata) (string, error) {
+	return eolSequence(cmp.Or(o.LineEndings, md.LineEndings))
+}
+
+// convertLineEndings rewrites the line endings of the rendered text file p
+// with eol, or the ones of its eol attribute, pa. The scripts starting with a
+// shebang keep LF, so they still run, unless their eol attribute is set.
+func convertLineEndings(p, eol string, pa pathAttributes) error {
+	if pa.Text != nil && !*pa.Text {
+		return nil
+	}
+	if pa.EOL != "" {
+		eol, _ = eolSequence(pa.EOL)
+	}
+	if eol == "" {
+		return nil
+	}
+	fi, err := os.Lstat(p)
+	if err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	if pa.Text == nil && pa.EOL == "" && (isBinary(p, b) || bytes.HasPrefix(b, []byte("#!"))) {
+		return nil
+	}
+	out := bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	if eol != "\n" {
+		out = bytes.ReplaceAll(out, []byte("\n"), []byte(eol))
+	}
+	if bytes.Equal(out, b) {
+		return nil
+	}
+	return os.WriteFile(p, out, fi.Mode().Perm())
+}
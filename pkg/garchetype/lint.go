@@ -0,0 +1,156 @@
+package garchetype
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"go.uber.org/multierr"
+)
+
+// builtinVarIDs are the variables injected by builtinVars, besides the feature
+// name and its case variants.
+var builtinVarIDs = []string{
+	modulePathID, moduleNameID, packageNameID, gitUserNameID, gitUserEmailID,
+	nowRFC3339ID, timestampID, dateID, yearID, uuidID,
+	gitBranchID, gitHashID, gitShortHashID, gitTagID,
+}
+
+// templateLinter checks the templates of an archetype against the variables a
+// generation provides.
+type templateLinter struct {
+	known map[string]bool
+	errs  error
+}
+
+// lintTemplates parses every template of the archetype in the ad folder and
+// reports the syntax errors and the references to undeclared variables, by
+// file and line. The declared variables are the inputs of the specs, their
+// feature inputs case variants, the builtin, system and project variables.
+func lintTemplates(ad string, md *archetypeMetadata, specs []*transformationSpec, pc *projectConfig) error {
+	vars := systemVars(ad, ad)
+	addCaseVariants(vars, featureNameID, featureNameID)
+	for _, ts := range specs {
+		for _, in := range ts.Inputs {
+			vars[in.ID] = ""
+		}
+		fid := featureInputID(md, ts)
+		addCaseVariants(vars, fid, fid)
+	}
+	for k := range pc.Vars {
+		vars[k] = ""
+	}
+	l := &templateLinter{known: make(map[string]bool)}
+	for k := range vars {
+		l.known[k] = true
+	}
+	for _, id := range builtinVarIDs {
+		l.known[id] = true
+	}
+	ignore, err := readIgnoreFile(ad)
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(ad, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ad, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && ignore.match(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasSuffix(rel, templateExt) {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		l.lint(path, string(b))
+		return nil
+	})
+	return multierr.Append(l.errs, err)
+}
+
+// lint parses the template text of file and checks its variables.
+func (l *templateLinter) lint(file, text string) {
+	t, err := template.New(file).Funcs(templateFuncs()).Parse(text)
+	if err != nil {
+		l.errs = multierr.Append(l.errs, err)
+		return
+	}
+	if t.Tree != nil {
+		l.check(t.Tree, t.Tree.Root, true)
+	}
+}
+
+// check walks the node of tree, atRoot tells whether the dot is the variables
+// map, it's not within the range and with actions.
+func (l *templateLinter) check(tree *parse.Tree, n parse.Node, atRoot bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			l.check(tree, c, atRoot)
+		}
+	case *parse.ActionNode:
+		l.check(tree, n.Pipe, atRoot)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			l.check(tree, c, atRoot)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			l.check(tree, a, atRoot)
+		}
+	case *parse.ChainNode:
+		l.check(tree, n.Node, atRoot)
+	case *parse.FieldNode:
+		if atRoot {
+			l.reference(tree, n, n.Ident[0])
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			l.reference(tree, n, n.Ident[1])
+		}
+	case *parse.IfNode:
+		l.check(tree, n.Pipe, atRoot)
+		l.check(tree, n.List, atRoot)
+		l.check(tree, n.ElseList, atRoot)
+	case *parse.RangeNode:
+		l.check(tree, n.Pipe, atRoot)
+		l.check(tree, n.List, false)
+		l.check(tree, n.ElseList, atRoot)
+	case *parse.WithNode:
+		l.check(tree, n.Pipe, atRoot)
+		l.check(tree, n.List, false)
+		l.check(tree, n.ElseList, atRoot)
+	case *parse.TemplateNode:
+		l.check(tree, n.Pipe, atRoot)
+	}
+}
+
+// reference reports the reference of node to the name variable, unless it's
+// declared.
+func (l *templateLinter) reference(tree *parse.Tree, node parse.Node, name string) {
+	if l.known[name] {
+		return
+	}
+	loc, _ := tree.ErrorContext(node)
+	l.errs = multierr.Append(l.errs, fmt.Errorf("%s: undeclared variable .%s", loc, name))
+}
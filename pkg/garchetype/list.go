@@ -0,0 +1,334 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// List returns the archetypes of the source that have transformations. With
+// AllSources, the ones of the project config sources too. The listings are
+// cached per source commit, and the sources synced within MaxAge aren't synced
+// again.
+func List(ctx context.Context, opts Options) ([]Archetype, error) {
+	o := opts.withDefaults()
+	sources := []Source{{Dir: o.SourceDir, Repo: o.SourceRepo, Release: o.SourceRelease, Auth: o.SourceAuth}}
+	if o.AllSources {
+		pc, err := readProjectConfig(o.projectDir())
+		if err != nil {
+			return nil, err
+		}
+		if o.SourceDir == "" && len(pc.Sources) > 0 {
+			sources = nil
+		}
+		for _, s := range pc.Sources {
+			if s.Release != "" && s.Dir == "" {
+				s.Dir = releaseDir(s.Release)
+			}
+			if !slices.ContainsFunc(sources, func(d Source) bool { return d.Dir == s.Dir }) {
+				sources = append(sources, s)
+			}
+		}
+	}
+	caches := make([]*listCache, len(sources))
+	var stale []Source
+	for i, s := range sources {
+		caches[i] = readListCache(s.Dir)
+		if _, err := os.Stat(s.Dir); err != nil || !caches[i].fresh(o.MaxAge) {
+			stale = append(stale, s)
+		}
+	}
+	if len(stale) > 0 {
+		if err := syncSources(ctx, o, stale); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	var as []Archetype
+	for i, s := range sources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		lc := caches[i]
+		if slices.Contains(stale, s) {
+			lc.Synced = now
+		}
+		sa, err := cachedListSource(ctx, o.status, lc, s.Dir, o.ArchetypesFolder)
+		if err != nil {
+			return nil, err
+		}
+		_ = lc.write(s.Dir)
+		as = append(as, sa...)
+	}
+	return as, nil
+}
+
+// listSource returns the archetypes of the source in dir that have
+// transformations, found in the archetypesFolder search path. An archetype
+// hides the ones with the same name in the later folders.
+func listSource(ctx context.Context, dir, archetypesFolder string) ([]Archetype, error) {
+	ads, err := archetypesFolders(dir, archetypesFolder)
+	if err != nil {
+		return nil, err
+	}
+	var as []Archetype
+	for _, ad := range ads {
+		fas, err := listArchetypesFolder(ctx, dir, ad)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range fas {
+			if !slices.ContainsFunc(as, func(b Archetype) bool { return b.Name == a.Name }) {
+				as = append(as, a)
+			}
+		}
+	}
+	slices.SortStableFunc(as, func(a, b Archetype) int { return strings.Compare(a.Name, b.Name) })
+	return as, nil
+}
+
+// listArchetypesFolder returns the archetypes in the ad archetypes folder of
+// the source in dir that have transformations.
+func listArchetypesFolder(ctx context.Context, dir, ad string) ([]Archetype, error) {
+	sd, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := filepath.Rel(sd, ad)
+	if err != nil {
+		return nil, err
+	}
+	names, err := getArchetypes(ad)
+	if err != nil {
+		return nil, err
+	}
+	var as []Archetype
+	for _, a := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		afd := filepath.Join(ad, filepath.FromSlash(a))
+		md, err := readArchetypeMetadata(afd)
+		if err != nil {
+			return nil, err
+		}
+		ts, err := archetypeTransformations(afd, md)
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) == 0 {
+			continue
+		}
+		as = append(as, Archetype{
+			Name:            a,
+			Description:     oneLine(md.Description),
+			Version:         md.Version,
+			Deprecated:      oneLine(md.Deprecated),
+			Source:          dir,
+			Folder:          filepath.ToSlash(folder),
+			Transformations: ts,
+		})
+	}
+	return as, nil
+}
+
+// archetypeTransformations returns the transformations of the archetype in the
+// ad folder, with the md metadata, along with their descriptions.
+func archetypeTransformations(ad string, md *archetypeMetadata) ([]Transformation, error) {
+	names, err := getTransformations(ad)
+	if err != nil {
+		return nil, err
+	}
+	ts := make([]Transformation, 0, len(names))
+	for _, t := range names {
+		tf, err := getTransformationFile(t)
+		if err != nil {
+			return nil, err
+		}
+		spec, err := readTransformationSpec(filepath.Join(ad, tf))
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, Transformation{
+			Name:        t,
+			Description: oneLine(spec.Description),
+			Default:     t == md.transformation(""),
+			Aliases:     md.aliases(t),
+			Deprecated:  oneLine(spec.Deprecated),
+		})
+	}
+	return ts, nil
+}
+
+// archetypesFolders returns the existing folders of the archetypes search path
+// of the source in dir, in order.
+func archetypesFolders(dir, archetypes string) ([]string, error) {
+	var ads []string
+	var first error
+	for _, f := range filepath.SplitList(archetypes) {
+		ad, err := getArchetypesFolder(dir, f)
+		if err != nil {
+			first = cmp.Or(first, err)
+			continue
+		}
+		ads = append(ads, ad)
+	}
+	if len(ads) == 0 {
+		return nil, cmp.Or(first, errors.New("undefined archetypes"))
+	}
+	return ads, nil
+}
+
+// archetypeFolder returns the folder of the archetype, the first one found in
+// the archetypes search path.
+func (o *Options) archetypeFolder(archetype string) (string, error) {
+	ads, err := archetypesFolders(o.SourceDir, o.ArchetypesFolder)
+	if err != nil {
+		return "", err
+	}
+	for _, asd := range ads {
+		if _, err := os.Stat(filepath.Join(asd, archetype)); err == nil {
+			return getArchetypeFolder(asd, archetype)
+		}
+	}
+	return getArchetypeFolder(ads[0], archetype)
+}
+
+// firstArchetypesFolder returns the first folder of the archetypes search
+// path, where the catalog index lives.
+func (o *Options) firstArchetypesFolder() string {
+	return cmp.Or(append(filepath.SplitList(o.ArchetypesFolder), DefaultArchetypesFolder)...)
+}
+
+func getArchetypesFolder(dir, archetypes string) (string, error) {
+	if dir == "" {
+		return "", errors.New("undefined dir")
+	}
+	if archetypes == "" {
+		return "", errors.New("undefined archetypes")
+	}
+	// The absolute paths let the os package handle the Windows long paths,
+	// adding the \\?\ prefix, for the deep archetype trees.
+	ad, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(archetypes)))
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(ad)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", WithHint(fmt.Errorf("archetypes folder not found: %s", ad), "archetypes",
+			"Check that %s is an archetypes source with a %s folder, or pass its folder with %s", optSourceDir, archetypes, optArchetypesFolder)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("invalid archetypes folder: %s", ad)
+	}
+	return ad, nil
+}
+
+func getArchetypeFolder(dir, archetype string) (string, error) {
+	if dir == "" {
+		return "", errors.New("undefined dir")
+	}
+	if archetype == "" {
+		return "", errors.New("undefined archetype")
+	}
+	if !filepath.IsLocal(filepath.FromSlash(archetype)) {
+		return "", fmt.Errorf("invalid archetype name %q", archetype)
+	}
+	ad := filepath.Join(dir, filepath.FromSlash(archetype))
+	fi, err := os.Stat(ad)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", WithHint(fmt.Errorf("unknown archetype %q", archetype), "archetypes",
+			"Run '%s list' to see the available archetypes", toolName)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("invalid archetype folder: %s", ad)
+	}
+	return ad, nil
+}
+
+// getArchetypes returns the names of the archetypes in dir. The folders without
+// transformation files are namespaces, the archetypes nested in them are named
+// with the slash-separated path, e.g. db/postgres.
+func getArchetypes(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, errors.New("undefined dir")
+	}
+	var as []string
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(entries) // Readdirnames is in directory order.
+	for _, f := range entries {
+		fi, err := os.Stat(filepath.Join(dir, f))
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		ts, err := getTransformations(filepath.Join(dir, f))
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) > 0 {
+			as = append(as, f)
+			continue
+		}
+		nested, err := getArchetypes(filepath.Join(dir, f))
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nested {
+			as = append(as, f+"/"+n)
+		}
+	}
+	return as, nil
+}
+
+func getTransformations(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, errors.New("undefined dir")
+	}
+	var ts []string
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(entries) // Readdirnames is in directory order.
+	for _, f := range entries {
+		if strings.HasPrefix(f, transformationPrefix) && strings.HasSuffix(f, transformationExt) {
+			t := strings.TrimSuffix(strings.TrimPrefix(f, transformationPrefix), "."+transformationExt)
+			ts = append(ts, t)
+		}
+	}
+	return ts, nil
+}
+
+// oneLine returns the first line of the description s.
+func oneLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
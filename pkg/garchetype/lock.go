@@ -0,0 +1,225 @@
+package garchetype
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// DefaultLockTimeout is how long a process waits for another one syncing the
+// same source folder.
+const DefaultLockTimeout = 5 * time.Minute
+
+const (
+	// staleLockAge is the age of a lock left behind by a crashed process.
+	staleLockAge = 30 * time.Minute
+	// lockRefresh is how often the holder touches its lock, so the long syncs
+	// never leave it stale.
+	lockRefresh = staleLockAge / 3
+	lockRetry   = 250 * time.Millisecond
+)
+
+// sourceLock is the holder of the lock of a source folder, told apart from
+// the other ones by its random Token.
+type sourceLock struct {
+	PID   int       `json:"pid"`
+	Host  string    `json:"host"`
+	Time  time.Time `json:"time"`
+	Token string    `json:"token"`
+}
+
+// newSourceLock returns the sourceLock of this process.
+func newSourceLock() sourceLock {
+	host, _ := os.Hostname()
+	b := make([]byte, 8) //nolint:mnd // Enough to tell the holders apart.
+	_, _ = rand.Read(b)
+	return sourceLock{PID: os.Getpid(), Host: host, Time: time.Now(), Token: hex.EncodeToString(b)}
+}
+
+// sourceLockFile returns the lock file of the source folder dir, in the user
+// cache folder, or the temporary one without it.
+func sourceLockFile(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	cd, err := os.UserCacheDir()
+	if err != nil {
+		cd = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cd, toolName, "locks", hex.EncodeToString(sum[:8])+".lock"), nil
+}
+
+// lockSource acquires the lock of the source folder of o, shared by the
+// garchetype processes, so they don't clone, download or pull it at the same
+// time. It waits for the process holding it up to the LockTimeout, and takes
+// over the locks older than staleLockAge. The returned function releases it.
+func (o *Options) lockSource(ctx context.Context) (unlock func(), err error) {
+	f, err := sourceLockFile(o.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	timeout := o.LockTimeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+	unlock, err = lockFile(ctx, f, timeout, func() func() {
+		return o.Hooks.busy("Waiting for another process syncing " + o.SourceDir)
+	})
+	if errors.Is(err, fs.ErrExist) {
+		return nil, lockedSource(o.SourceDir, f)
+	}
+	return unlock, err
+}
+
+// lockFile acquires the lock file f, waiting up to timeout for the process
+// holding it, or failing at once if it's negative, with the fs.ErrExist error.
+// The wait function, if any, is called once the wait starts, and returns the one
+// to call once it's over. The locks older than staleLockAge are taken over, see
+// takeOverLock. It's kept fresh while held, see holdLock. The returned function
+// releases it, unless another process took it over meanwhile.
+func lockFile(ctx context.Context, f string, timeout time.Duration, wait func() (done func())) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil { //nolint:mnd,gosec // Standard permissions.
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	var stop func()
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+	sl := newSourceLock()
+	for {
+		err := createLock(f, sl)
+		if err == nil {
+			return holdLock(f, sl), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(f); err == nil && time.Since(fi.ModTime()) > staleLockAge {
+			ok, err := takeOverLock(f, fi, sl)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return holdLock(f, sl), nil
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		if stop == nil && wait != nil {
+			stop = wait()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetry):
+		}
+	}
+}
+
+// holdLock touches the lock file f held by sl every lockRefresh, so it's never
+// taken for stale however long the sync takes, until the returned function
+// releases it.
+func holdLock(f string, sl sourceLock) (unlock func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(lockRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if ownsLock(f, sl) {
+					now := time.Now()
+					_ = os.Chtimes(f, now, now)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			if ownsLock(f, sl) {
+				_ = os.Remove(f)
+			}
+		})
+	}
+}
+
+// createLock creates the lock file f, recording its holder sl from now on,
+// unless it exists.
+func createLock(f string, sl sourceLock) error {
+	sl.Time = time.Now()
+	lf, err := os.OpenFile(f, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644) //nolint:mnd,gosec // Standard permissions.
+	if err != nil {
+		return err
+	}
+	err = multierr.Combine(json.NewEncoder(lf).Encode(sl), lf.Close())
+	if err != nil {
+		_ = os.Remove(f)
+	}
+	return err
+}
+
+// takeOverLock replaces the stale lock file f, unless it changed meanwhile, by
+// a lock of sl renamed over it at once, so it's never missing for the other
+// processes to create their own. It then waits lockRetry for the processes
+// taking it over at the same time, and reports whether sl holds it: only the
+// last one renaming its lock does.
+func takeOverLock(f string, stale fs.FileInfo, sl sourceLock) (bool, error) {
+	tmp := f + "." + sl.Token
+	if err := createLock(tmp, sl); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp) //nolint:errcheck // Gone once renamed.
+	if fi, err := os.Stat(f); err != nil || !os.SameFile(fi, stale) {
+		return false, nil // Released or taken over meanwhile.
+	}
+	if err := os.Rename(tmp, f); err != nil {
+		return false, err
+	}
+	time.Sleep(lockRetry)
+	return ownsLock(f, sl), nil
+}
+
+// ownsLock reports whether the lock file f is held by sl.
+func ownsLock(f string, sl sourceLock) bool {
+	var cur sourceLock
+	b, err := os.ReadFile(f)
+	return err == nil && json.Unmarshal(b, &cur) == nil && cur.Token == sl.Token
+}
+
+// lockedSource returns the error of the source folder dir locked by another
+// process in the lock file f.
+func lockedSource(dir, f string) error {
+	holder := "another process"
+	var sl sourceLock
+	if b, err := os.ReadFile(f); err == nil && json.Unmarshal(b, &sl) == nil {
+		holder = fmt.Sprintf("process %d on %s since %s", sl.PID, sl.Host, sl.Time.Format(time.TimeOnly))
+	}
+	return WithHint(fmt.Errorf("source %s is being synced by %s", dir, holder), "sources-and-cache",
+		"Retry once it's done, pass a longer %s, or remove %s if that process is gone", optLockTimeout, f)
+}
@@ -0,0 +1,59 @@
+package garchetype
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// reservedNames are the file names reserved by Windows, they can't name the
+// generated folders.
+var reservedNames = []string{
+	"con", "prn", "aux", "nul",
+	"com1", "com2", "com3", "com4", "com5", "com6", "com7", "com8", "com9",
+	"lpt1", "lpt2", "lpt3", "lpt4", "lpt5", "lpt6", "lpt7", "lpt8", "lpt9",
+}
+
+// checkFeatureName returns an error if the feature name can't name a folder,
+// or for the go ecosystem a package, suggesting a valid alternative if any.
+func checkFeatureName(name, ecosystem string) error {
+	if name == "" {
+		return errors.New("feature name is required")
+	}
+	words := splitWords(name)
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+	}); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(name[i:])
+		return invalidName(name, fmt.Sprintf("has the invalid character %q", r), ecosystem, strings.Join(words, "-"))
+	}
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsLetter(r) {
+		var suggestion string
+		if len(words) > 0 {
+			suggestion = "feature-" + strings.Join(words, "-")
+		}
+		return invalidName(name, "doesn't start with a letter", ecosystem, suggestion)
+	}
+	snake := strings.Join(words, "_")
+	if slices.Contains(reservedNames, snake) {
+		return invalidName(name, "is a reserved folder name", ecosystem, name+"s")
+	}
+	if cmp.Or(ecosystem, defaultEcosystem) == defaultEcosystem && token.IsKeyword(snake) {
+		return invalidName(name, "is a Go keyword", ecosystem, name+"s")
+	}
+	return nil
+}
+
+// invalidName returns the error of the invalid feature name and why, along
+// with the suggestion if it's valid.
+func invalidName(name, why, ecosystem, suggestion string) error {
+	if suggestion == "" || checkFeatureName(suggestion, ecosystem) != nil {
+		return fmt.Errorf("feature name %q %s", name, why)
+	}
+	return fmt.Errorf("feature name %q %s, try %q", name, why, suggestion)
+}
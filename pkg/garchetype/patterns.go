@@ -0,0 +1,75 @@
+package garchetype
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ignoreFile is the name of the optional file in the archetype folder listing
+// the patterns of the archetype files that are never generated.
+const ignoreFile = ".garchetypeignore"
+
+// pathPatterns matches slash separated relative paths against glob patterns. A
+// pattern without a slash matches the base name at any depth, and a pattern
+// ending in a slash matches everything under that folder.
+type pathPatterns []glob.Glob
+
+func compilePatterns(patterns []string) (pathPatterns, error) {
+	var pp pathPatterns
+	for _, p := range patterns {
+		p = filepath.ToSlash(strings.TrimPrefix(p, "./"))
+		if strings.HasSuffix(p, "/") {
+			p += "**"
+		}
+		ps := []string{p}
+		if !strings.Contains(strings.TrimSuffix(p, "/**"), "/") {
+			ps = append(ps, "**/"+p)
+		}
+		for _, p := range ps {
+			g, err := glob.Compile(p, '/')
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", p, err)
+			}
+			pp = append(pp, g)
+		}
+	}
+	return pp, nil
+}
+
+// match reports whether the relative path rel matches any of the patterns.
+func (pp pathPatterns) match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, g := range pp {
+		if g.Match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFile reads the ignore file in the archetype folder dir, skipping
+// blank lines and # comments. A missing file yields no patterns.
+func readIgnoreFile(dir string) (pathPatterns, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ignoreFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var patterns []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		if l := strings.TrimSpace(sc.Text()); l != "" && !strings.HasPrefix(l, "#") {
+			patterns = append(patterns, l)
+		}
+	}
+	return compilePatterns(patterns)
+}
@@ -0,0 +1,189 @@
+package garchetype
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// pluginTimeout bounds every request to a plugin.
+const pluginTimeout = 30 * time.Second
+
+// pluginFuncName matches the valid names of the template functions.
+var pluginFuncName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Methods of the plugin protocol.
+const (
+	pluginDescribe = "describe"
+	pluginCall     = "call"
+)
+
+// pluginRequest is the JSON request a plugin reads from its standard input,
+// one per run.
+type pluginRequest struct {
+	Method   string   `json:"method"`
+	Function string   `json:"function,omitempty"`
+	Args     []string `json:"args,omitempty"`
+}
+
+// pluginResponse is the JSON response a plugin writes to its standard output:
+// the functions it provides to describe, or the result of the call.
+type pluginResponse struct {
+	Functions []struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"functions"`
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+// pluginRegistry holds the template functions of the plugins, by folder, as
+// they're discovered once per process.
+type pluginRegistry struct {
+	mu    sync.Mutex
+	dirs  map[string]bool
+	funcs template.FuncMap
+}
+
+var plugins = &pluginRegistry{}
+
+// defaultPluginsDir returns the plugins folder in the user config folder.
+func defaultPluginsDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, toolName, "plugins")
+}
+
+// load discovers the plugins in dir, once, and registers their functions. The
+// executables of dir are asked to describe their functions, and the problems
+// are given to warn, so a broken plugin doesn't break the generations not
+// using it.
+func (pr *pluginRegistry) load(dir string, warn func(msg string)) {
+	if dir == "" {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.dirs[dir] {
+		return
+	}
+	if pr.dirs == nil {
+		pr.dirs, pr.funcs = make(map[string]bool), make(template.FuncMap)
+	}
+	pr.dirs[dir] = true
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			warn(fmt.Sprintf("Could not read the plugins folder: %v", err))
+		}
+		return
+	}
+	builtin := sprig.TxtFuncMap()
+	maps.Copy(builtin, projectFuncs(""))
+	for _, e := range entries {
+		exe := filepath.Join(dir, e.Name())
+		if !isExecutable(exe) {
+			continue
+		}
+		res, err := callPlugin(exe, pluginRequest{Method: pluginDescribe})
+		if err != nil {
+			warn(fmt.Sprintf("Skipping the %s plugin: %v", e.Name(), err))
+			continue
+		}
+		for _, f := range res.Functions {
+			_, taken := pr.funcs[f.Name]
+			switch _, ok := builtin[f.Name]; {
+			case !pluginFuncName.MatchString(f.Name):
+				warn(fmt.Sprintf("Skipping the %q function of the %s plugin, it's not a valid name.", f.Name, e.Name()))
+			case ok || taken:
+				warn(fmt.Sprintf("Skipping the %s function of the %s plugin, it's defined already.", f.Name, e.Name()))
+			default:
+				pr.funcs[f.Name] = pluginFunc(exe, f.Name)
+			}
+		}
+	}
+}
+
+// templateFuncs returns the functions of the loaded plugins.
+func (pr *pluginRegistry) templateFuncs() template.FuncMap {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	return maps.Clone(pr.funcs)
+}
+
+// pluginFunc returns the template function calling the function name of the
+// plugin exe with the arguments formatted as strings.
+func pluginFunc(exe, name string) func(args ...any) (string, error) {
+	return func(args ...any) (string, error) {
+		req := pluginRequest{Method: pluginCall, Function: name, Args: make([]string, len(args))}
+		for i, a := range args {
+			req.Args[i] = fmt.Sprint(a)
+		}
+		res, err := callPlugin(exe, req)
+		if err != nil {
+			return "", fmt.Errorf("%s plugin function: %w", name, err)
+		}
+		return res.Result, nil
+	}
+}
+
+// callPlugin runs the plugin exe with the JSON of req as its standard input and
+// decodes its response. The plugin fails by exiting with a non-zero status, its
+// standard error being the message, or by responding with an error.
+func callPlugin(exe string, req pluginRequest) (*pluginResponse, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, exe) //nolint:gosec // The plugins are installed by the user.
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	res := &pluginResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), res); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if res.Error != "" {
+		return nil, errors.New(res.Error)
+	}
+	return res, nil
+}
+
+// isExecutable reports whether the file f is an executable, by its mode, or
+// its extension on Windows.
+func isExecutable(f string) bool {
+	info, err := os.Stat(f)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return slices.Contains([]string{".exe", ".bat", ".cmd"}, strings.ToLower(filepath.Ext(f)))
+	}
+	return info.Mode().Perm()&0o111 != 0
+}
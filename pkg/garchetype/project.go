@@ -0,0 +1,67 @@
+package garchetype
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// projectConfigFile is the name of the project configuration file, looked up
+// in the destination folder.
+const projectConfigFile = ".garchetype.yaml"
+
+// projectConfig holds the project settings shared by every generation.
+type projectConfig struct {
+	// Vars are injected into every generation, e.g. team name, registry URL or
+	// base import path.
+	Vars map[string]string `yaml:"vars"`
+	// History enables the audit log of the generations.
+	History historyConfig `yaml:"history"`
+	// Sources are more archetypes sources, listed with AllSources.
+	Sources []Source `yaml:"sources"`
+	// Provenance enables the provenance headers of every generation, see
+	// Options.
+	Provenance bool `yaml:"provenance"`
+	// License sets the license header of the generated files.
+	License licenseConfig `yaml:"license"`
+	// TransformationAliases are the short names of the transformations of
+	// any archetype, on top of the ones of the archetype metadata.
+	TransformationAliases map[string]string `yaml:"transformationAliases"`
+	// Runs sets the retention of the run reports.
+	Runs runsConfig `yaml:"runs"`
+	// Hooks restricts the commands the archetype hooks may run.
+	Hooks hooksConfig `yaml:"hooks"`
+	// PullRequest templates the pull requests opened after adding features.
+	PullRequest pullRequestConfig `yaml:"pullRequest"`
+	// Limits bounds the archetypes generated from.
+	Limits limitsConfig `yaml:"limits"`
+}
+
+// transformation returns the transformation aliased by name, or name.
+func (pc *projectConfig) transformation(name string) string {
+	if t, ok := pc.TransformationAliases[name]; ok {
+		return t
+	}
+	return name
+}
+
+// readProjectConfig reads the project configuration file in dir. A missing
+// file yields an empty configuration.
+func readProjectConfig(dir string) (*projectConfig, error) {
+	pc := &projectConfig{}
+	f := filepath.Join(dir, projectConfigFile)
+	b, err := os.ReadFile(f)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return pc, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, pc); err != nil {
+		return nil, fmt.Errorf("invalid project config %s: %w", f, err)
+	}
+	return pc, nil
+}
@@ -0,0 +1,93 @@
+package garchetype
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// maxProjectFileSize bounds the project files the templates read.
+const maxProjectFileSize = 1 << 20
+
+// projectFuncs returns the template functions reading the files of the
+// destination folder dir, so the archetypes can slot code into the existing
+// ones, e.g. a routes list. They're read-only and confined to dir, and fail
+// without it, e.g. in the pull request templates.
+func projectFuncs(dir string) template.FuncMap {
+	return template.FuncMap{
+		"fileExists": func(p string) (bool, error) {
+			f, err := projectFile(dir, p)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return false, nil
+				}
+				return false, err
+			}
+			fi, err := os.Stat(f)
+			return err == nil && fi.Mode().IsRegular(), nil
+		},
+		"readFile": func(p string) (string, error) {
+			return readProjectFile(dir, p)
+		},
+		"readLines": func(p string, n int) ([]string, error) {
+			s, err := readProjectFile(dir, p)
+			if err != nil {
+				return nil, err
+			}
+			lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+			if s == "" {
+				lines = nil
+			}
+			if n > 0 && n < len(lines) {
+				lines = lines[:n]
+			}
+			return lines, nil
+		},
+	}
+}
+
+// projectFile returns the path of the slash-separated path p of the
+// destination folder dir, with the symbolic links resolved, failing if it
+// leaves the folder.
+func projectFile(dir, p string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("%s: the project files are only readable by the archetype templates", p)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(p)) {
+		return "", fmt.Errorf("%s: not a path within the destination folder", p)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	f, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(p)))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, f); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s: links outside the destination folder", p)
+	}
+	return f, nil
+}
+
+// readProjectFile returns the contents of the path p of the destination folder
+// dir.
+func readProjectFile(dir, p string) (string, error) {
+	f, err := projectFile(dir, p)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(f)
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() || fi.Size() > maxProjectFileSize {
+		return "", fmt.Errorf("%s: not a regular file up to %s", p, FormatSize(maxProjectFileSize))
+	}
+	b, err := os.ReadFile(f)
+	return string(b), err
+}
@@ -0,0 +1,144 @@
+package garchetype
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// commentStyle is the comment syntax of a file type, a line comment or a block
+// comment with its closing.
+type commentStyle struct {
+	open, close string
+}
+
+var (
+	slashComment = commentStyle{open: "//"}
+	hashComment  = commentStyle{open: "#"}
+	dashComment  = commentStyle{open: "--"}
+	cssComment   = commentStyle{open: "/*", close: "*/"}
+	htmlComment  = commentStyle{open: "<!--", close: "-->"}
+)
+
+// commentStyles are the comment syntaxes by file extension, the files of the
+// other types don't get the provenance header, e.g. JSON.
+var commentStyles = map[string]commentStyle{
+	".go":    slashComment,
+	".js":    slashComment,
+	".jsx":   slashComment,
+	".ts":    slashComment,
+	".tsx":   slashComment,
+	".java":  slashComment,
+	".kt":    slashComment,
+	".rs":    slashComment,
+	".c":     slashComment,
+	".h":     slashComment,
+	".cc":    slashComment,
+	".cpp":   slashComment,
+	".cs":    slashComment,
+	".swift": slashComment,
+	".scala": slashComment,
+	".proto": slashComment,
+	".dart":  slashComment,
+
+	".py":   hashComment,
+	".rb":   hashComment,
+	".sh":   hashComment,
+	".bash": hashComment,
+	".yaml": hashComment,
+	".yml":  hashComment,
+	".toml": hashComment,
+	".tf":   hashComment,
+	".mk":   hashComment,
+
+	".sql": dashComment,
+	".lua": dashComment,
+
+	".css":  cssComment,
+	".scss": cssComment,
+
+	".html": htmlComment,
+	".xml":  htmlComment,
+	".md":   htmlComment,
+	".vue":  htmlComment,
+}
+
+// commentStylesByName are the comment syntaxes of the files known by their
+// name.
+var commentStylesByName = map[string]commentStyle{
+	"Makefile":   hashComment,
+	"Dockerfile": hashComment,
+}
+
+// provenanceHeader returns the text of the header telling which archetype, and
+// its version if any, generated a file on now.
+func provenanceHeader(archetype, version string, now time.Time) string {
+	if version != "" {
+		archetype += " " + version
+	}
+	return fmt.Sprintf("Generated by %s from the %s archetype on %s.", toolName, archetype, now.Format(time.RFC3339))
+}
+
+// addHeaders prepends the headers, skipping the empty ones, as comments to the
+// rendered file p, if its type has a known comment syntax. A shebang or XML
+// declaration stays first, and a header the file already has isn't repeated.
+func addHeaders(p string, headers ...string) error {
+	cs, ok := commentStylesByName[filepath.Base(p)]
+	if !ok {
+		if cs, ok = commentStyles[strings.ToLower(filepath.Ext(p))]; !ok {
+			return nil
+		}
+	}
+	fi, err := os.Lstat(p)
+	if err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	if isBinary(p, b) {
+		return nil
+	}
+	var comments []byte
+	for _, h := range headers {
+		if c := cs.comment(h); h != "" && !bytes.Contains(b, []byte(c)) {
+			comments = append(comments, c+"\n\n"...)
+		}
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	var prologue []byte
+	if bytes.HasPrefix(b, []byte("#!")) || bytes.HasPrefix(b, []byte("<?xml")) {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			prologue, b = b[:i+1], b[i+1:]
+		} else {
+			prologue, b = append(b, '\n'), nil
+		}
+	}
+	out := make([]byte, 0, len(prologue)+len(comments)+len(b))
+	out = append(out, prologue...)
+	out = append(out, comments...)
+	out = append(out, b...)
+	return os.WriteFile(p, out, fi.Mode().Perm())
+}
+
+// comment returns the text as a comment of the cs syntax: a line comment per
+// line, or a block comment, spanning its own lines when the text does.
+func (cs commentStyle) comment(text string) string {
+	lines := strings.Split(text, "\n")
+	if cs.close == "" {
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(cs.open+" "+l, " ")
+		}
+		return strings.Join(lines, "\n")
+	}
+	if len(lines) == 1 {
+		return cs.open + " " + text + " " + cs.close
+	}
+	return cs.open + "\n" + text + "\n" + cs.close
+}
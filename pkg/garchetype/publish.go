@@ -0,0 +1,223 @@
+package garchetype
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PublishOptions are the settings of Publish.
+type PublishOptions struct {
+	// Version of the package, by default the one of the archetype metadata.
+	Version string
+	// OutDir is the folder the package is written into, the current one by
+	// default.
+	OutDir string
+	// Registry is the base URL the package is uploaded to, as
+	// <Registry>/<archetype>/<version>.tar.gz, none by default.
+	Registry string
+	// RegistryToken is the bearer token of the registry, if it needs one.
+	RegistryToken string
+}
+
+// Package describes a published archetype package.
+type Package struct {
+	Archetype string
+	Version   string
+	// File is the path of the package tarball.
+	File string
+	// URL is where the package was uploaded, empty without registry.
+	URL string
+}
+
+// Publish packages the Archetype of the source, its templates, transformations
+// and metadata, into a versioned tarball and uploads it to the registry, if any.
+// The archetype is validated first, and its golden cases must pass, see Test.
+// The tarball is reproducible: the same archetype files make the same bytes.
+func Publish(ctx context.Context, opts Options, po PublishOptions) (*Package, error) {
+	o := opts.withDefaults()
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := readProjectConfig(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateArchetype(ad, pc); err != nil {
+		return nil, fmt.Errorf("invalid archetype %q: %w", o.Archetype, err)
+	}
+	if err := o.checkGoldenCases(ctx); err != nil {
+		return nil, err
+	}
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{Archetype: o.Archetype, Version: cmp.Or(po.Version, md.Version)}
+	if p.Version == "" {
+		return nil, WithHint(fmt.Errorf("undefined version of the %q archetype", o.Archetype), "archetype-metadata",
+			"Set the version in the %s file, or pass %s", archetypeMetadataFile, optVersion)
+	}
+	name := strings.ReplaceAll(o.Archetype, "/", "-")
+	p.File = filepath.Join(cmp.Or(po.OutDir, "."), fmt.Sprintf("%s-%s.tar.gz", name, p.Version))
+	stop := o.Hooks.busy("Packaging " + o.Archetype)
+	err = writePackage(p.File, ad, name)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+	if po.Registry == "" {
+		return p, nil
+	}
+	p.URL = fmt.Sprintf("%s/%s/%s.tar.gz", strings.TrimSuffix(po.Registry, "/"), name, p.Version)
+	stop = o.Hooks.busy("Uploading " + p.URL)
+	err = upload(ctx, p.URL, p.File, po.RegistryToken)
+	stop()
+	if err != nil {
+		return nil, WithHint(fmt.Errorf("could not upload %s: %w", p.File, err), "publishing",
+			"Check the %s URL and the %s", optRegistry, optRegistryToken)
+	}
+	return p, nil
+}
+
+// checkGoldenCases runs the golden cases of the Archetype, if it has any, and
+// fails if one of them does.
+func (o *Options) checkGoldenCases(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(o.SourceDir, goldenFolder, filepath.FromSlash(o.Archetype))); err != nil {
+		return nil
+	}
+	tcs, err := Test(ctx, *o, TestOptions{})
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, tc := range tcs {
+		if tc.Failed() {
+			failed = append(failed, tc.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return WithHint(fmt.Errorf("golden cases of the %q archetype failing: %s", o.Archetype, strings.Join(failed, ", ")), "publishing",
+			"Run '%s test -a %s' to see their diffs, and fix the archetype or update the golden output", toolName, o.Archetype)
+	}
+	return nil
+}
+
+// packageTime is the modification time of the package entries, so the
+// packages are reproducible.
+var packageTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// writePackage writes the gzipped tarball file with the contents of the
+// archetype folder ad, under the prefix folder. The entries are written in
+// path order, owned by root, with the packageTime and the permissions
+// normalized, so the tarball only depends on the archetype files.
+func writePackage(file, ad, prefix string) (err error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(file)
+		}
+	}()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	err = filepath.WalkDir(ad, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ad, p)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		h, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		h.Name = path.Join(prefix, filepath.ToSlash(rel))
+		if d.IsDir() {
+			h.Name += "/"
+		}
+		h.ModTime, h.AccessTime, h.ChangeTime = packageTime, time.Time{}, time.Time{}
+		h.Uid, h.Gid, h.Uname, h.Gname = 0, 0, "", ""
+		h.PAXRecords, h.Format = nil, tar.FormatUSTAR
+		switch {
+		case d.IsDir() || fi.Mode()&0o111 != 0:
+			h.Mode = 0o755
+		case fi.Mode().IsRegular():
+			h.Mode = 0o644
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// upload puts the file at url, with the bearer token if any.
+func upload(ctx context.Context, url, file, token string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(res.Status)
+	}
+	return nil
+}
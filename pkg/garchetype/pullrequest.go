@@ -0,0 +1,254 @@
+package garchetype
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+// Default templates of the pull requests, executed with the pullRequestData.
+const (
+	defaultPullRequestTitle = `Add the {{.Feature}} feature`
+	defaultPullRequestBody  = `Scaffolded by garchetype with the {{.Archetype}} archetype and its {{.Transformation}} transformation.
+{{range .Reports}}
+### {{.Destination}}
+
+{{.Summary.Created}} files created, {{.Summary.Modified}} modified, {{.Summary.LinesAdded}} lines added, {{.Summary.LinesRemoved}} removed.
+{{range .Files}}
+- ` + "`{{.}}`" + `{{end}}
+{{end}}`
+)
+
+// pullRequestBranchPrefix prefixes the branches of the pull requests.
+const pullRequestBranchPrefix = toolName + "/"
+
+// PullRequestOptions are the settings of OpenPullRequest.
+type PullRequestOptions struct {
+	// Title and Body are the templates of the pull request, executed with the
+	// first report and all of them as .Reports, by default the ones of the
+	// project config.
+	Title string
+	Body  string
+	// Token authenticates with the API of the host, by default the
+	// GITHUB_TOKEN, or GH_TOKEN, for GitHub and GITLAB_TOKEN for GitLab.
+	Token string
+}
+
+// PullRequest describes a pull request, or a GitLab merge request.
+type PullRequest struct {
+	Branch string `json:"branch"`
+	Base   string `json:"base"`
+	URL    string `json:"url"`
+}
+
+// pullRequestConfig holds the templates of the pull requests of the project,
+// see PullRequestOptions.
+type pullRequestConfig struct {
+	Title string `yaml:"title"`
+	Body  string `yaml:"body"`
+}
+
+// pullRequestData is what the pull request templates are executed with. The
+// destinations of the reports are relative to the project folder.
+type pullRequestData struct {
+	*Report
+	Reports []*Report
+}
+
+// OpenPullRequest commits the files generated by the rs reports, along with the
+// feature registry, to a new branch, pushes it to the remote and opens a pull
+// request against the current branch, a merge request on GitLab. It's meant
+// to run right after adding the feature to a clean repository.
+func OpenPullRequest(ctx context.Context, opts Options, po PullRequestOptions, rs []*Report) (*PullRequest, error) {
+	o := opts.withDefaults()
+	if len(rs) == 0 {
+		return nil, errors.New("nothing to open a pull request for")
+	}
+	if o.NoGit {
+		return nil, WithHint(errors.New("a pull request needs the project under git"), "pull-requests",
+			"Run it without %s", optNoGit)
+	}
+	root, err := filepath.Abs(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	pc, err := readProjectConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	gs, err := gitstat.GetContext(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if gs.RemoteURL == "" {
+		return nil, WithHint(errors.New("the repository has no remote to push to"), "pull-requests",
+			"Add the origin remote with 'git remote add origin <url>'")
+	}
+	pr := &PullRequest{Branch: pullRequestBranchPrefix + rs[0].Feature, Base: cmp.Or(gs.Branch, gs.DefaultBranch)}
+	if pr.Base == "" {
+		return nil, WithHint(errors.New("unknown base branch of the pull request"), "pull-requests",
+			"Check out the branch the pull request should target first")
+	}
+	data := pullRequestData{Reports: make([]*Report, len(rs))}
+	paths := []string{featuresFile}
+	if pc.History.Enabled {
+		paths = append(paths, cmp.Or(pc.History.File, defaultHistoryFile))
+	}
+	for i, r := range rs {
+		c := *r
+		rel, err := filepath.Rel(root, r.Destination)
+		if err != nil {
+			return nil, err
+		}
+		c.Destination = filepath.ToSlash(rel)
+		for _, f := range r.Files {
+			paths = append(paths, filepath.Join(rel, filepath.FromSlash(f)))
+		}
+		data.Reports[i] = &c
+	}
+	data.Report = data.Reports[0]
+	title, err := executePullRequestTemplate("title", cmp.Or(po.Title, pc.PullRequest.Title, defaultPullRequestTitle), data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := executePullRequestTemplate("body", cmp.Or(po.Body, pc.PullRequest.Body, defaultPullRequestBody), data)
+	if err != nil {
+		return nil, err
+	}
+	title = strings.TrimSpace(title)
+	for _, args := range [][]string{
+		{"switch", "--create", pr.Branch},
+		append([]string{"add", "--"}, paths...),
+		{"commit", "--message", title},
+	} {
+		if err := runGit(ctx, root, args...); err != nil {
+			return nil, err
+		}
+	}
+	stop := o.Hooks.busy("Pushing " + pr.Branch)
+	err = runGit(ctx, root, "push", gs.RemoteURL, "HEAD:refs/heads/"+pr.Branch)
+	stop()
+	if err != nil {
+		return nil, WithHint(err, "pull-requests", "Check that you can push to %s", gs.RemoteURL)
+	}
+	stop = o.Hooks.busy("Opening the pull request")
+	pr.URL, err = createPullRequest(ctx, gs.RemoteURL, po.Token, pr, title, body)
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("could not open the pull request of the pushed %s branch: %w", pr.Branch, err)
+	}
+	return pr, nil
+}
+
+func executePullRequestTemplate(name, text string, data pullRequestData) (string, error) {
+	t, err := template.New(name).Funcs(templateFuncs()).Parse(text)
+	if err != nil {
+		return "", WithHint(fmt.Errorf("invalid pull request %s template: %w", name, err), "project-configuration",
+			"Fix the pullRequest settings of the %s file", projectConfigFile)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// runGit runs the git command with args in dir, failing with the first line
+// of its standard error.
+func runGit(ctx context.Context, dir string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		return fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+	}
+	return nil
+}
+
+// createPullRequest opens the pr pull request on the host of the remote repo
+// URL, and returns its web URL.
+func createPullRequest(ctx context.Context, repo, token string, pr *PullRequest, title, body string) (string, error) {
+	ep, err := transport.NewEndpoint(repo)
+	if err != nil {
+		return "", err
+	}
+	project := strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git")
+	var api string
+	var req any
+	switch {
+	case strings.Contains(ep.Host, "github"):
+		api = "https://api.github.com/repos/" + project + "/pulls"
+		if ep.Host != "github.com" { // GitHub Enterprise Server.
+			api = fmt.Sprintf("https://%s/api/v3/repos/%s/pulls", ep.Host, project)
+		}
+		token = cmp.Or(token, os.Getenv("GITHUB_TOKEN"), os.Getenv("GH_TOKEN"))
+		req = map[string]string{"title": title, "body": body, "head": pr.Branch, "base": pr.Base}
+	case strings.Contains(ep.Host, "gitlab"):
+		api = fmt.Sprintf("https://%s/api/v4/projects/%s/merge_requests", ep.Host, url.PathEscape(project))
+		token = cmp.Or(token, os.Getenv("GITLAB_TOKEN"))
+		req = map[string]string{"title": title, "description": body, "source_branch": pr.Branch, "target_branch": pr.Base}
+	default:
+		return "", WithHint(fmt.Errorf("can't open pull requests on %s, only on GitHub and GitLab", repo), "pull-requests",
+			"Open the pull request of the pushed branch yourself")
+	}
+	if token == "" {
+		return "", WithHint(fmt.Errorf("no token to open the pull request on %s", ep.Host), "pull-requests",
+			"Set GARCHETYPE_PR_TOKEN, or GITHUB_TOKEN or GITLAB_TOKEN depending on the host")
+	}
+	var res struct {
+		HTMLURL string `json:"html_url"` // GitHub.
+		WebURL  string `json:"web_url"`  // GitLab.
+	}
+	if err := postAPI(ctx, api, token, req, &res); err != nil {
+		return "", err
+	}
+	return cmp.Or(res.HTMLURL, res.WebURL), nil
+}
+
+// postAPI posts the JSON of v to the url of a host API with the bearer token,
+// decoding the response into res.
+func postAPI(ctx context.Context, url, token string, v, res any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Message any `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if e.Message != nil {
+			return fmt.Errorf("POST %s: %s: %v", url, resp.Status, e.Message)
+		}
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
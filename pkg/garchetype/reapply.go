@@ -0,0 +1,51 @@
+package garchetype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+)
+
+// Reapply runs the Transformation of the archetype of the applied feature
+// FeatureName against it, to enhance the feature incrementally, e.g. adding
+// metrics to a service generated before. The archetype, its version, the
+// module folder and the input values are the ones recorded by the last
+// registry entry of the feature, the VarFile and Inputs ones taking
+// precedence. The Module picks the feature among the ones of the same name.
+// The generation is recorded as another entry of the registry.
+func Reapply(ctx context.Context, opts Options) (*Report, error) {
+	if opts.FeatureName == "" {
+		return nil, WithHint(errors.New("feature name is required"), "templates",
+			"Pass %s with the name of the feature to reapply the transformation to", optFeatureName)
+	}
+	if opts.Transformation == "" {
+		return nil, WithHint(errors.New("transformation is required"), "templates",
+			"Pass %s with the transformation to apply, run '%s list' to see the ones of the archetype", optTransformation, toolName)
+	}
+	fr, err := readFeatureRegistry(opts.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	module := filepath.ToSlash(filepath.Clean(opts.Module))
+	var f *Feature
+	for i := len(fr.Features) - 1; i >= 0 && f == nil; i-- {
+		if g := &fr.Features[i]; g.Name == opts.FeatureName && (opts.Module == "" || g.Destination == module) {
+			f = g
+		}
+	}
+	if f == nil {
+		return nil, WithHint(fmt.Errorf("feature %q not found in the registry", opts.FeatureName), "archetype-metadata",
+			"Run '%s features' to see the applied features", toolName)
+	}
+	o := opts
+	o.Archetype, o.Module = f.Archetype, filepath.FromSlash(f.Destination)
+	if f.Constraint != "" && f.Version != "" {
+		o.Archetype += "@=" + f.Version // The version the feature was generated with.
+	}
+	o.recorded = maps.Clone(f.Inputs)
+	maps.DeleteFunc(o.recorded, func(_, v string) bool { return v == maskedSecret }) // Asked again.
+	o.reapply = true
+	return Add(ctx, o)
+}
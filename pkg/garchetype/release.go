@@ -0,0 +1,243 @@
+package garchetype
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// githubAPI is the base URL of the GitHub API the releases are read from.
+const githubAPI = "https://api.github.com"
+
+// releaseChecksums is the release asset with the SHA-256 checksums of the
+// archetype packages, in the sha256sum format.
+const releaseChecksums = "checksums.txt"
+
+// packageExt is the extension of the archetype packages written by Publish.
+const packageExt = ".tar.gz"
+
+// githubRelease is the subset of the GitHub release used to download its
+// archetype packages.
+type githubRelease struct {
+	TagName string `json:"tag_name"` //nolint:tagliatelle // GitHub API.
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"assets"`
+}
+
+// parseRelease splits the org/repo@tag release of a source.
+func parseRelease(release string) (repo, tag string, err error) {
+	repo, tag, ok := strings.Cut(release, "@")
+	if !ok || tag == "" || strings.Count(repo, "/") != 1 || strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") {
+		return "", "", WithHint(fmt.Errorf("invalid source release %q", release), "publishing",
+			"Pass %s as org/repo@tag, e.g. acme/archetypes@v2.0.0", optSourceRelease)
+	}
+	return repo, tag, nil
+}
+
+// releaseDir returns the folder the packages of the release are downloaded
+// into, in the user cache. The releases don't change, so they're downloaded
+// once.
+func releaseDir(release string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	repo, tag, _ := strings.Cut(release, "@")
+	return filepath.Join(dir, toolName, "releases", filepath.FromSlash(repo), tag)
+}
+
+// downloadRelease downloads the archetype packages attached to the GitHub
+// release of the source, the assets written by Publish, checks their integrity
+// against the checksums asset and extracts them into the archetypes folder of
+// the source folder. The checksums come from the same release, so they catch
+// corrupted downloads but don't authenticate the packages. The GITHUB_TOKEN, if any, gives access to private
+// repositories.
+func downloadRelease(ctx context.Context, o *Options) error {
+	repo, tag, err := parseRelease(o.SourceRelease)
+	if err != nil {
+		return err
+	}
+	stop := o.Hooks.busy("Downloading " + o.SourceRelease)
+	defer stop()
+	r := &githubRelease{}
+	b, err := githubGet(ctx, fmt.Sprintf("%s/repos/%s/releases/tags/%s", githubAPI, repo, tag), "application/json")
+	if err != nil {
+		return WithHint(fmt.Errorf("could not get the %s release: %w", o.SourceRelease, err), "publishing",
+			"Check the %s, and set GITHUB_TOKEN for the private repositories", optSourceRelease)
+	}
+	if err := json.Unmarshal(b, r); err != nil {
+		return fmt.Errorf("invalid release %s: %w", o.SourceRelease, err)
+	}
+	assets := make(map[string]string, len(r.Assets))
+	for _, a := range r.Assets {
+		assets[a.Name] = a.URL
+	}
+	u, ok := assets[releaseChecksums]
+	if !ok {
+		return WithHint(fmt.Errorf("release %s has no %s asset", o.SourceRelease, releaseChecksums), "publishing",
+			"Attach the SHA-256 checksums of the packages to the release, e.g. with 'sha256sum *%s > %s'", packageExt, releaseChecksums)
+	}
+	sums, err := githubGet(ctx, u, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(o.SourceDir), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(o.SourceDir), partialPattern(o.SourceDir))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, filepath.SplitList(o.ArchetypesFolder)[0])
+	n := 0
+	for _, a := range r.Assets {
+		if !strings.HasSuffix(a.Name, packageExt) {
+			continue
+		}
+		want, err := packageChecksum(sums, a.Name)
+		if err != nil {
+			return err
+		}
+		p, err := githubGet(ctx, a.URL, "application/octet-stream")
+		if err != nil {
+			return err
+		}
+		if got := sha256.Sum256(p); hex.EncodeToString(got[:]) != want {
+			return fmt.Errorf("checksum mismatch for %s of the %s release", a.Name, o.SourceRelease)
+		}
+		if err := extractPackage(p, dir); err != nil {
+			return fmt.Errorf("invalid package %s: %w", a.Name, err)
+		}
+		n++
+	}
+	if n == 0 {
+		return WithHint(fmt.Errorf("release %s has no archetype packages", o.SourceRelease), "publishing",
+			"Attach the packages of '%s publish' to the release", toolName)
+	}
+	// Moved at once, so an interrupted download isn't mistaken for a release.
+	return os.Rename(tmp, o.SourceDir)
+}
+
+// githubGet returns the body of the GitHub url, accepting the accept media
+// type.
+func githubGet(ctx context.Context, url, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// packageChecksum returns the SHA-256 checksum of the file name in sums.
+func packageChecksum(sums []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(sums))
+	for s.Scan() {
+		sum, file, ok := strings.Cut(s.Text(), "  ")
+		if ok && strings.TrimPrefix(file, "*") == name {
+			return strings.ToLower(sum), nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+// extractPackage extracts the gzipped tarball p of an archetype package into
+// dir. The entries escaping dir are rejected.
+func extractPackage(p []byte, dir string) error {
+	zr, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(h.Name)) {
+			return fmt.Errorf("entry outside the package: %s", h.Name)
+		}
+		if throughSymlink(dir, filepath.FromSlash(h.Name)) {
+			return fmt.Errorf("entry through a link: %s", h.Name)
+		}
+		f := filepath.Join(dir, filepath.FromSlash(h.Name))
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(f, 0o755)
+		case tar.TypeReg:
+			err = writeEntry(f, tr, h.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(h.Linkname)
+			if filepath.IsAbs(link) || strings.HasPrefix(h.Linkname, "/") ||
+				!filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(h.Name)), link)) {
+				return fmt.Errorf("link outside the package: %s", h.Name)
+			}
+			if err = os.MkdirAll(filepath.Dir(f), 0o755); err == nil {
+				err = os.Symlink(h.Linkname, f)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// throughSymlink reports whether the local path name of the dir folder, or
+// one of its parent folders, is a symbolic link extracted already, so writing
+// it would follow the link.
+func throughSymlink(dir, name string) bool {
+	for p := name; p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+		if fi, err := os.Lstat(filepath.Join(dir, p)); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEntry writes the contents of r to the file f with the perm permissions.
+func writeEntry(f string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+		return err
+	}
+	w, err := os.OpenFile(f, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
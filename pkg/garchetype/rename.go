@@ -0,0 +1,354 @@
+package garchetype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// Rename renames the applied feature FeatureName, of the Module folder if
+// several have its name, to the to name: the case variants of its name are
+// substituted in the contents and the paths of the files its registry entries
+// recorded as created, as whole words, and the entries are updated along with
+// them. The files it only modified, e.g. a routes file, are left alone. The
+// changes are planned first and rolled back if any of them fails. The to name
+// is checked like the Add feature names. The project must be clean unless
+// Force is set, so the changes are easy to review. The returned report lists
+// the changed files.
+func Rename(ctx context.Context, opts Options, to string) (*Report, error) {
+	o := opts.withDefaults()
+	if opts.FeatureName == "" {
+		return nil, WithHint(errors.New("feature name is required"), "archetype-metadata",
+			"Pass %s with the name of the feature to rename", optFeatureName)
+	}
+	if to == "" {
+		return nil, WithHint(errors.New("new feature name is required"), "archetype-metadata",
+			"Pass %s with the new name of the feature", optRenameTo)
+	}
+	root, err := filepath.Abs(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	fr, err := readFeatureRegistry(root)
+	if err != nil {
+		return nil, err
+	}
+	module := filepath.ToSlash(filepath.Clean(opts.Module))
+	var entries []int
+	for i, f := range fr.Features {
+		if f.Name == o.FeatureName && (opts.Module == "" || f.Destination == module) {
+			entries = append(entries, i)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, WithHint(fmt.Errorf("feature %q not found in the registry", o.FeatureName), "archetype-metadata",
+			"Run '%s features' to see the applied features", toolName)
+	}
+	f := &fr.Features[entries[len(entries)-1]]
+	for _, i := range entries {
+		if fr.Features[i].Destination != f.Destination {
+			return nil, WithHint(fmt.Errorf("feature %q is applied to several modules", o.FeatureName), "archetype-metadata",
+				"Pass %s with the module folder of the feature to rename", optModule)
+		}
+	}
+	if err := o.checkNewName(f.Archetype, to); err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(fr.Features, func(g Feature) bool { return g.Name == to && g.Destination == f.Destination }) {
+		return nil, fmt.Errorf("feature %q already exists", to)
+	}
+	if f.Destination != "" && !filepath.IsLocal(filepath.FromSlash(f.Destination)) {
+		return nil, fmt.Errorf("invalid destination %q of the feature in the registry", f.Destination)
+	}
+	gs, err := o.projectStatus(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if gs.Dirty && !o.Force {
+		return nil, WithHint(dirtyError(gs.Files), "archetype-metadata",
+			"Commit or stash your changes first, so the renamed files are easy to review, or pass %s", optForce)
+	}
+	dest := filepath.Join(root, filepath.FromSlash(f.Destination))
+	var files []string
+	created := make(map[string]bool)
+	for _, i := range entries {
+		g := fr.Features[i]
+		for _, p := range g.Files {
+			if !slices.Contains(files, p) {
+				files = append(files, p)
+			}
+		}
+		for _, p := range g.Created {
+			created[p] = true
+		}
+		if g.Created == nil && len(g.Files) > 0 {
+			o.Hooks.warn("The registry doesn't tell the files the feature created, renaming all of them.")
+			for _, p := range g.Files {
+				created[p] = true
+			}
+		}
+	}
+	rn := &renamer{dest: dest, words: renameWords(o.FeatureName, to), warn: o.Hooks.warn}
+	ops, err := rn.plan(ctx, files, created)
+	if err != nil {
+		return nil, err
+	}
+	if err := rn.apply(ops); err != nil {
+		return nil, err
+	}
+	r := &Report{
+		Feature:        to,
+		Archetype:      f.Archetype,
+		Transformation: f.Transformation,
+		Destination:    dest,
+	}
+	moved := make(map[string]string, len(ops))
+	for _, op := range ops {
+		moved[op.rel] = op.nrel
+		r.Files = append(r.Files, op.nrel)
+	}
+	renamed := func(ps []string) []string {
+		if ps == nil {
+			return nil
+		}
+		res := make([]string, 0, len(ps))
+		for _, p := range ps {
+			if np, ok := moved[p]; ok {
+				p = np
+			}
+			res = append(res, p)
+		}
+		return res
+	}
+	for _, i := range entries {
+		g := &fr.Features[i]
+		g.Name, g.Files, g.Created = to, renamed(g.Files), renamed(g.Created)
+	}
+	if err := fr.write(root); err != nil {
+		return nil, multierr.Append(fmt.Errorf("feature registry: %w", err), rn.rollback(ops))
+	}
+	rn.prune(ops)
+	pc, err := readProjectConfig(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := pc.History.append(root, &historyEntry{
+		Time:           time.Now(),
+		User:           currentUser(o.NoGit),
+		Operation:      operationRename,
+		Feature:        to,
+		Archetype:      f.Archetype,
+		Transformation: f.Transformation,
+		Source:         f.Source,
+		Commit:         f.Commit,
+		Files:          r.Files,
+	}); err != nil {
+		return nil, fmt.Errorf("history log: %w", err)
+	}
+	return r, nil
+}
+
+// checkNewName checks the to name of a feature of the archetype like Add
+// does, with the rules of its metadata if the source has it, and the rules of
+// all the feature names otherwise.
+func (o *Options) checkNewName(archetype, to string) error {
+	if o.SourceDir != "" {
+		if ad, err := o.archetypeFolder(archetype); err == nil {
+			if md, err := readArchetypeMetadata(ad); err == nil {
+				return md.validateFeatureName(to)
+			}
+		}
+	}
+	return checkFeatureName(to, "")
+}
+
+// renameOp is the change of a file of the renamed feature, from rel to nrel
+// within the destination, with its contents old replaced by new if set.
+type renameOp struct {
+	rel, nrel string
+	perm      fs.FileMode
+	old, new  []byte
+}
+
+// renamer renames the files of a feature in the dest folder, substituting the
+// words.
+type renamer struct {
+	dest  string
+	words []variant // value is the old word, id the new one
+	warn  func(msg string)
+}
+
+// renameWords returns the case variants of the from feature name, the longest
+// first, along with the ones of the to name replacing them.
+func renameWords(from, to string) []variant {
+	vars := map[string]string{}
+	addCaseVariants(vars, featureNameID, to)
+	var words []variant
+	for _, v := range featureVariants(from) {
+		words = append(words, variant{value: v.value, id: vars[v.id]})
+	}
+	return words
+}
+
+// replace substitutes the words in s where they're whole words: not preceded
+// nor followed by a letter or digit, except across a camel case boundary, so
+// payments is renamed in paymentsHandler but not in paymentsx.
+func (rn *renamer) replace(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		w := slices.IndexFunc(rn.words, func(v variant) bool {
+			return strings.HasPrefix(s[i:], v.value) && wordBoundary(s, i) && wordBoundary(s, i+len(v.value))
+		})
+		if w < 0 {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		b.WriteString(rn.words[w].id)
+		i += len(rn.words[w].value)
+	}
+	return b.String()
+}
+
+// wordBoundary reports whether the position i of s is between two words.
+func wordBoundary(s string, i int) bool {
+	if i == 0 || i == len(s) {
+		return true
+	}
+	prev, next := s[i-1], s[i]
+	if !isAlnum(prev) || !isAlnum(next) {
+		return true
+	}
+	return !isUpper(prev) && isUpper(next) // A camel case hump.
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || isUpper(c) || '0' <= c && c <= '9'
+}
+
+func isUpper(c byte) bool {
+	return 'A' <= c && c <= 'Z'
+}
+
+// plan returns the changes of the created files among files, failing before
+// changing anything if a path is invalid or taken.
+func (rn *renamer) plan(ctx context.Context, files []string, created map[string]bool) ([]renameOp, error) {
+	var ops []renameOp
+	targets := make(map[string]bool)
+	for _, rel := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return nil, fmt.Errorf("invalid file %q of the feature in the registry", rel)
+		}
+		if !created[rel] {
+			continue
+		}
+		nrel := rn.replace(rel)
+		if !filepath.IsLocal(filepath.FromSlash(nrel)) {
+			return nil, fmt.Errorf("renaming %s: invalid path %s", rel, nrel)
+		}
+		p := filepath.Join(rn.dest, filepath.FromSlash(rel))
+		fi, err := os.Lstat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			rn.warn(fmt.Sprintf("The %s file of the feature doesn't exist anymore.", rel))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		op := renameOp{rel: rel, nrel: nrel, perm: fi.Mode().Perm()}
+		if fi.Mode().IsRegular() {
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			if s := rn.replace(string(b)); !isBinary(rel, b) && s != string(b) {
+				op.old, op.new = b, []byte(s)
+			}
+		}
+		if nrel != rel {
+			if _, err := os.Lstat(filepath.Join(rn.dest, filepath.FromSlash(nrel))); err == nil || targets[nrel] {
+				return nil, fmt.Errorf("renaming %s: %s already exists", rel, nrel)
+			}
+			targets[nrel] = true
+		} else if op.new == nil {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// apply makes the changes of ops, undoing the ones made if one fails.
+func (rn *renamer) apply(ops []renameOp) error {
+	for i, op := range ops {
+		if err := rn.change(op); err != nil {
+			return multierr.Append(err, rn.rollback(ops[:i]))
+		}
+	}
+	return nil
+}
+
+// change makes the change of op.
+func (rn *renamer) change(op renameOp) error {
+	p, np := filepath.Join(rn.dest, filepath.FromSlash(op.rel)), filepath.Join(rn.dest, filepath.FromSlash(op.nrel))
+	if op.new != nil {
+		if err := os.WriteFile(p, op.new, op.perm); err != nil {
+			return err
+		}
+	}
+	if p == np {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(np), 0o755)
+	if err == nil {
+		err = os.Rename(p, np)
+	}
+	if err != nil && op.new != nil {
+		err = multierr.Append(err, os.WriteFile(p, op.old, op.perm))
+	}
+	return err
+}
+
+// rollback undoes the changes of ops, the last one first.
+func (rn *renamer) rollback(ops []renameOp) error {
+	var errs error
+	for _, op := range slices.Backward(ops) {
+		p, np := filepath.Join(rn.dest, filepath.FromSlash(op.rel)), filepath.Join(rn.dest, filepath.FromSlash(op.nrel))
+		if p != np {
+			if err := os.Rename(np, p); err != nil {
+				errs = multierr.Append(errs, err)
+				continue
+			}
+		}
+		if op.old != nil {
+			errs = multierr.Append(errs, os.WriteFile(p, op.old, op.perm))
+		}
+	}
+	return errs
+}
+
+// prune removes the folders the moved files of ops left empty, up to the
+// destination.
+func (rn *renamer) prune(ops []renameOp) {
+	for _, op := range ops {
+		if op.rel == op.nrel {
+			continue
+		}
+		for d := filepath.Dir(filepath.Join(rn.dest, filepath.FromSlash(op.rel))); d != rn.dest && strings.HasPrefix(d, rn.dest); d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break
+			}
+		}
+	}
+}
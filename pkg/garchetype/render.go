@@ -0,0 +1,176 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Render renders a single template of the source, given as <archetype>/<path>,
+// with the full variable context of a generation into the destination, and
+// returns its contents. The inputs take precedence over the VarFile values,
+// the declared inputs without a value get their defaults. Nothing is written.
+func Render(ctx context.Context, opts Options, file string, inputs map[string]string) ([]byte, error) {
+	o := opts.withDefaults()
+	archetype, rel, ok := strings.Cut(filepath.ToSlash(file), "/")
+	if !ok || rel == "" {
+		return nil, WithHint(fmt.Errorf("invalid template %q", file), "templates",
+			"Pass the template as <archetype>/<path>, e.g. %s/README.md.tmpl", cmp.Or(archetype, "hello-world"))
+	}
+	ad, err := o.archetypeFolder(archetype)
+	if err != nil {
+		return nil, err
+	}
+	// The nested archetypes take the leading path elements of the namespaces.
+	for {
+		ts, err := getTransformations(ad)
+		if err != nil {
+			return nil, err
+		}
+		ns, r, ok := strings.Cut(rel, "/")
+		if len(ts) > 0 || !ok {
+			break
+		}
+		archetype, rel = archetype+"/"+ns, r
+		if ad, err = o.archetypeFolder(archetype); err != nil {
+			return nil, err
+		}
+	}
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return nil, fmt.Errorf("invalid template path: %s", rel)
+	}
+	b, err := os.ReadFile(filepath.Join(ad, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := readProjectConfig(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	tf, err := getTransformationFile(md.transformation(pc.transformation(o.Transformation)))
+	if err != nil {
+		return nil, err
+	}
+	spec, err := readTransformationSpec(filepath.Join(ad, tf))
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if o.VarFile != "" {
+		if values, err = readVarFile(o.VarFile); err != nil {
+			return nil, err
+		}
+	}
+	maps.Copy(values, inputs)
+	dest, err := filepath.Abs(o.moduleDir())
+	if err != nil {
+		return nil, err
+	}
+	gs, err := o.projectStatus(ctx, o.projectDir())
+	if err != nil {
+		gs = nil
+	}
+	// The same precedence as a generation: system, builtin, project, inputs.
+	vars := systemVars(ad, dest)
+	maps.Copy(vars, builtinVars(o, gs))
+	fid := featureInputID(md, spec)
+	addCaseVariants(vars, fid, o.FeatureName)
+	maps.Copy(vars, pc.Vars)
+	for _, in := range spec.Inputs {
+		if _, ok := values[in.ID]; !ok && in.Default != "" {
+			vars[in.ID] = expandEnv(in.Default)
+		}
+	}
+	maps.Copy(vars, values)
+	if !strings.HasSuffix(rel, templateExt) {
+		return b, nil // Copied verbatim by a generation.
+	}
+	out, err := renderTemplate(rel, b, vars, o.StrictVars)
+	if err != nil {
+		err = templateError(rel, b, err)
+		if o.StrictVars {
+			err = missingVar(err)
+		}
+	}
+	if o.Hooks.Template != nil {
+		t := RenderedTemplate{File: rel, Vars: debugVars(vars, spec.Inputs)}
+		errors.As(err, &t.Err)
+		o.Hooks.Template(t)
+	}
+	return out, err
+}
+
+// Generate renders the Archetype into the dest folder, without the checks and
+// records of Add, e.g. for a scratch workspace or to package the generated
+// files. The module variables come from dest.
+func Generate(ctx context.Context, opts Options, dest string) (*Report, error) {
+	o := opts.withDefaults()
+	if err := syncSource(ctx, o); err != nil {
+		return nil, err
+	}
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return nil, err
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return nil, err
+	}
+	o.Module = dest
+	return o.renderInto(ad, dest, &projectConfig{})
+}
+
+// renderInto renders the archetype in ad into dest, with the pc project
+// settings, and formats the generated files.
+func (o *Options) renderInto(ad, dest string, pc *projectConfig) (*Report, error) {
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return nil, err
+	}
+	if err := md.checkToolVersion(o.Archetype, o.ToolVersion); err != nil {
+		return nil, err
+	}
+	if err := md.validateFeatureName(o.FeatureName); err != nil {
+		return nil, err
+	}
+	eco, err := getEcosystem(md.Ecosystem)
+	if err != nil {
+		return nil, err
+	}
+	t := md.transformation(pc.transformation(o.Transformation))
+	tf, err := getTransformationFile(t)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{
+		Feature:            o.FeatureName,
+		Archetype:          o.Archetype,
+		Transformation:     t,
+		TransformationFile: filepath.Join(ad, tf),
+		Destination:        dest,
+	}
+	if _, err := os.Stat(r.TransformationFile); errors.Is(err, os.ErrNotExist) {
+		return nil, WithHint(fmt.Errorf("unknown transformation %q of the %q archetype", t, o.Archetype), "templates",
+			"Run '%s list' to see the available transformations", toolName)
+	}
+	res, err := o.render(ad, r.TransformationFile, dest, md, builtinVars(o, nil), pc)
+	if err != nil {
+		return nil, err
+	}
+	r.Files, r.Summary = res.Files, res.Summary
+	if md.Ecosystem != "" && !o.NoFormat {
+		eol, _ := o.eol(md) // Checked by the generation.
+		if _, err := eco.format(dest, res.Files, eol); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,81 @@
+package garchetype
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runsFolder holds the run reports, relative to the project folder. It's
+// ignored by git.
+const runsFolder = ".garchetype/runs"
+
+// defaultRunsKeep is the number of run reports kept by default.
+const defaultRunsKeep = 20
+
+// runsConfig sets the retention of the run reports.
+type runsConfig struct {
+	// Keep is the number of latest run reports kept, 20 by default.
+	Keep int `yaml:"keep"`
+	// Disabled stops writing the run reports.
+	Disabled bool `yaml:"disabled"`
+}
+
+// runReport is the full report of a generation, written for later inspection.
+type runReport struct {
+	Time            time.Time         `yaml:"time"`
+	User            string            `yaml:"user"`
+	Feature         string            `yaml:"feature"`
+	Archetype       string            `yaml:"archetype"`
+	Transformation  string            `yaml:"transformation"`
+	Source          string            `yaml:"source"`
+	Commit          string            `yaml:"commit,omitempty"` // archetype source commit
+	Destination     string            `yaml:"destination"`
+	Inputs          map[string]string `yaml:"inputs,omitempty"`
+	Files           []string          `yaml:"files"`
+	Summary         Summary           `yaml:"summary"`
+	FormatterOutput string            `yaml:"formatterOutput,omitempty"`
+}
+
+// write writes the r report into the runs folder of the project in dir, named
+// after its time, unless disabled, and removes the oldest reports beyond the
+// retention.
+func (rc runsConfig) write(dir string, r *runReport) error {
+	if rc.Disabled {
+		return nil
+	}
+	runs := filepath.Join(dir, runsFolder)
+	ignore := filepath.Join(runs, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		if err := writeFile(ignore, []byte("*\n"), 0o644); err != nil { //nolint:mnd // Standard permissions.
+			return err
+		}
+	}
+	name := r.Time.UTC().Format("2006-01-02T15-04-05.000000000Z") + ".yaml"
+	if err := writeYAML(filepath.Join(runs, name), r); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(runs)
+	if err != nil {
+		return err
+	}
+	var reports []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".yaml") {
+			reports = append(reports, e.Name())
+		}
+	}
+	slices.Sort(reports) // Oldest first.
+	keep := rc.Keep
+	if keep <= 0 {
+		keep = defaultRunsKeep
+	}
+	for _, f := range reports[:max(len(reports)-keep, 0)] {
+		if err := os.Remove(filepath.Join(runs, f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
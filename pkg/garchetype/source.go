@@ -0,0 +1,235 @@
+package garchetype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"go.uber.org/multierr"
+)
+
+// Remote and branch of the archetypes source clones.
+const (
+	sourceRemote = "origin"
+	sourceBranch = "main"
+)
+
+// maxParallelSyncs bounds the sources synced at once.
+const maxParallelSyncs = 4
+
+// syncSources syncs the sources concurrently, see syncSource. The errors of all
+// of them are returned together.
+func syncSources(ctx context.Context, o *Options, sources []Source) error {
+	if len(sources) == 1 {
+		so := *o
+		so.SourceDir, so.SourceRepo, so.SourceRelease = sources[0].Dir, sources[0].Repo, sources[0].Release
+		so.SourceAuth = sources[0].Auth
+		return syncSource(ctx, &so)
+	}
+	stop := o.Hooks.busy(fmt.Sprintf("Syncing %d sources", len(sources)))
+	defer stop()
+	warns := make([][]string, len(sources)) // Reported in the order of the sources.
+	errs := make([]error, len(sources))
+	sem := make(chan struct{}, maxParallelSyncs)
+	var wg sync.WaitGroup
+	for i, s := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			so := *o
+			so.SourceDir, so.SourceRepo, so.SourceRelease = s.Dir, s.Repo, s.Release
+			so.Hooks = Hooks{Warn: func(msg string) { warns[i] = append(warns[i], msg) }}
+			so.SourceAuth = s.Auth
+			if err := syncSource(ctx, &so); err != nil {
+				errs[i] = fmt.Errorf("source %s: %w", s.Dir, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, ws := range warns {
+		for _, w := range ws {
+			o.Hooks.warn(w)
+		}
+	}
+	return multierr.Combine(errs...)
+}
+
+// syncSource makes the archetypes source available, cloning the source
+// repository if the source folder doesn't exist, or pulling the latest changes
+// otherwise. The release sources are downloaded once. A source folder that isn't
+// a repository, or has no remote, is used as is. The folders cloned or
+// downloaded are recorded in the user cache, see PruneCache.
+func syncSource(ctx context.Context, o *Options) error {
+	if o.SourceDir == "" {
+		return WithHint(errors.New("source directory is required"), "archetypes",
+			"Pass %s with the archetypes source folder", optSourceDir)
+	}
+	unlock, err := o.lockSource(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	removePartial(o.SourceDir)
+	if partialClone(o.SourceDir) {
+		if o.SourceRepo == "" {
+			return WithHint(fmt.Errorf("source directory %s is an interrupted clone", o.SourceDir), "sources-and-cache",
+				"Pass %s to clone it again, or remove it", optSourceRepo)
+		}
+		o.Hooks.warn(fmt.Sprintf("Cloning %s again, the previous clone was interrupted.", o.SourceDir))
+		if err := os.RemoveAll(o.SourceDir); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(o.SourceDir); errors.Is(err, os.ErrNotExist) {
+		if o.SourceRelease != "" {
+			o.evictSources(ctx)
+			return o.cached(downloadRelease(ctx, o))
+		}
+		if o.SourceRepo == "" {
+			return WithHint(fmt.Errorf("source directory not found: %s", o.SourceDir), "archetypes",
+				"Check the %s path, or pass %s to clone the archetypes into it", optSourceDir, optSourceRepo)
+		}
+		o.evictSources(ctx)
+		return o.cached(cloneSource(ctx, o))
+	}
+	touchSource(o.SourceDir)
+	r, err := git.PlainOpen(o.SourceDir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rm, err := r.Remote(sourceRemote)
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	stop := o.Hooks.busy("Pulling " + o.SourceDir)
+	err = o.SourceAuth.do(ctx, rm.Config().URLs[0], func(auth transport.AuthMethod) error {
+		return wt.PullContext(ctx, &git.PullOptions{
+			RemoteName: sourceRemote,
+			Auth:       auth,
+			Progress:   o.Hooks.GitProgress,
+		})
+	})
+	stop()
+	var ne net.Error
+	switch {
+	case err == nil, errors.Is(err, git.NoErrAlreadyUpToDate):
+		return nil
+	case errors.As(err, &ne):
+		o.Hooks.warn("Could not connect to remote repository.")
+		return nil
+	default:
+		return fmt.Errorf("could not pull %s: %w", o.SourceDir, err)
+	}
+}
+
+// cloneSource clones the source repository into the source folder.
+func cloneSource(ctx context.Context, o *Options) error {
+	if err := os.MkdirAll(filepath.Dir(o.SourceDir), 0o755); err != nil { //nolint:mnd,gosec // Standard permissions.
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(o.SourceDir), partialPattern(o.SourceDir))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	stop := o.Hooks.busy("Cloning " + o.SourceRepo)
+	err = o.SourceAuth.do(ctx, o.SourceRepo, func(auth transport.AuthMethod) error {
+		_, err := git.PlainCloneContext(ctx, tmp, false, &git.CloneOptions{
+			URL:           o.SourceRepo,
+			Auth:          auth,
+			RemoteName:    sourceRemote,
+			ReferenceName: plumbing.NewBranchReferenceName(sourceBranch),
+			SingleBranch:  true,
+			Depth:         1, // Speed up the clone.
+			Progress:      o.Hooks.GitProgress,
+		})
+		if err != nil {
+			_ = os.RemoveAll(tmp) // Clean for the retry.
+		}
+		return err
+	})
+	stop()
+	if err != nil {
+		return WithHint(fmt.Errorf("could not clone %s: %w", o.SourceRepo, err), "sources-and-cache",
+			"Check the %s URL and your network and git credentials, or pass an existing %s", optSourceRepo, optSourceDir)
+	}
+	// Moved at once, so an interrupted clone isn't mistaken for a source.
+	return os.Rename(tmp, o.SourceDir)
+}
+
+// partialPattern returns the pattern of the temporary folders the source
+// folder dir is cloned or downloaded into, before being moved into place.
+func partialPattern(dir string) string {
+	return "." + filepath.Base(dir) + ".partial-*"
+}
+
+// removePartial removes the temporary folders left behind by the interrupted
+// clones and downloads of the source folder dir.
+func removePartial(dir string) {
+	ms, _ := filepath.Glob(filepath.Join(filepath.Dir(dir), partialPattern(dir)))
+	for _, m := range ms {
+		_ = os.RemoveAll(m)
+	}
+}
+
+// partialClone reports whether the source folder dir is a clone interrupted
+// before checking out its files, left by the versions cloning in place: a
+// repository without a HEAD commit, and nothing else.
+func partialClone(dir string) bool {
+	es, err := os.ReadDir(dir)
+	if err != nil || len(es) != 1 || es[0].Name() != git.GitDirName {
+		return false
+	}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return !errors.Is(err, git.ErrRepositoryNotExists)
+	}
+	_, err = r.Head()
+	return err != nil
+}
+
+// sshKeys are the default private keys of ssh, in its order.
+var sshKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshAuth returns the authentication for the ssh URLs without an ssh agent
+// running, the first default private key without passphrase, like git does.
+// Otherwise it returns nil for go-git to use the agent or no authentication.
+func sshAuth(url string) transport.AuthMethod {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil || ep.Protocol != "ssh" || os.Getenv("SSH_AUTH_SOCK") != "" {
+		return nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	user := ep.User
+	if user == "" {
+		user = ssh.DefaultUsername
+	}
+	for _, k := range sshKeys {
+		if auth, err := ssh.NewPublicKeysFromFile(user, filepath.Join(home, ".ssh", k), ""); err == nil {
+			return auth
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package garchetype
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+	"go.uber.org/multierr"
+)
+
+// sourceCache records the source folders cloned or downloaded by garchetype,
+// by absolute path, with their last use, so the stale ones can be pruned. The
+// folders given by the user, existing before, aren't recorded.
+type sourceCache struct {
+	Sources map[string]cachedSource `json:"sources"`
+}
+
+// cachedSource is a source folder of the sourceCache.
+type cachedSource struct {
+	Repo    string    `json:"repo,omitempty"`
+	Release string    `json:"release,omitempty"`
+	Used    time.Time `json:"used"`
+}
+
+// sourceCacheMu serializes the updates of the sourceCache, as the sources are
+// synced concurrently.
+var sourceCacheMu sync.Mutex
+
+// sourceCacheFile returns the sourceCache file in the user cache folder.
+func sourceCacheFile() (string, error) {
+	cd, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cd, toolName, "sources.json"), nil
+}
+
+// updateSourceCache applies fn to the sourceCache and stores it, holding the
+// lock of its file, shared by the garchetype processes, so their updates aren't
+// lost. It's replaced at once, so it's never read half written. A missing or
+// unreadable cache is an empty one.
+func updateSourceCache(fn func(sc *sourceCache)) error {
+	sourceCacheMu.Lock()
+	defer sourceCacheMu.Unlock()
+	f, err := sourceCacheFile()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(context.Background(), f+".lock", DefaultLockTimeout, nil)
+	if err != nil {
+		return fmt.Errorf("source cache %s: %w", f, err)
+	}
+	defer unlock()
+	sc := &sourceCache{}
+	if b, err := os.ReadFile(f); err == nil {
+		_ = json.Unmarshal(b, sc)
+	}
+	if sc.Sources == nil {
+		sc.Sources = make(map[string]cachedSource)
+	}
+	fn(sc)
+	b, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f), "sources-*.json")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	err = multierr.Combine(err, tmp.Chmod(0o644), tmp.Close()) //nolint:mnd // Standard permissions.
+	if err == nil {
+		err = os.Rename(tmp.Name(), f)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// cached records the source folder of o in the sourceCache, after it was
+// cloned or downloaded without the err error. The cache is best effort.
+func (o *Options) cached(err error) error {
+	if err != nil {
+		return err
+	}
+	if dir, aerr := filepath.Abs(o.SourceDir); aerr == nil {
+		_ = updateSourceCache(func(sc *sourceCache) {
+			sc.Sources[dir] = cachedSource{Repo: o.SourceRepo, Release: o.SourceRelease, Used: time.Now()}
+		})
+	}
+	return nil
+}
+
+// touchSource records the use of the source folder dir, if it's in the
+// sourceCache.
+func touchSource(dir string) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	_ = updateSourceCache(func(sc *sourceCache) {
+		if s, ok := sc.Sources[abs]; ok {
+			s.Used = time.Now()
+			sc.Sources[abs] = s
+		}
+	})
+}
+
+// CacheEntry is a source folder, or a file, of the cache removed by PruneCache.
+type CacheEntry struct {
+	Path string    `json:"path"`
+	Size int64     `json:"size"`
+	Used time.Time `json:"used"`
+}
+
+// PruneCache removes the source folders cloned or downloaded by garchetype
+// that weren't used within the unused duration, along with the cached
+// listings and update checks older than it, and returns them. The clones with
+// local changes, or commits not pushed, are kept, as are the folders another
+// process is syncing. With dryRun nothing is removed.
+func PruneCache(ctx context.Context, unused time.Duration, dryRun bool) ([]CacheEntry, error) {
+	cutoff := time.Now().Add(-unused)
+	var (
+		stale []CacheEntry
+		errs  error
+	)
+	err := updateSourceCache(func(sc *sourceCache) {
+		c := &gitstat.Cache{}
+		for dir, s := range sc.Sources {
+			if s.Used.After(cutoff) {
+				continue
+			}
+			unlock, err := lockCachedSource(ctx, dir)
+			if err != nil {
+				continue
+			}
+			e, err := pruneSource(ctx, c, sc, dir, s, dryRun)
+			unlock()
+			if e != nil {
+				stale = append(stale, *e)
+			}
+			errs = multierr.Append(errs, err)
+		}
+	})
+	if err = multierr.Append(err, errs); err != nil {
+		return nil, err
+	}
+	files, err := staleCacheFiles(cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		for _, e := range files {
+			if err := os.RemoveAll(e.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	stale = append(stale, files...)
+	slices.SortFunc(stale, func(a, b CacheEntry) int { return a.Used.Compare(b.Used) })
+	return stale, nil
+}
+
+// pruneSource removes the source folder dir of the sc cache, holding its lock,
+// if it's disposable, and returns its entry. With dryRun it's only returned.
+func pruneSource(ctx context.Context, c *gitstat.Cache, sc *sourceCache, dir string, s cachedSource, dryRun bool) (*CacheEntry, error) {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		delete(sc.Sources, dir) // Removed by the user.
+		return nil, nil
+	}
+	if !disposable(ctx, c, dir, s) {
+		return nil, nil
+	}
+	e := &CacheEntry{Path: dir, Size: diskUsage(dir), Used: s.Used}
+	if dryRun {
+		return e, nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	delete(sc.Sources, dir)
+	return e, nil
+}
+
+// lockCachedSource acquires the lock of the cached source folder dir, failing
+// at once if another process is syncing it, so it's not removed meanwhile.
+func lockCachedSource(ctx context.Context, dir string) (unlock func(), err error) {
+	o := &Options{SourceDir: dir, LockTimeout: -1}
+	return o.lockSource(ctx)
+}
+
+// evictSources removes the least recently used source folders of the
+// sourceCache until they fit in the CacheMaxSize, before cloning or
+// downloading the source of o. The clones with local changes, or commits not
+// pushed, are kept, as are the folders another process is syncing.
+func (o *Options) evictSources(ctx context.Context) {
+	if o.CacheMaxSize <= 0 {
+		return
+	}
+	type entry struct {
+		dir  string
+		s    cachedSource
+		size int64
+	}
+	_ = updateSourceCache(func(sc *sourceCache) {
+		var (
+			es    []entry
+			total int64
+		)
+		for dir, s := range sc.Sources {
+			if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+				delete(sc.Sources, dir)
+				continue
+			}
+			e := entry{dir: dir, s: s, size: diskUsage(dir)}
+			es, total = append(es, e), total+e.size
+		}
+		slices.SortFunc(es, func(a, b entry) int { return a.s.Used.Compare(b.s.Used) })
+		c := &gitstat.Cache{}
+		for _, e := range es {
+			if total <= o.CacheMaxSize {
+				return
+			}
+			unlock, err := lockCachedSource(ctx, e.dir)
+			if err != nil {
+				continue
+			}
+			if !disposable(ctx, c, e.dir, e.s) {
+				unlock()
+				continue
+			}
+			err = os.RemoveAll(e.dir)
+			unlock()
+			if err != nil {
+				o.Hooks.warn(fmt.Sprintf("Could not evict %s from the cache: %v", e.dir, err))
+				continue
+			}
+			delete(sc.Sources, e.dir)
+			total -= e.size
+			o.Logger.Infof("Evicted %s from the cache, last used %s", e.dir, e.s.Used.Format(time.RFC3339))
+		}
+	})
+}
+
+// disposable reports whether the source folder dir of the sourceCache can be
+// removed, i.e. it's a download, or a clone without local changes, tracking an
+// upstream branch with all its commits. Without upstream, e.g. on a detached
+// HEAD, nothing tells whether its commits were pushed, so it's kept. The
+// statuses are read through the c cache.
+func disposable(ctx context.Context, c *gitstat.Cache, dir string, s cachedSource) bool {
+	if s.Repo == "" {
+		return true
+	}
+	gs, err := c.Get(ctx, dir, gitstat.Options{})
+	return err == nil && !gs.Dirty && gs.Upstream != "" && gs.Ahead == 0
+}
+
+// staleCacheFiles returns the cached listings and update checks of the user
+// cache folder last written before cutoff.
+func staleCacheFiles(cutoff time.Time) ([]CacheEntry, error) {
+	cd, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	var stale []CacheEntry
+	for _, sub := range []string{"list", "updates"} {
+		entries, err := os.ReadDir(filepath.Join(cd, toolName, sub))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+				continue
+			}
+			stale = append(stale, CacheEntry{Path: filepath.Join(cd, toolName, sub, e.Name()), Size: info.Size(), Used: info.ModTime()})
+		}
+	}
+	return stale, nil
+}
+
+// diskUsage returns the size of the regular files in dir.
+func diskUsage(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr // Best effort.
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,336 @@
+package garchetype
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/diegosz/go-archetype/transformer"
+	"github.com/diegosz/go-archetype/types"
+	"go.uber.org/multierr"
+)
+
+// Symlinks handling modes.
+const (
+	symlinksFollow   = "follow"   // copy the target contents (default)
+	symlinksPreserve = "preserve" // recreate the symlinks
+)
+
+// staging copies the archetype into the work folders before the
+// transformations are applied.
+type staging struct {
+	Dir string // files to transform, with the templates rendered
+	// Verbatim holds the files that can't go through the transformations:
+	// binary files and preserved symlinks.
+	Verbatim string
+	Vars     map[string]string
+	// Strict fails the templates referencing a missing variable.
+	Strict   bool
+	Symlinks string
+	// Ignore matches the archetype files that are not staged.
+	Ignore pathPatterns
+	// Attributes tell the text and binary archetype files.
+	Attributes gitattributes
+	// Limits, when set, bounds the archetype files staged.
+	Limits *limitsConfig
+	// Modules are the WASM modules of the transformation, not staged.
+	Modules []string
+	// Rendered, when set, is called after rendering each template, with its
+	// error if it failed.
+	Rendered func(rel string, err error)
+	// Trace, when set, gets the files staged or skipped.
+	Trace func(e TraceEvent)
+	// root is the archetype folder, with the symlinks resolved, the
+	// archetype symlinks must point within.
+	root string
+}
+
+// stageJob is an archetype file to stage.
+type stageJob struct {
+	path string // file to read, the symlink target when following it
+	rel  string // staged path
+}
+
+// stage copies the archetype folder source. The files are staged in parallel,
+// bounded by GOMAXPROCS, unless the Rendered or Trace hooks are set, then one
+// at a time in path order, so their output is deterministic.
+func (st *staging) stage(source string) error {
+	root, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return err
+	}
+	st.root = root
+	jobs, err := st.collect(source, "")
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicates(jobs); err != nil {
+		return err
+	}
+	if st.Limits != nil {
+		if err := st.Limits.check(jobs); err != nil {
+			return err
+		}
+	}
+	if st.Trace != nil || st.Rendered != nil {
+		for _, j := range jobs {
+			if err := st.stageFile(j); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return parallel(jobs, st.stageFile)
+}
+
+// checkDuplicates fails if two of the jobs are staged into the same path,
+// e.g. main.go and main.go.tmpl, as the one written last would win.
+func checkDuplicates(jobs []stageJob) error {
+	seen := make(map[string]string, len(jobs))
+	for _, j := range jobs {
+		dst := strings.TrimSuffix(j.rel, templateExt)
+		if other, ok := seen[dst]; ok {
+			return WithHint(fmt.Errorf("%s and %s both generate %s", filepath.ToSlash(other), filepath.ToSlash(j.rel), filepath.ToSlash(dst)), "templates",
+				"Remove or rename one of them")
+		}
+		seen[dst] = j.rel
+	}
+	return nil
+}
+
+// trace reports the operation op on the staged file rel to the Trace hook, if
+// set.
+func (st *staging) trace(op, rel, detail string) {
+	if st.Trace != nil {
+		st.Trace(TraceEvent{Op: op, Path: filepath.ToSlash(rel), Detail: detail})
+	}
+}
+
+// collect walks the archetype folder source, creating the staged folders and
+// preserved symlinks, and returns the files to stage under the prefix folder.
+func (st *staging) collect(source, prefix string) ([]stageJob, error) {
+	var jobs []stageJob
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.Join(prefix, rel)
+		if rel == archetypeMetadataFile || rel == ignoreFile {
+			st.trace(TraceSkipped, rel, "archetype metadata")
+			return nil
+		}
+		if slices.Contains(st.Modules, rel) {
+			st.trace(TraceSkipped, rel, "WASM module")
+			return nil
+		}
+		if rel != "." && st.Ignore.match(rel) {
+			st.trace(TraceSkipped, rel, "ignored by "+ignoreFile)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(filepath.Join(st.Dir, rel), 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			js, err := st.collectSymlink(path, rel)
+			jobs = append(jobs, js...)
+			return err
+		default:
+			jobs = append(jobs, stageJob{path: path, rel: rel})
+			return nil
+		}
+	})
+	return jobs, err
+}
+
+// collectSymlink handles the symlink in path, either recreating it or
+// following it, in which case a folder target is collected in full. The
+// symlink must point within the archetype folder, with a relative path.
+func (st *staging) collectSymlink(path, rel string) ([]stageJob, error) {
+	link, err := os.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+	outside := WithHint(fmt.Errorf("the %s symlink points outside the archetype: %s", filepath.ToSlash(rel), link), "archetype-metadata",
+		"Link to a file of the archetype folder with a relative path, or copy the file into it")
+	if filepath.IsAbs(link) {
+		return nil, outside
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	if r, err := filepath.Rel(st.root, filepath.Join(parent, link)); err != nil || !filepath.IsLocal(r) {
+		return nil, outside
+	}
+	if st.Symlinks == symlinksPreserve {
+		dst := filepath.Join(st.Verbatim, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return nil, err
+		}
+		st.trace(TraceCopied, rel, "symlink preserved")
+		return nil, os.Symlink(link, dst)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if r, err := filepath.Rel(st.root, target); err != nil || !filepath.IsLocal(r) {
+		return nil, outside
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []stageJob{{path: target, rel: rel}}, nil
+	}
+	if parent == target || strings.HasPrefix(parent, target+string(filepath.Separator)) {
+		return nil, fmt.Errorf("symlink loop: %s", rel)
+	}
+	return st.collect(target, rel)
+}
+
+// stageFile stages a file, rendering it if it's a template, or setting it
+// aside if it's a binary file.
+func (st *staging) stageFile(j stageJob) error {
+	fi, err := os.Stat(j.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+	if st.Attributes.binary(filepath.ToSlash(j.rel), b) {
+		st.trace(TraceCopied, j.rel, "binary, skipping the transformations")
+		return writeFile(filepath.Join(st.Verbatim, j.rel), b, fi.Mode().Perm())
+	}
+	dst := filepath.Join(st.Dir, j.rel)
+	if strings.HasSuffix(j.rel, templateExt) {
+		text := b
+		if b, err = renderTemplate(j.rel, text, st.Vars, st.Strict); err != nil {
+			err = templateError(filepath.ToSlash(j.rel), text, err)
+			if st.Strict {
+				err = missingVar(err)
+			}
+		}
+		if st.Rendered != nil {
+			st.Rendered(j.rel, err)
+		}
+		if err != nil {
+			return err
+		}
+		st.trace(TraceRendered, j.rel, "")
+		dst = strings.TrimSuffix(dst, templateExt)
+	} else {
+		st.trace(TraceCopied, j.rel, "")
+	}
+	return writeFile(dst, b, fi.Mode().Perm())
+}
+
+// parallel runs fn for each item on a worker pool bounded by GOMAXPROCS. The
+// errors are combined in the order of the items, so they are reported
+// deterministically. A panic of fn is returned as the error of its item, as
+// the callers can't recover it from another goroutine.
+func parallel[T any](items []T, fn func(T) error) error {
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, it := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				if v := recover(); v != nil {
+					errs[i] = fmt.Errorf("internal error: %v\n%s", v, debug.Stack())
+				}
+			}()
+			errs[i] = fn(it)
+		}()
+	}
+	wg.Wait()
+	return multierr.Combine(errs...)
+}
+
+// writeFile writes b into the file name, creating the missing folders.
+func writeFile(name string, b []byte, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, perm)
+}
+
+// passthrough copies the files in dir verbatim into out. They honor the ignore
+// patterns and the rename and include transformations, which are applied to an
+// empty file standing for each one.
+func passthrough(dir, out string, ts *transformer.Transformations) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if ts.IsGloballyIgnored(rel) {
+			return nil
+		}
+		f, err := ts.Transform(types.File{FullPath: path, RelativePath: rel})
+		if err != nil || f.Discarded {
+			return err
+		}
+		return copyEntry(path, filepath.Join(out, f.RelativePath), d)
+	})
+}
+
+// binaryExts are the extensions of the files always treated as binary.
+var binaryExts = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".ico", ".webp", ".bmp", ".pdf",
+	".zip", ".gz", ".tgz", ".tar", ".jar", ".7z",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+	".pb", ".bin", ".exe", ".dll", ".so", ".dylib", ".wasm",
+}
+
+// sniffLen is the number of bytes inspected to tell binary from text files.
+const sniffLen = 8000
+
+// isBinary reports whether the file name with contents b is a binary file, by
+// its extension or because it has NUL bytes or invalid UTF-8 near the start.
+func isBinary(name string, b []byte) bool {
+	if slices.Contains(binaryExts, strings.ToLower(filepath.Ext(name))) {
+		return true
+	}
+	if len(b) > sniffLen {
+		b = b[:sniffLen]
+		// Don't mistake a multi-byte rune cut in half for invalid UTF-8.
+		for i := len(b) - 1; i >= len(b)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(b[i]) {
+				if !utf8.FullRune(b[i:]) {
+					b = b[:i]
+				}
+				break
+			}
+		}
+	}
+	return bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b)
+}
@@ -0,0 +1,75 @@
+package garchetype
+
+import (
+	"cmp"
+	"path"
+	"slices"
+)
+
+// Stats summarizes the features applied to a project, as recorded in its
+// registry.
+type Stats struct {
+	// Features is the number of features, counting once the ones reapplied.
+	Features   int              `json:"features"`
+	Archetypes []ArchetypeStats `json:"archetypes"`
+	// Oldest is the feature applied or reapplied the longest ago, if any.
+	Oldest *Feature `json:"oldest,omitempty"`
+	// Files is the number of generated files of the features.
+	Files int `json:"files"`
+}
+
+// ArchetypeStats counts the features of an archetype.
+type ArchetypeStats struct {
+	Archetype string `json:"archetype"`
+	Features  int    `json:"features"`
+	// Versions are the number of features by archetype version, leaving out
+	// the features without a recorded version.
+	Versions map[string]int `json:"versions,omitempty"`
+}
+
+// ProjectStats returns the stats of the features applied to the project in
+// dir. The archetypes are sorted by number of features, the most used first.
+func ProjectStats(dir string) (*Stats, error) {
+	fr, err := readFeatureRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+	// The last entry of a feature is its latest reapply.
+	type key struct{ name, destination string }
+	latest := make(map[key]int)
+	for i, f := range fr.Features {
+		latest[key{f.Name, f.Destination}] = i
+	}
+	s := &Stats{Archetypes: []ArchetypeStats{}}
+	files := make(map[string]bool)
+	for i, f := range fr.Features {
+		if latest[key{f.Name, f.Destination}] != i {
+			continue
+		}
+		s.Features++
+		j := slices.IndexFunc(s.Archetypes, func(a ArchetypeStats) bool { return a.Archetype == f.Archetype })
+		if j < 0 {
+			s.Archetypes = append(s.Archetypes, ArchetypeStats{Archetype: f.Archetype})
+			j = len(s.Archetypes) - 1
+		}
+		a := &s.Archetypes[j]
+		a.Features++
+		if f.Version != "" {
+			if a.Versions == nil {
+				a.Versions = make(map[string]int)
+			}
+			a.Versions[f.Version]++
+		}
+		if s.Oldest == nil || f.Applied.Before(s.Oldest.Applied) {
+			s.Oldest = &fr.Features[i]
+		}
+		for _, p := range f.Files {
+			files[path.Join(f.Destination, p)] = true
+		}
+	}
+	s.Files = len(files)
+	slices.SortStableFunc(s.Archetypes, func(a, b ArchetypeStats) int {
+		return cmp.Or(cmp.Compare(b.Features, a.Features), cmp.Compare(a.Archetype, b.Archetype))
+	})
+	return s, nil
+}
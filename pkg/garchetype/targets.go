@@ -0,0 +1,137 @@
+package garchetype
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+// Target is a destination of AddTargets.
+type Target struct {
+	// Dir is the destination folder, relative to the project folder.
+	Dir string `yaml:"dir"`
+	// Inputs take precedence over the ones of the options.
+	Inputs map[string]string `yaml:"inputs"`
+	// Archetype, Transformation and FeatureName override the ones of the
+	// options, e.g. to add several archetypes in a run.
+	Archetype      string `yaml:"archetype"`
+	Transformation string `yaml:"transformation"`
+	FeatureName    string `yaml:"feature"`
+	// Source overrides the source of the options.
+	Source *Source `yaml:"source"`
+}
+
+// targetsFile is the layout of the targets file read by ReadTargets.
+type targetsFile struct {
+	Targets []Target `yaml:"targets"`
+}
+
+// ReadTargets reads the targets of the YAML file, listed under its targets key.
+func ReadTargets(file string) ([]Target, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tf targetsFile
+	if err := yaml.Unmarshal(b, &tf); err != nil {
+		return nil, fmt.Errorf("invalid targets file %s: %w", file, err)
+	}
+	for i, t := range tf.Targets {
+		if t.Dir == "" {
+			return nil, fmt.Errorf("invalid targets file %s: target %d has no dir", file, i+1)
+		}
+		if s := t.Source; s != nil {
+			if s.Release != "" && s.Dir == "" {
+				s.Dir = releaseDir(s.Release)
+			}
+			if s.Dir == "" {
+				return nil, fmt.Errorf("invalid targets file %s: the source of target %d has no dir", file, i+1)
+			}
+		}
+		for k, v := range t.Inputs {
+			t.Inputs[k] = expandEnv(v)
+		}
+	}
+	return tf.Targets, nil
+}
+
+// AddTargets adds the same feature to each of the targets, e.g. to roll out a
+// cross-cutting feature like the health checks across many services, or the
+// features of their archetypes. The targets don't need to be members of a
+// go.work workspace, and the repository must be clean before the first one
+// unless Force is set. The distinct sources of the targets are synced
+// concurrently up front. It stops at the first failing target, returning the
+// reports of the ones added before it.
+func AddTargets(ctx context.Context, opts Options, targets []Target) ([]*Report, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no targets")
+	}
+	root, err := filepath.Abs(opts.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	if opts.status == nil {
+		opts.status = &gitstat.Cache{} // Shared by the targets.
+	}
+	if !opts.Force {
+		gs, err := opts.projectStatus(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+		if gs.Dirty {
+			return nil, WithHint(dirtyError(gs.Files), "modules-and-targets",
+				"Commit or stash your changes first, so the generated files are easy to review, or pass %s", optForce)
+		}
+	}
+	if err := syncTargetSources(ctx, opts, targets); err != nil {
+		return nil, err
+	}
+	var rs []*Report
+	for _, t := range targets {
+		to := opts
+		to.Module, to.target, to.synced = t.Dir, true, true
+		to.Archetype = cmp.Or(t.Archetype, to.Archetype)
+		to.Transformation = cmp.Or(t.Transformation, to.Transformation)
+		to.FeatureName = cmp.Or(t.FeatureName, to.FeatureName)
+		if s := t.Source; s != nil {
+			to.SourceDir, to.SourceRepo, to.SourceRelease, to.SourceAuth = s.Dir, s.Repo, s.Release, s.Auth
+		}
+		to.Inputs = maps.Clone(opts.Inputs)
+		if to.Inputs == nil {
+			to.Inputs = make(map[string]string, len(t.Inputs))
+		}
+		maps.Copy(to.Inputs, t.Inputs)
+		r, err := Add(ctx, to)
+		if err != nil {
+			return rs, fmt.Errorf("target %s: %w", t.Dir, err)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// syncTargetSources syncs the distinct sources of the targets, the one of opts
+// for the targets without their own.
+func syncTargetSources(ctx context.Context, opts Options, targets []Target) error {
+	o := opts.withDefaults()
+	var sources []Source
+	for _, t := range targets {
+		s := Source{Dir: o.SourceDir, Repo: o.SourceRepo, Release: o.SourceRelease, Auth: o.SourceAuth}
+		if t.Source != nil {
+			s = *t.Source
+		}
+		if !slices.ContainsFunc(sources, func(d Source) bool { return d.Dir == s.Dir }) {
+			sources = append(sources, s)
+		}
+	}
+	return syncSources(ctx, o, sources)
+}
@@ -0,0 +1,99 @@
+package garchetype
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TemplateError is the failure of an archetype template, telling where it
+// broke.
+type TemplateError struct {
+	// File is the template path relative to the archetype folder.
+	File string
+	// Line and Column locate the failure, the Column is 0 if unknown.
+	Line   int
+	Column int
+	// Expression is the offending template action, e.g. <.port.number>, if
+	// the template failed executing, and Source the template line.
+	Expression string
+	Source     string
+	Err        error
+}
+
+// Error returns the location of the failure along with its reason.
+func (e *TemplateError) Error() string {
+	pos := e.File + ":" + strconv.Itoa(e.Line)
+	if e.Column > 0 {
+		pos += ":" + strconv.Itoa(e.Column)
+	}
+	if e.Expression != "" {
+		return fmt.Sprintf("%s: %s, at %s", pos, e.Err, e.Expression)
+	}
+	return fmt.Sprintf("%s: %s", pos, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+// RenderedTemplate is an archetype template rendered by a generation, for the
+// Template hook.
+type RenderedTemplate struct {
+	// File is the template path relative to the archetype folder.
+	File string
+	// Vars are the variables the template was rendered with, without the
+	// environment ones, the secret inputs masked.
+	Vars map[string]string
+	// Err is the failure of the template, if any.
+	Err *TemplateError
+}
+
+// templateErrorLine parses the text/template errors, e.g.
+// template: main.go.tmpl:3:14: executing "main.go.tmpl" at <.port.number>: ...
+var templateErrorLine = regexp.MustCompile(`(?s)^template: .+?:(\d+)(?::(\d+))?: (?:executing ".*?" at (<.*?>): )?(.*)$`)
+
+// templateError returns the err error of rendering the template text of file
+// as a TemplateError, if it's a text/template one, otherwise wrapped with the
+// file.
+func templateError(file string, text []byte, err error) error {
+	m := templateErrorLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	te := &TemplateError{File: file, Expression: m[3], Err: errors.New(m[4])}
+	te.Line, _ = strconv.Atoi(m[1])
+	te.Column, _ = strconv.Atoi(m[2])
+	if lines := strings.Split(string(text), "\n"); te.Line > 0 && te.Line <= len(lines) {
+		te.Source = strings.TrimSpace(lines[te.Line-1])
+	}
+	return te
+}
+
+// missingVar returns the err error of a strict template, with the suggested fix
+// if it references a missing variable.
+func missingVar(err error) error {
+	var te *TemplateError
+	if errors.As(err, &te) && strings.HasPrefix(te.Err.Error(), "map has no entry for key") {
+		return WithHint(err, "inputs", "Fix the reference, or declare the input and pass its value, or give it a default")
+	}
+	return err
+}
+
+// debugVars returns the vars of a template for the Template hook, without the
+// environment variables, and the secret inputs masked.
+func debugVars(vars map[string]string, inputs []inputSpec) map[string]string {
+	dv := maps.Clone(vars)
+	maps.DeleteFunc(dv, func(k, v string) bool {
+		env, ok := os.LookupEnv(k)
+		return ok && env == v
+	})
+	for _, in := range inputs {
+		if _, ok := dv[in.ID]; ok && in.Secret {
+			dv[in.ID] = maskedSecret
+		}
+	}
+	return dv
+}
@@ -0,0 +1,61 @@
+package garchetype
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/diegosz/go-archetype/log"
+)
+
+// Operations of the trace events.
+const (
+	TraceSkipped     = "skipped"
+	TraceRendered    = "rendered"
+	TraceCopied      = "copied"
+	TraceTransformed = "transformed"
+	TraceWritten     = "written"
+)
+
+// TraceEvent is an operation of a generation on a file, for the Trace hook.
+type TraceEvent struct {
+	// Op is one of the Trace operations.
+	Op string
+	// Path is the slash-separated file path, relative to the archetype folder
+	// until it's written, then to the destination.
+	Path string
+	// Detail tells why the file was skipped, the transformation applied, or
+	// the change written, if any.
+	Detail string
+}
+
+// traceLogger turns the file operations go-archetype logs into trace events,
+// passing all the messages on to the Logger.
+type traceLogger struct {
+	log.Logger
+	// dir is the staging folder go-archetype transforms.
+	dir   string
+	trace func(e TraceEvent)
+}
+
+// Debugf traces the transformations applied and the files ignored or
+// discarded by go-archetype.
+func (l traceLogger) Debugf(format string, args ...any) {
+	switch format {
+	case "Applying transformer [%s] to file [%s]":
+		l.trace(TraceEvent{Op: TraceTransformed, Path: l.rel(args[1]), Detail: fmt.Sprint(args[0])})
+	case "Ignoring file %s":
+		l.trace(TraceEvent{Op: TraceSkipped, Path: l.rel(args[0]), Detail: "ignored by the transformation file"})
+	case "File is discarded, not writing: %s":
+		l.trace(TraceEvent{Op: TraceSkipped, Path: l.rel(args[0]), Detail: "discarded by a transformation"})
+	}
+	l.Logger.Debugf(format, args...)
+}
+
+// rel returns the path p logged by go-archetype relative to the staging folder.
+func (l traceLogger) rel(p any) string {
+	s := fmt.Sprint(p)
+	if r, err := filepath.Rel(l.dir, s); err == nil && filepath.IsAbs(s) {
+		s = r
+	}
+	return filepath.ToSlash(s)
+}
@@ -0,0 +1,167 @@
+package garchetype
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envReference matches the ${NAME} environment variable references.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// transformationSpec is the garchetype view of a transformation file, it only
+// covers the settings go-archetype doesn't handle on its own.
+type transformationSpec struct {
+	// Description is shown by list, only its first line.
+	Description string      `yaml:"description"`
+	Inputs      []inputSpec `yaml:"inputs"`
+	// Deprecated marks the transformation as deprecated, with the hint of its
+	// replacement.
+	Deprecated string `yaml:"deprecated"`
+	// Conditions are the predicates on the destination project the include
+	// transformations can be conditioned on.
+	Conditions []conditionSpec `yaml:"conditions"`
+	// Wasm are the WASM modules transforming the generated files, in order.
+	Wasm []wasmSpec `yaml:"wasm"`
+}
+
+// inputSpec extends the go-archetype input declaration.
+type inputSpec struct {
+	ID   string `yaml:"id"`
+	Text string `yaml:"text"`
+	// Type is text (or string), int, yesno (or bool) or select (or enum),
+	// with the Options to select from.
+	Type    string   `yaml:"type"`
+	Options []string `yaml:"options"`
+	// Default is used when the input is not provided, it may reference
+	// environment variables as ${NAME}.
+	Default string `yaml:"default"`
+	// Pattern is a regular expression the value must match.
+	Pattern string `yaml:"pattern"`
+	// Secret inputs are prompted without echo, and their values are only
+	// injected into the generation, never shown nor recorded.
+	Secret bool `yaml:"secret"`
+	// Role flags an input garchetype answers on its own, e.g. feature.
+	Role string `yaml:"role"`
+}
+
+func readTransformationSpec(file string) (*transformationSpec, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ts := &transformationSpec{}
+	if err := yaml.Unmarshal(b, ts); err != nil {
+		return nil, fmt.Errorf("invalid transformation file %s: %w", file, err)
+	}
+	return ts, nil
+}
+
+// splitOperations writes into dir a copy of the transformation file without the
+// before and after operations, and with the go-archetype input types, and
+// returns the path of the copy along with the hooks of the operations, so
+// garchetype can check and run them on its own.
+func splitOperations(file, dir string) (string, []hook, []hook, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	before, after, err := readHooks(file)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(b, &ms); err != nil {
+		return "", nil, nil, fmt.Errorf("invalid transformation file %s: %w", file, err)
+	}
+	ms = slices.DeleteFunc(ms, func(mi yaml.MapItem) bool {
+		return mi.Key == "before" || mi.Key == "after"
+	})
+	generatorInputTypes(ms)
+	if b, err = yaml.Marshal(ms); err != nil {
+		return "", nil, nil, err
+	}
+	f := filepath.Join(dir, filepath.Base(file))
+	if err := os.WriteFile(f, b, 0o600); err != nil {
+		return "", nil, nil, err
+	}
+	return f, before, after, nil
+}
+
+// input returns the input declared with id, if any.
+func (ts *transformationSpec) input(id string) (inputSpec, bool) {
+	for _, in := range ts.Inputs {
+		if in.ID == id {
+			return in, true
+		}
+	}
+	return inputSpec{}, false
+}
+
+// ReadVars reads a YAML or JSON object of input values from r, e.g. the
+// standard input of a program driving garchetype, for the Inputs option. The
+// values are taken literally.
+func ReadVars(r io.Reader) (map[string]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	if err := yaml.Unmarshal(b, &vars); err != nil {
+		return nil, fmt.Errorf("invalid input values: %w", err)
+	}
+	return vars, nil
+}
+
+// readVarFile reads the YAML map of input values in file, resolving the
+// environment variable references.
+func readVarFile(file string) (map[string]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	if err := yaml.Unmarshal(b, &vars); err != nil {
+		return nil, fmt.Errorf("invalid var file %s: %w", file, err)
+	}
+	for k, v := range vars {
+		vars[k] = expandEnv(v)
+	}
+	return vars, nil
+}
+
+// expandEnv replaces the ${NAME} references in s with the value of the
+// environment variables. Unlike os.ExpandEnv a bare $ is left untouched.
+func expandEnv(s string) string {
+	return envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(envReference.FindStringSubmatch(ref)[1])
+	})
+}
+
+// inputArgs returns the CLI arguments answering the declared inputs with the
+// values, falling back to the input defaults. The values of undeclared inputs
+// are returned as extra variables.
+func inputArgs(ts *transformationSpec, values map[string]string) (args []string, extra map[string]string) {
+	extra = make(map[string]string)
+	for k, v := range values {
+		if _, ok := ts.input(k); !ok {
+			extra[k] = v
+		}
+	}
+	for _, in := range ts.Inputs {
+		v, ok := values[in.ID]
+		if !ok {
+			if in.Default == "" {
+				continue
+			}
+			v = expandEnv(in.Default)
+		}
+		args = append(args, "--"+in.ID+"="+v)
+	}
+	return args, extra
+}
@@ -0,0 +1,124 @@
+package garchetype
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// updatesCheckInterval throttles the update checks of CheckUpdates.
+const updatesCheckInterval = 24 * time.Hour
+
+// Update is a newer version of the archetype of a feature applied to the
+// project.
+type Update struct {
+	Feature   string `json:"feature"`
+	Archetype string `json:"archetype"`
+	// Destination is the module folder of the feature, as in its Feature.
+	Destination string `json:"destination,omitempty"`
+	// Version is the applied archetype version, and Latest the version of the
+	// archetype metadata in the source.
+	Version string `json:"version"`
+	Latest  string `json:"latest"`
+}
+
+// Updates syncs the source and returns the features applied to the project
+// in the current folder whose archetype has a newer metadata version in the
+// source. The features without a recorded version, or whose archetype isn't
+// in the source, are left out.
+func Updates(ctx context.Context, opts Options) ([]Update, error) {
+	o := opts.withDefaults()
+	if err := syncSource(ctx, o); err != nil {
+		return nil, err
+	}
+	return o.updates()
+}
+
+// CheckUpdates is like Updates, without syncing the source, for the notices
+// of the commands that synced it already. It checks each project at most once
+// a day, returning no updates otherwise.
+func CheckUpdates(opts Options) ([]Update, error) {
+	o := opts.withDefaults()
+	f, err := updatesCheckFile(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	var last struct {
+		Checked time.Time `json:"checked"`
+	}
+	if b, err := os.ReadFile(f); err == nil && json.Unmarshal(b, &last) == nil && time.Since(last.Checked) < updatesCheckInterval {
+		return nil, nil
+	}
+	us, err := o.updates()
+	if err != nil {
+		return nil, err
+	}
+	last.Checked = time.Now()
+	if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil { //nolint:mnd,gosec // Standard permissions.
+		return us, nil // The throttling is best effort.
+	}
+	if b, err := json.Marshal(last); err == nil {
+		_ = os.WriteFile(f, b, 0o644) //nolint:mnd,gosec // Standard permissions.
+	}
+	return us, nil
+}
+
+// updatesCheckFile returns the file in the user cache folder with the time of
+// the last update check of the project in dir.
+func updatesCheckFile(dir string) (string, error) {
+	cd, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cd, toolName, "updates", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// updates returns the archetype updates of the features applied to the
+// project in the current folder, the last record of each feature counting.
+func (o *Options) updates() ([]Update, error) {
+	fr, err := readFeatureRegistry(o.projectDir())
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ name, archetype, destination string }
+	applied := make(map[key]Feature)
+	var order []key
+	for _, f := range fr.Features {
+		k := key{f.Name, f.Archetype, f.Destination}
+		if _, ok := applied[k]; !ok {
+			order = append(order, k)
+		}
+		applied[k] = f
+	}
+	latest := make(map[string]string) // By archetype.
+	var us []Update
+	for _, k := range order {
+		f := applied[k]
+		v, ok := latest[f.Archetype]
+		if !ok {
+			if ad, err := o.archetypeFolder(f.Archetype); err == nil {
+				if md, err := readArchetypeMetadata(ad); err == nil {
+					v = md.Version
+				}
+			}
+			latest[f.Archetype] = v
+		}
+		cur, next := canonicalVersion(f.Version), canonicalVersion(v)
+		if cur == "" || next == "" || semver.Compare(next, cur) <= 0 {
+			continue
+		}
+		us = append(us, Update{Feature: f.Name, Archetype: f.Archetype, Destination: f.Destination, Version: f.Version, Latest: v})
+	}
+	return us, nil
+}
@@ -0,0 +1,188 @@
+package garchetype
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/diegosz/go-archetype/log"
+	"github.com/diegosz/go-archetype/transformer"
+	"go.uber.org/multierr"
+)
+
+// buildModulePath is the module path of the temporary module the build check
+// renders the archetype into.
+const buildModulePath = "example.com/" + toolName + "/build"
+
+// ValidateOptions are the settings of Validate.
+type ValidateOptions struct {
+	// Build renders the Transformation of the archetype into a temporary Go
+	// module and runs 'go build ./...' there, catching the templates that
+	// render invalid Go. The inputs are never prompted for.
+	Build bool
+}
+
+// Validate checks the Archetype of the source without generating it: its
+// metadata and every transformation file must be valid, and its templates must
+// parse and only reference declared variables. All the problems are returned
+// together.
+func Validate(ctx context.Context, opts Options, vo ValidateOptions) error {
+	o := opts.withDefaults()
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return err
+	}
+	pc, err := readProjectConfig(o.projectDir())
+	if err != nil {
+		return err
+	}
+	if err := validateArchetype(ad, pc); err != nil {
+		return err
+	}
+	if vo.Build {
+		return o.buildArchetype(ctx, ad, pc)
+	}
+	return nil
+}
+
+// validateArchetype checks the archetype in the ad folder, the variables of pc
+// are declared to its templates, see Validate.
+func validateArchetype(ad string, pc *projectConfig) error {
+	var errs error
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		errs = multierr.Append(errs, err)
+		md = &archetypeMetadata{}
+	} else {
+		if _, err := getEcosystem(md.Ecosystem); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+		if _, err := eolSequence(md.LineEndings); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+		if v := md.MinGarchetypeVersion; v != "" && canonicalVersion(v) == "" {
+			errs = multierr.Append(errs, fmt.Errorf("invalid minimum %s version %q", toolName, v))
+		}
+		if p := md.FeatureName.Pattern; p != "" {
+			if _, err := regexp.Compile(p); err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("invalid feature name pattern: %w", err))
+			}
+		}
+	}
+	ts, err := getTransformations(ad)
+	if err != nil {
+		return multierr.Append(errs, err)
+	}
+	if len(ts) == 0 {
+		errs = multierr.Append(errs, fmt.Errorf("no transformation files in %s", ad))
+	}
+	if t := md.DefaultTransformation; t != "" && !slices.Contains(ts, md.transformation(t)) {
+		errs = multierr.Append(errs, fmt.Errorf("unknown default transformation %q", t))
+	}
+	for _, a := range slices.Sorted(maps.Keys(md.TransformationAliases)) {
+		if t := md.TransformationAliases[a]; !slices.Contains(ts, t) {
+			errs = multierr.Append(errs, fmt.Errorf("transformation alias %q of the unknown transformation %q", a, t))
+		}
+	}
+	var specs []*transformationSpec
+	for _, t := range ts {
+		tf, err := getTransformationFile(t)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		tf = filepath.Join(ad, tf)
+		spec, err := readTransformationSpec(tf)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		specs = append(specs, spec)
+		var inErrs error
+		for _, in := range spec.Inputs {
+			if err := in.check(); err != nil {
+				inErrs = multierr.Append(inErrs, fmt.Errorf("%s: %w", tf, err))
+			}
+		}
+		if inErrs != nil { // go-archetype panics on the unknown input types.
+			errs = multierr.Append(errs, inErrs)
+			continue
+		}
+		if err := readTransformations(tf); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("invalid transformation file %s: %w", tf, err))
+		}
+	}
+	return multierr.Append(errs, lintTemplates(ad, md, specs, pc))
+}
+
+// readTransformations reads the transformation file tf with go-archetype, the
+// way a generation does.
+func readTransformations(tf string) error {
+	work, err := os.MkdirTemp("", toolName+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	f, _, _, err := splitOperations(tf, work)
+	if err != nil {
+		return err
+	}
+	_, err = transformer.Read(f, log.NopLogger{})
+	return err
+}
+
+// buildArchetype renders the archetype in ad into a temporary Go module, with
+// the pc project settings, and builds it, see ValidateOptions.
+func (o *Options) buildArchetype(ctx context.Context, ad string, pc *projectConfig) error {
+	md, err := readArchetypeMetadata(ad)
+	if err != nil {
+		return err
+	}
+	if md.Ecosystem != "" && md.Ecosystem != defaultEcosystem {
+		return fmt.Errorf("the build check doesn't support the %s ecosystem", md.Ecosystem)
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return WithHint(errors.New("go command not found"), "publishing",
+			"Install Go to build the rendered archetype, or run it without %s", optBuild)
+	}
+	work, err := os.MkdirTemp("", toolName+"-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	if err := goCommand(ctx, work, "mod", "init", buildModulePath); err != nil {
+		return err
+	}
+	o.Module, o.NoPrompt = work, true
+	o.Hooks.Progress, o.Hooks.Confirm = nil, nil
+	if _, err := o.renderInto(ad, work, pc); err != nil {
+		return fmt.Errorf("rendering %s: %w", o.Archetype, err)
+	}
+	if err := goCommand(ctx, work, "mod", "tidy"); err != nil {
+		return err
+	}
+	return goCommand(ctx, work, "build", "./...")
+}
+
+// goCommand runs the go command with args in dir, its output is part of the
+// error if it fails.
+func goCommand(ctx context.Context, dir string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go %s: %w\n%s", strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package garchetype
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/mod/modfile"
+
+	"github.com/diegosz/garchetype/pkg/gitstat"
+)
+
+const (
+	modulePathID   = "module_path"
+	moduleNameID   = "module_name"
+	gitUserNameID  = "git_user_name"
+	gitUserEmailID = "git_user_email"
+	nowRFC3339ID   = "now_rfc3339"
+	timestampID    = "timestamp"
+	dateID         = "date"
+	yearID         = "year"
+	uuidID         = "uuid"
+	gitBranchID    = "git_branch"
+	gitHashID      = "git_hash"
+	gitShortHashID = "git_short_hash"
+	gitTagID       = "git_tag"
+	packageNameID  = "package_name"
+)
+
+// majorVersionSuffix matches the major version suffix of a module path.
+var majorVersionSuffix = regexp.MustCompile(`/v[0-9]+$`)
+
+// builtinVars returns the variables garchetype derives on its own and injects
+// into every generation, on top of the system variables. The gs status of the
+// destination repository is optional.
+func builtinVars(o *Options, gs *gitstat.Status) map[string]string {
+	vars := make(map[string]string)
+	addCaseVariants(vars, featureNameID, o.FeatureName)
+	if mod := goModulePath(o.moduleDir()); mod != "" {
+		vars[modulePathID] = mod
+		vars[moduleNameID] = path.Base(majorVersionSuffix.ReplaceAllString(mod, ""))
+	}
+	if name := packageJSONName(o.moduleDir()); name != "" {
+		vars[packageNameID] = name
+	}
+	var name, email string
+	if !o.NoGit {
+		name, email = gitConfig("user.name"), gitConfig("user.email")
+	}
+	vars[gitUserNameID], vars[gitUserEmailID] = name, email
+	now := time.Now()
+	vars[nowRFC3339ID] = now.Format(time.RFC3339)
+	vars[timestampID] = now.UTC().Format("20060102150405") // Handy for migration file names.
+	vars[dateID] = now.Format(time.DateOnly)
+	vars[yearID] = strconv.Itoa(now.Year())
+	vars[uuidID] = uuid.NewString()
+	if gs != nil {
+		vars[gitBranchID] = gs.Branch
+		vars[gitHashID] = gs.Hash
+		vars[gitShortHashID] = gs.ShortHash
+		vars[gitTagID] = gs.Description.Tag
+	}
+	return vars
+}
+
+// gitConfig returns the value of key from `git config`, or an empty string if
+// it's not set or git is not available.
+func gitConfig(key string) string {
+	out, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// goModulePath returns the module path declared in the nearest go.mod file of
+// the dir folder or its parents, or an empty string if it can't be read.
+func goModulePath(dir string) string {
+	mr := findUp(dir, goModFile)
+	if mr == "" {
+		return ""
+	}
+	b, err := os.ReadFile(filepath.Join(mr, goModFile))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(b)
+}
+
+// packageJSONName returns the package name declared in the nearest
+// package.json file of the dir folder or its parents, or an empty string if it
+// can't be read.
+func packageJSONName(dir string) string {
+	pr := findUp(dir, "package.json")
+	if pr == "" {
+		return ""
+	}
+	b, err := os.ReadFile(filepath.Join(pr, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &pkg); err != nil {
+		return ""
+	}
+	return pkg.Name
+}
+
+// addCaseVariants sets id along with its snake, camel, pascal and kebab case
+// variants, e.g. feature_name_snake.
+func addCaseVariants(vars map[string]string, id, value string) {
+	if value == "" {
+		return
+	}
+	words := splitWords(value)
+	vars[id] = value
+	vars[id+"_snake"] = strings.Join(words, "_")
+	vars[id+"_kebab"] = strings.Join(words, "-")
+	vars[id+"_pascal"] = pascalCase(words)
+	vars[id+"_camel"] = camelCase(words)
+}
+
+// splitWords splits s into lower case words on any non alphanumeric character
+// and on case changes, so "my-cool-api", "my_cool_api", "MyCoolAPI" and
+// "myCoolApi" all yield the same words.
+func splitWords(s string) []string {
+	var (
+		words []string
+		word  []rune
+	)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+func pascalCase(words []string) string {
+	var b strings.Builder
+	for _, w := range words {
+		rs := []rune(w)
+		b.WriteRune(unicode.ToUpper(rs[0]))
+		b.WriteString(string(rs[1:]))
+	}
+	return b.String()
+}
+
+func camelCase(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	return words[0] + pascalCase(words[1:])
+}
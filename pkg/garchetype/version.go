@@ -0,0 +1,187 @@
+package garchetype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// resolvedVersion is the version of an archetype resolved from the tags of the
+// source.
+type resolvedVersion struct {
+	Version string
+	Tag     string
+	Commit  string
+}
+
+// splitArchetypeVersion splits the archetype reference name@constraint into
+// the archetype name and its version constraint, empty if it has none.
+func splitArchetypeVersion(ref string) (string, string) {
+	name, constraint, _ := strings.Cut(ref, "@")
+	return name, constraint
+}
+
+// checkoutVersion checks the archetype out into dir at the highest version
+// tagged in the source repository matching the semver constraint, e.g. ^1.2.
+// The archetype tags, e.g. grpc-service/v1.2.3, take precedence over the
+// source ones, e.g. v1.2.3. The remote tags are listed, and the resolved one
+// fetched, as the source is a shallow clone.
+func (o *Options) checkoutVersion(ctx context.Context, archetype, constraint, dir string) (*resolvedVersion, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, WithHint(fmt.Errorf("invalid version constraint %q of the %q archetype: %w", constraint, archetype, err), "versions",
+			"Use a semver range, e.g. %s@^1.2 or %s@~1.2.3", archetype, archetype)
+	}
+	r, err := git.PlainOpenWithOptions(o.SourceDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, WithHint(fmt.Errorf("source %s: %w", o.SourceDir, err), "versions",
+			"The archetype versions are resolved from the tags of a source repository, pass %s", optSourceRepo)
+	}
+	tags, err := o.sourceTags(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	tag, v := matchVersionTag(tags, archetype, c)
+	if tag == "" {
+		return nil, WithHint(fmt.Errorf("no version of the %q archetype matches %s", archetype, constraint), "versions",
+			"Tag the archetype releases of the source as %s/v1.2.3, or v1.2.3", archetype)
+	}
+	if err := o.fetchTag(ctx, r, tag); err != nil {
+		return nil, err
+	}
+	h, err := r.ResolveRevision(plumbing.Revision(plumbing.NewTagReferenceName(tag)))
+	if err != nil {
+		return nil, fmt.Errorf("tag %s of the source: %w", tag, err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	ad, err := o.archetypeFolder(archetype)
+	if err != nil {
+		return nil, err
+	}
+	if ad, err = filepath.Abs(ad); err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(wt.Filesystem.Root(), ad)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkoutArchetype(r, h.String(), filepath.ToSlash(rel), dir); err != nil {
+		return nil, err
+	}
+	return &resolvedVersion{Version: v.String(), Tag: tag, Commit: h.String()}, nil
+}
+
+// sourceTags returns the names of the tags of the source repository r, the
+// local ones and the ones of its remote, if it's reachable.
+func (o *Options) sourceTags(ctx context.Context, r *git.Repository) ([]string, error) {
+	refs, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	rm, err := r.Remote(sourceRemote)
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var remote []*plumbing.Reference
+	err = o.SourceAuth.do(ctx, rm.Config().URLs[0], func(auth transport.AuthMethod) error {
+		remote, err = rm.ListContext(ctx, &git.ListOptions{Auth: auth})
+		return err
+	})
+	var ne net.Error
+	switch {
+	case errors.As(err, &ne):
+		o.Hooks.warn("Could not connect to remote repository, using the local tags.")
+	case err != nil:
+		return nil, fmt.Errorf("could not list the tags of %s: %w", o.SourceDir, err)
+	}
+	for _, ref := range remote {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+	return tags, nil
+}
+
+// matchVersionTag returns the tag of the highest version of the archetype
+// matching the constraint c, and the version, or an empty tag if none does.
+// Only the archetype tags are considered if there are any.
+func matchVersionTag(tags []string, archetype string, c *semver.Constraints) (string, *semver.Version) {
+	var (
+		best   string
+		bestV  *semver.Version
+		scoped bool
+	)
+	for _, t := range tags {
+		name, ok := strings.CutPrefix(t, archetype+"/")
+		switch {
+		case ok && !scoped:
+			best, bestV, scoped = "", nil, true // The source tags are dropped.
+		case !ok && (scoped || strings.Contains(t, "/")):
+			continue
+		}
+		v, err := semver.NewVersion(name)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if bestV == nil || v.GreaterThan(bestV) {
+			best, bestV = t, v
+		}
+	}
+	return best, bestV
+}
+
+// fetchTag fetches the tag of the source repository r from its remote, if it's
+// missing.
+func (o *Options) fetchTag(ctx context.Context, r *git.Repository, tag string) error {
+	name := plumbing.NewTagReferenceName(tag)
+	if _, err := r.Reference(name, false); err == nil {
+		return nil
+	}
+	rm, err := r.Remote(sourceRemote)
+	if err != nil {
+		return err
+	}
+	unlock, err := o.lockSource(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	stop := o.Hooks.busy("Fetching " + tag)
+	defer stop()
+	err = o.SourceAuth.do(ctx, rm.Config().URLs[0], func(auth transport.AuthMethod) error {
+		return rm.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: sourceRemote,
+			RefSpecs:   []config.RefSpec{config.RefSpec("+" + name + ":" + name)},
+			Depth:      1, // Only the tagged archetype is needed.
+			Auth:       auth,
+			Tags:       git.NoTags,
+			Progress:   o.Hooks.GitProgress,
+		})
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("could not fetch the %s tag of %s: %w", tag, o.SourceDir, err)
+	}
+	return nil
+}
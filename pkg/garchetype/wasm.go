@@ -0,0 +1,158 @@
+package garchetype
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	// wasmTimeout bounds the run of a WASM module on a file.
+	wasmTimeout = 10 * time.Second
+	// wasmMemoryPages bounds the memory of a WASM module, in 64 KiB pages.
+	wasmMemoryPages = 1024
+	// maxWasmOutput bounds the contents a WASM module writes for a file.
+	maxWasmOutput = 16 << 20
+)
+
+// wasmSpec is a custom per-file transformation run by a WASM module of the
+// archetype, a WASI command getting the contents of each file on its standard
+// input, and its path relative to the output as argument, and writing the new
+// contents to its standard output. It runs sandboxed: without the file
+// system, the network nor the environment, bounded in time and memory.
+type wasmSpec struct {
+	// Module is the path of the module, relative to the archetype folder.
+	Module string `yaml:"module"`
+	// Files are the globs of the generated files the module transforms.
+	Files []string `yaml:"files"`
+}
+
+// wasmModules returns the archetype paths of the modules of ws, so they're
+// not staged.
+func wasmModules(ws []wasmSpec) []string {
+	mm := make([]string, 0, len(ws))
+	for _, w := range ws {
+		mm = append(mm, filepath.Clean(filepath.FromSlash(w.Module)))
+	}
+	return mm
+}
+
+// transformWasm runs the modules of ws, found in the archetype folder source,
+// on the matching text files of the out folder, in order.
+func transformWasm(ctx context.Context, ws []wasmSpec, source, out string, trace func(e TraceEvent)) error {
+	if len(ws) == 0 {
+		return nil
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(wasmMemoryPages))
+	defer rt.Close(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		return err
+	}
+	for _, w := range ws {
+		if err := w.run(ctx, rt, source, out, trace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run compiles the module of w and runs it on each of its files in out.
+func (w wasmSpec) run(ctx context.Context, rt wazero.Runtime, source, out string, trace func(e TraceEvent)) error {
+	mod := filepath.FromSlash(w.Module)
+	if w.Module == "" || !filepath.IsLocal(mod) {
+		return WithHint(fmt.Errorf("invalid WASM module: %q", w.Module), "templates",
+			"Set the module path relative to the archetype folder")
+	}
+	pp, err := compilePatterns(w.Files)
+	if err != nil {
+		return WithHint(fmt.Errorf("WASM module %s: %w", w.Module, err), "templates",
+			"Fix the files globs of the module")
+	}
+	b, err := os.ReadFile(filepath.Join(source, mod))
+	if err != nil {
+		return err
+	}
+	cm, err := rt.CompileModule(ctx, b)
+	if err != nil {
+		return fmt.Errorf("WASM module %s: %w", w.Module, err)
+	}
+	defer cm.Close(ctx)
+	return filepath.WalkDir(out, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(out, p)
+		if err != nil || !pp.match(rel) {
+			return err
+		}
+		in, err := os.ReadFile(p)
+		if err != nil || isBinary(rel, in) {
+			return err
+		}
+		res, err := runWasm(ctx, rt, cm, filepath.ToSlash(rel), in)
+		if err != nil {
+			return fmt.Errorf("WASM module %s on %s: %w", w.Module, filepath.ToSlash(rel), err)
+		}
+		if trace != nil {
+			trace(TraceEvent{Op: TraceTransformed, Path: filepath.ToSlash(rel), Detail: "WASM module " + w.Module})
+		}
+		return os.WriteFile(p, res, d.Type().Perm()|0o600)
+	})
+}
+
+// runWasm runs the compiled module cm on the contents in of the file rel, and
+// returns what it writes to its standard output.
+func runWasm(ctx context.Context, rt wazero.Runtime, cm wazero.CompiledModule, rel string, in []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, wasmTimeout)
+	defer cancel()
+	var stdout limitedBuffer
+	var stderr bytes.Buffer
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs("transform", rel).
+		WithStdin(bytes.NewReader(in)).
+		WithStdout(&stdout).
+		WithStderr(&stderr)
+	m, err := rt.InstantiateModule(ctx, cm, cfg)
+	if m != nil {
+		m.Close(ctx)
+	}
+	var ee *sys.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, fmt.Errorf("timed out after %s", wasmTimeout)
+	case errors.As(err, &ee) && ee.ExitCode() != 0:
+		return nil, fmt.Errorf("exit status %d: %s", ee.ExitCode(), bytes.TrimSpace(stderr.Bytes()))
+	case err != nil && !errors.As(err, &ee):
+		return nil, err
+	case stdout.exceeded:
+		return nil, fmt.Errorf("wrote more than %s", FormatSize(maxWasmOutput))
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer is a buffer dropping the writes beyond maxWasmOutput.
+type limitedBuffer struct {
+	bytes.Buffer
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxWasmOutput {
+		b.exceeded = true
+		return 0, io.ErrShortWrite
+	}
+	return b.Buffer.Write(p)
+}
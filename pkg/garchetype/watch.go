@@ -0,0 +1,117 @@
+package garchetype
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchInterval is how often Watch polls the archetype folder for changes.
+const watchInterval = 500 * time.Millisecond
+
+// fileStamp identifies the version of a watched file.
+type fileStamp struct {
+	modTime int64
+	size    int64
+	mode    fs.FileMode
+}
+
+// Watch renders the Archetype into the sandbox folder dest, and renders it
+// again whenever the files of the archetype folder change, until ctx is done.
+// The previously rendered files are removed first, so the sandbox mirrors the
+// archetype. Each render is reported to the Rendered hook, its errors don't
+// stop the watch.
+func Watch(ctx context.Context, opts Options, dest string) error {
+	o := opts.withDefaults()
+	o.Hooks.Progress, o.Hooks.Confirm = nil, nil
+	if dest == "" {
+		return WithHint(errors.New("sandbox folder is required"), "templates",
+			"Pass %s with the folder to render the archetype into", optWatchDest)
+	}
+	ad, err := o.archetypeFolder(o.Archetype)
+	if err != nil {
+		return err
+	}
+	if dest, err = filepath.Abs(dest); err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(ad); err == nil {
+		if rel, err := filepath.Rel(abs, dest); err == nil && filepath.IsLocal(rel) {
+			return WithHint(errors.New("the sandbox folder is within the archetype folder"), "templates",
+				"Pass a %s folder outside of %s", optWatchDest, ad)
+		}
+	}
+	// The hooks run on every render, in the sandbox, and the project config
+	// still restricts them.
+	o.hooksDir = dest
+	pc, err := readProjectConfig(o.projectDir())
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	var last map[string]fileStamp
+	var files []string
+	for {
+		snap, err := snapshotDir(ad)
+		if err != nil {
+			return err
+		}
+		if !maps.Equal(snap, last) {
+			last = snap
+			r, err := o.renderSandbox(ad, dest, files, pc)
+			if r != nil {
+				files = r.Files
+			}
+			if o.Hooks.Rendered != nil {
+				o.Hooks.Rendered(r, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderSandbox removes the previous files from dest and renders the
+// archetype in ad into it.
+func (o *Options) renderSandbox(ad, dest string, previous []string, pc *projectConfig) (*Report, error) {
+	for _, f := range previous {
+		if err := os.Remove(filepath.Join(dest, f)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return o.renderInto(ad, dest, pc)
+}
+
+// snapshotDir returns the stamps of the files in dir, by path.
+func snapshotDir(dir string) (map[string]fileStamp, error) {
+	snap := make(map[string]fileStamp)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil // Removed while walking, caught by the next poll.
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		snap[path] = fileStamp{modTime: fi.ModTime().UnixNano(), size: fi.Size(), mode: fi.Mode()}
+		return nil
+	})
+	return snap, err
+}
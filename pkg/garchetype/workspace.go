@@ -0,0 +1,57 @@
+package garchetype
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	goModFile  = "go.mod"
+	goWorkFile = "go.work"
+)
+
+// findUp returns the nearest folder holding the name file, the dir folder or
+// one of its parents, the way the go command looks for the go.mod file, or an
+// empty string if none does.
+func findUp(dir, name string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// checkWorkspaceModule returns an error unless module is the folder of a
+// member module of the go.work workspace in the current folder.
+func checkWorkspaceModule(module string) error {
+	b, err := os.ReadFile(goWorkFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("go.work file not found in the current folder")
+		}
+		return err
+	}
+	wf, err := modfile.ParseWork(goWorkFile, b, nil)
+	if err != nil {
+		return err
+	}
+	for _, u := range wf.Use {
+		if filepath.Clean(u.Path) == filepath.Clean(module) {
+			return nil
+		}
+	}
+	return fmt.Errorf("module %s is not used by the go.work workspace", module)
+}
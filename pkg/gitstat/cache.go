@@ -0,0 +1,87 @@
+package gitstat
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+)
+
+// Cache memoizes the statuses of the repositories, so a run asking several
+// times for the status of the same directory reads it once. The cached status
+// is the one of the first call, later changes of the working tree aren't
+// reflected until Forget. The zero value is ready to use, and it's safe for
+// concurrent use: the statuses of different directories are read at the same
+// time, and the calls for one being read wait for it.
+type Cache struct {
+	mu       sync.Mutex
+	statuses map[cacheKey]*cacheEntry
+}
+
+type cacheKey struct {
+	dir  string
+	opts Options
+}
+
+// cacheEntry is a status of the Cache, read once done is closed.
+type cacheEntry struct {
+	done chan struct{}
+	s    *Status
+	err  error
+}
+
+// Get is like GetWithOptions, returning the cached status of the dir
+// directory if any. The errors aren't cached. The returned status is shared,
+// it must not be modified.
+func (c *Cache) Get(ctx context.Context, dir string, opts Options) (*Status, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	k := cacheKey{dir: abs, opts: opts}
+	for {
+		c.mu.Lock()
+		e, ok := c.statuses[k]
+		if !ok {
+			e = &cacheEntry{done: make(chan struct{})}
+			if c.statuses == nil {
+				c.statuses = make(map[cacheKey]*cacheEntry)
+			}
+			c.statuses[k] = e
+			c.mu.Unlock()
+			return c.read(ctx, k, e)
+		}
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-e.done:
+		}
+		if e.err == nil {
+			return e.s, nil
+		}
+		// The read failed, maybe as its caller was canceled, try again.
+	}
+}
+
+// read reads the status of the e entry of the k key, without holding the
+// mutex, dropping the entry if it fails.
+func (c *Cache) read(ctx context.Context, k cacheKey, e *cacheEntry) (*Status, error) {
+	defer close(e.done)
+	e.s, e.err = GetWithOptions(ctx, k.dir, k.opts)
+	if e.err != nil {
+		c.mu.Lock()
+		if c.statuses[k] == e {
+			delete(c.statuses, k)
+		}
+		c.mu.Unlock()
+		return nil, e.err
+	}
+	return e.s, nil
+}
+
+// Forget drops the cached statuses, e.g. after committing.
+func (c *Cache) Forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.statuses)
+}
@@ -0,0 +1,365 @@
+package gitstat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// shortHashLen is the length of the short hashes reported by the go-git
+// backend, the git default.
+const shortHashLen = 7
+
+// hasGit reports whether the git command is available, otherwise the status is
+// read with go-git.
+var hasGit = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+})
+
+// getGoGit returns the status of the git repository in the dir directory using
+// go-git, for the systems without the git command.
+func getGoGit(ctx context.Context, dir string, opts Options) (*Status, error) {
+	r, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, ErrNotRepository
+	}
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	s := &Status{Hash: head.Hash().String()}
+	if head.Name().IsBranch() {
+		s.Branch = head.Name().Short()
+	}
+	s.Detached = s.Branch == ""
+	shallow, err := r.Storer.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	s.Shallow = len(shallow) > 0
+	s.ShortHash = s.Hash[:shortHashLen]
+	c, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	s.AuthorDate = c.Author.When.Format("2006-01-02T15:04:05")
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := goGitWorktree(wt, s); err != nil {
+		return nil, err
+	}
+	ws, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	s.Files = goGitFiles(ws)
+	s.Dirty = len(s.Files) > 0
+	if opts.Submodules && !s.Dirty {
+		if s.Dirty, err = submodulesDirty(wt); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := goGitUpstream(ctx, r, head, s); err != nil {
+		return nil, err
+	}
+	goGitRemote(r, s)
+	d, err := describe(ctx, r, c)
+	if err != nil || d == nil {
+		return s, err
+	}
+	d.ShortHash = s.ShortHash
+	s.Description = *d
+	return s, nil
+}
+
+// maxCandidates is the number of tags describe considers, the most recent
+// ones, the git describe default.
+const maxCandidates = 10
+
+// describe mimics `git describe --tags --long` for the head commit, it returns
+// nil if no tag is reachable from it. Like git, the commits of a tag are the
+// ones reachable from head but not from the tag, so the merged branches count
+// too, and of the maxCandidates most recent tags the one with the fewest
+// commits describes head.
+func describe(ctx context.Context, r *git.Repository, head *object.Commit) (*Description, error) {
+	tags := make(map[plumbing.Hash]string)
+	refs, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		h := ref.Hash()
+		if t, err := r.TagObject(h); err == nil { // Annotated tag.
+			c, err := t.Commit()
+			if err != nil {
+				return nil //nolint:nilerr // Not a commit tag.
+			}
+			h = c.Hash
+		}
+		if name := ref.Name().Short(); name > tags[h] { // Be deterministic.
+			tags[h] = name
+		}
+		return nil
+	})
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	reachable, err := ancestors(ctx, r, head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*object.Commit
+	for h := range tags {
+		if _, ok := reachable[h]; !ok {
+			continue
+		}
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	slices.SortFunc(candidates, func(a, b *object.Commit) int {
+		return cmp.Or(b.Committer.When.Compare(a.Committer.When), strings.Compare(a.Hash.String(), b.Hash.String()))
+	})
+	var d *Description
+	for _, c := range candidates[:min(len(candidates), maxCandidates)] {
+		tagged, err := ancestors(ctx, r, c.Hash)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for h := range reachable {
+			if _, ok := tagged[h]; !ok {
+				n++
+			}
+		}
+		if d == nil || n < d.AdditionalCommits {
+			d = &Description{Tag: tags[c.Hash], AdditionalCommits: n}
+		}
+	}
+	return d, nil
+}
+
+// goGitUpstream sets the upstream branch of s and the commits ahead and behind
+// it, like upstream does with the git command.
+func goGitUpstream(ctx context.Context, r *git.Repository, head *plumbing.Reference, s *Status) error {
+	if !head.Name().IsBranch() {
+		return nil
+	}
+	b, err := r.Branch(head.Name().Short())
+	if err != nil || b.Remote == "" || b.Merge == "" {
+		return nil //nolint:nilerr // No error, just no upstream.
+	}
+	name := plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short())
+	if b.Remote == "." {
+		name = b.Merge
+	}
+	u, err := r.Reference(name, true)
+	if err != nil {
+		return nil //nolint:nilerr // The upstream branch is gone.
+	}
+	local, err := ancestors(ctx, r, head.Hash())
+	if err != nil {
+		return err
+	}
+	remote, err := ancestors(ctx, r, u.Hash())
+	if err != nil {
+		return err
+	}
+	for h := range local {
+		if _, ok := remote[h]; !ok {
+			s.Ahead++
+		}
+	}
+	for h := range remote {
+		if _, ok := local[h]; !ok {
+			s.Behind++
+		}
+	}
+	s.Upstream = name.Short()
+	return nil
+}
+
+// goGitWorktree sets the common dir of s and whether wt is a linked worktree,
+// reading the .git file of the linked worktrees and the commondir file of their
+// git dir.
+func goGitWorktree(wt *git.Worktree, s *Status) error {
+	gitDir := filepath.Join(wt.Filesystem.Root(), git.GitDirName)
+	fi, err := os.Stat(gitDir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		b, err := os.ReadFile(gitDir)
+		if err != nil {
+			return err
+		}
+		line, _, _ := strings.Cut(string(b), "\n")
+		gitDir = resolvePath(wt.Filesystem.Root(), strings.TrimPrefix(strings.TrimSpace(line), "gitdir: "))
+	}
+	s.CommonDir = gitDir
+	b, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.CommonDir = resolvePath(gitDir, strings.TrimSpace(string(b)))
+	s.LinkedWorktree = s.CommonDir != gitDir
+	return nil
+}
+
+// resolvePath returns the path p relative to the dir directory, unless it's
+// absolute.
+func resolvePath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(dir, p)
+}
+
+// goGitRemote sets the URL and the default branch of the upstream remote of s,
+// like remote does with the git command.
+func goGitRemote(r *git.Repository, s *Status) {
+	name := defaultRemote
+	if b, err := r.Branch(s.Branch); err == nil && b.Remote != "" && b.Remote != "." {
+		name = b.Remote
+	}
+	rm, err := r.Remote(name)
+	if err != nil || len(rm.Config().URLs) == 0 {
+		return
+	}
+	s.RemoteURL = rm.Config().URLs[0]
+	ref, err := r.Reference(plumbing.NewRemoteHEADReferenceName(name), false)
+	if err == nil && ref.Type() == plumbing.SymbolicReference {
+		s.DefaultBranch = strings.TrimPrefix(ref.Target().Short(), name+"/")
+	}
+}
+
+// ancestors returns the commits reachable from h, including it.
+func ancestors(ctx context.Context, r *git.Repository, h plumbing.Hash) (map[plumbing.Hash]struct{}, error) {
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[plumbing.Hash]struct{})
+	err = walk(ctx, r, c, func(c *object.Commit) error {
+		seen[c.Hash] = struct{}{}
+		return nil
+	})
+	return seen, err
+}
+
+// walk calls fn with the commits reachable from c, including it, in preorder
+// until fn returns storer.ErrStop. The missing parents of the commits at the
+// boundary of a shallow clone are skipped.
+func walk(ctx context.Context, r *git.Repository, c *object.Commit, fn func(c *object.Commit) error) error {
+	seen := map[plumbing.Hash]struct{}{c.Hash: {}}
+	stack := []*object.Commit{c}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if err := fn(c); err != nil {
+			if errors.Is(err, storer.ErrStop) {
+				return nil
+			}
+			return err
+		}
+		for _, h := range slices.Backward(c.ParentHashes) {
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			seen[h] = struct{}{}
+			p, err := r.CommitObject(h)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			stack = append(stack, p)
+		}
+	}
+	return nil
+}
+
+// submodulesDirty reports whether a submodule of the worktree isn't at the
+// recorded commit or has a dirty working tree, the go-git worktree status
+// ignores the latter.
+func submodulesDirty(wt *git.Worktree) (bool, error) {
+	subs, err := wt.Submodules()
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range subs {
+		ss, err := sub.Status()
+		if err != nil {
+			return false, err
+		}
+		if !ss.IsClean() {
+			return true, nil
+		}
+		r, err := sub.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		swt, err := r.Worktree()
+		if err != nil {
+			return false, err
+		}
+		sws, err := swt.Status()
+		if err != nil {
+			return false, err
+		}
+		if !sws.IsClean() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// goGitFiles returns the modified and untracked files of the worktree status,
+// sorted by path like the git command does.
+func goGitFiles(ws git.Status) []FileStatus {
+	var files []FileStatus
+	for path, fs := range ws {
+		if fs.Staging == git.Unmodified && fs.Worktree == git.Unmodified {
+			continue
+		}
+		files = append(files, FileStatus{
+			Path:     path,
+			OrigPath: fs.Extra,
+			Code:     string([]byte{byte(fs.Staging), byte(fs.Worktree)}),
+		})
+	}
+	slices.SortFunc(files, func(a, b FileStatus) int { return strings.Compare(a.Path, b.Path) })
+	return files
+}
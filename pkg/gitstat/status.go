@@ -0,0 +1,328 @@
+// Package gitstat reports the status of git repositories: branch, commit,
+// last tag description, whether the working tree is dirty and how far it is
+// from its upstream branch. It shells out to the git command twice per status,
+// three times with git before 2.35, and reads the rest from the repository
+// files, or asks git up to five more times for the repositories go-git can't
+// open.
+package gitstat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// ErrNotRepository is returned for a folder outside a git repository.
+var ErrNotRepository = errors.New("not inside a git repository")
+
+// describePlaceholder is the git log placeholder of the description, printed
+// as is by git before 2.35.
+const describePlaceholder = "%(describe:tags)"
+
+var (
+	errEmptyOutput = errors.New("empty output")
+	re             = regexp.MustCompile(`^(.*)-(\d+)-g([0-9a-f]+)$`)
+)
+
+func execGit(ctx context.Context, dir string, arg ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", arg...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), err
+	}
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return "", errEmptyOutput
+	}
+	return string(out), nil
+}
+
+// Description describes HEAD relative to the last tag reachable from it, like
+// `git describe --tags --long`. It could be empty if there is no tag in the
+// repository.
+type Description struct {
+	Tag               string
+	AdditionalCommits int // number of additional commits after the last tag
+	ShortHash         string
+}
+
+// Status contains the status of a git repository.
+type Status struct {
+	Branch         string       // result of `git branch --show-current`
+	Description    Description  // like `git describe --tags --long`
+	Hash           string       // result of `git rev-parse HEAD` command
+	ShortHash      string       // result of `git rev-parse --short HEAD` command
+	AuthorDate     string       // result of `git log -n1 --date=format:"%Y-%m-%dT%H:%M:%S" --format=%ad`
+	Detached       bool         // HEAD isn't a branch, i.e. Branch is empty
+	Shallow        bool         // result of `git rev-parse --is-shallow-repository`
+	Dirty          bool         // repo returns non-empty `git status --porcelain`
+	Files          []FileStatus // the modified and untracked files, as `git status --porcelain`
+	Upstream       string       // upstream branch, empty without upstream
+	Ahead          int          // commits on HEAD not on Upstream
+	Behind         int          // commits on Upstream not on HEAD
+	RemoteURL      string       // URL of the upstream remote, or origin, empty without remotes
+	DefaultBranch  string       // default branch of the remote, e.g. main, from its HEAD
+	CommonDir      string       // the .git folder shared by the worktrees, result of `git rev-parse --git-common-dir`
+	LinkedWorktree bool         // the directory is in a linked worktree, see `git worktree add`
+}
+
+// FileStatus is a modified or untracked file of the working tree.
+type FileStatus struct {
+	Path     string // relative to the repository root
+	OrigPath string // the path before a rename or copy
+	Code     string // the XY code of `git status --short`, e.g. " M" or "??"
+}
+
+// Get returns the status of the git repository in the current directory.
+func Get() (*Status, error) {
+	return GetIn(".")
+}
+
+// GetIn returns the status of the git repository in the dir directory.
+func GetIn(dir string) (*Status, error) {
+	return GetContext(context.Background(), dir)
+}
+
+// Options tune how the status is read.
+type Options struct {
+	// Submodules counts the modified submodules as dirty, even if the git
+	// config ignores them, i.e. `git status --ignore-submodules=none`.
+	Submodules bool
+}
+
+// GetContext returns the status of the git repository in the dir directory. The
+// git commands are killed if ctx is done before they complete. Without the git
+// command the status is read with go-git.
+func GetContext(ctx context.Context, dir string) (*Status, error) {
+	return GetWithOptions(ctx, dir, Options{})
+}
+
+// GetWithOptions is like GetContext, with the given options.
+func GetWithOptions(ctx context.Context, dir string, opts Options) (status *Status, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("git status failed: %w", err)
+		}
+	}()
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !hasGit() {
+		return getGoGit(ctx, dir, opts)
+	}
+	s := &Status{}
+	args := []string{"status", "--porcelain=v2", "--branch", "-z"}
+	if opts.Submodules {
+		args = append(args, "--ignore-submodules=none")
+	}
+	o, err := execGit(ctx, dir, args...)
+	if err != nil {
+		return nil, ErrNotRepository
+	}
+	if err := parseStatus(o, s); err != nil {
+		return nil, err
+	}
+	s.Detached = s.Branch == ""
+	s.Dirty = len(s.Files) > 0
+	o, err = execGit(ctx, dir, "log", "-n1", "--date=format:%Y-%m-%dT%H:%M:%S", "--format=%h%x00%ad%x00"+describePlaceholder)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(o, "\x00"+describePlaceholder) {
+		d, _ := execGit(ctx, dir, "describe", "--tags", "--long") // Fails without tags.
+		o = strings.TrimSuffix(o, describePlaceholder) + d
+	}
+	if err := parseLog(o, s); err != nil {
+		return nil, err
+	}
+	if err := repository(ctx, dir, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseLog sets the short hash, the author date and the description of s from
+// the output of `git log -n1 --format=%h%x00%ad%x00%(describe:tags)`. The
+// description is the last tag alone when HEAD is tagged, otherwise the tag is
+// followed by -N-g<hash>, which is told from a tag with dashes by matching the
+// hash of HEAD.
+func parseLog(o string, s *Status) error {
+	parts := strings.Split(o, "\x00")
+	if len(parts) != 3 { //nolint:mnd // The short hash, the date and the description.
+		return errors.New("failed to parse `git log` result")
+	}
+	s.ShortHash, s.AuthorDate = parts[0], parts[1]
+	tag := parts[2]
+	if tag == "" {
+		return nil
+	}
+	d := &Description{Tag: tag}
+	if p, err := ParseDescription(tag); err == nil && strings.HasPrefix(s.Hash, p.ShortHash) {
+		d = p
+	}
+	d.ShortHash = s.ShortHash
+	s.Description = *d
+	return nil
+}
+
+// repository sets the common dir, whether the repository is shallow and the
+// remote of s reading the repository files, which is much faster than asking
+// git. If go-git can't open the repository, e.g. it uses an unsupported
+// extension, git is asked instead.
+func repository(ctx context.Context, dir string, s *Status) error {
+	r, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return repositoryGit(ctx, dir, s)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := goGitWorktree(wt, s); err != nil {
+		return err
+	}
+	shallow, err := r.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+	s.Shallow = len(shallow) > 0
+	goGitRemote(r, s)
+	return nil
+}
+
+// repositoryGit is like repository, asking git.
+func repositoryGit(ctx context.Context, dir string, s *Status) error {
+	if err := worktree(ctx, dir, s); err != nil {
+		return err
+	}
+	o, err := execGit(ctx, dir, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return err
+	}
+	s.Shallow = o == "true"
+	return remote(ctx, dir, s)
+}
+
+// parseStatus sets the hash, the branch, the files and the upstream of s from the output of
+// `git status --porcelain=v2 --branch -z`.
+func parseStatus(o string, s *Status) error {
+	entries := strings.Split(o, "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		switch {
+		case strings.HasPrefix(e, "# branch.oid "):
+			s.Hash = strings.TrimPrefix(e, "# branch.oid ")
+		case strings.HasPrefix(e, "# branch.head "):
+			if h := strings.TrimPrefix(e, "# branch.head "); h != "(detached)" {
+				s.Branch = h
+			}
+		case strings.HasPrefix(e, "# branch.upstream "):
+			s.Upstream = strings.TrimPrefix(e, "# branch.upstream ")
+		case strings.HasPrefix(e, "# branch.ab "):
+			if _, err := fmt.Sscanf(strings.TrimPrefix(e, "# branch.ab "), "+%d -%d", &s.Ahead, &s.Behind); err != nil {
+				return fmt.Errorf("failed to parse `git status` branch: %w", err)
+			}
+		case strings.HasPrefix(e, "1 "), strings.HasPrefix(e, "u "):
+			// 1 XY sub mH mI mW hH hI path, the unmerged ones have 2 more fields.
+			n := 9 //nolint:mnd // Fields of the ordinary changes.
+			if e[0] == 'u' {
+				n = 11
+			}
+			f := strings.SplitN(e, " ", n)
+			if len(f) != n {
+				return errors.New("failed to parse `git status` entry")
+			}
+			s.Files = append(s.Files, FileStatus{Path: f[n-1], Code: statusCode(f[1])})
+		case strings.HasPrefix(e, "2 "):
+			// 2 XY sub mH mI mW hH hI Xscore path, then the original path.
+			f := strings.SplitN(e, " ", 10) //nolint:mnd // Fields of the renames.
+			if len(f) != 10 || i+1 == len(entries) {
+				return errors.New("failed to parse `git status` entry")
+			}
+			i++
+			s.Files = append(s.Files, FileStatus{Path: f[9], OrigPath: entries[i], Code: statusCode(f[1])})
+		case strings.HasPrefix(e, "? "):
+			s.Files = append(s.Files, FileStatus{Path: e[2:], Code: untracked})
+		}
+	}
+	if s.Upstream == "" {
+		s.Ahead, s.Behind = 0, 0
+	}
+	return nil
+}
+
+// worktree sets the common dir of s and whether dir is in a linked worktree,
+// whose git dir isn't the common one.
+func worktree(ctx context.Context, dir string, s *Status) error {
+	o, err := execGit(ctx, dir, "rev-parse", "--path-format=absolute", "--git-dir", "--git-common-dir")
+	if err != nil {
+		return err
+	}
+	dirs := strings.Split(o, "\n")
+	if len(dirs) != 2 { //nolint:mnd // The git dir and the common one.
+		return errors.New("failed to parse `git rev-parse` result")
+	}
+	s.CommonDir = filepath.Clean(dirs[1])
+	s.LinkedWorktree = filepath.Clean(dirs[0]) != s.CommonDir
+	return nil
+}
+
+// defaultRemote is the remote of the branches without upstream.
+const defaultRemote = "origin"
+
+// remote sets the URL and the default branch of the upstream remote of s.
+func remote(ctx context.Context, dir string, s *Status) error {
+	name := defaultRemote
+	if s.Branch != "" {
+		if r, err := execGit(ctx, dir, "config", "--get", "branch."+s.Branch+".remote"); err == nil && r != "." {
+			name = r
+		}
+	}
+	u, err := execGit(ctx, dir, "remote", "get-url", name)
+	if err != nil {
+		return nil //nolint:nilerr // No error, just no remote.
+	}
+	s.RemoteURL = u
+	if b, err := execGit(ctx, dir, "symbolic-ref", "--short", "refs/remotes/"+name+"/HEAD"); err == nil {
+		s.DefaultBranch = strings.TrimPrefix(b, name+"/")
+	}
+	return nil
+}
+
+// untracked is the code of the untracked files.
+const untracked = "??"
+
+// statusCode returns the porcelain v1 code, e.g. " M", of the porcelain v2 XY
+// field, e.g. ".M".
+func statusCode(xy string) string {
+	return strings.ReplaceAll(xy, ".", " ")
+}
+
+// ParseDescription parses the output of `git describe --tags --long`, e.g.
+// v1.2.0-3-g1a2b3c4. The last -N-g<hash> suffix is the count and hash, so tags
+// may contain dashes.
+func ParseDescription(s string) (*Description, error) {
+	parts := re.FindStringSubmatch(s)
+	if len(parts) != 4 { //nolint:mnd // 4 is the expected number of parts.
+		return nil, errors.New("failed to parse `git describe` result")
+	}
+	n, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	return &Description{
+		Tag:               parts[1],
+		AdditionalCommits: n,
+		ShortHash:         parts[3],
+	}, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// previewPageSize is the number of plan lines shown at once.
+const previewPageSize = 20
+
+// The first choices of the preview, followed by the plan tree.
+const (
+	previewConfirm = iota
+	previewAbort
+)
+
+// planLine is a line of the plan tree, either a folder or a file of the plan.
+type planLine struct {
+	text string
+	diff *garchetype.FileDiff
+}
+
+// planTree returns the lines of the plan as a tree, the files indented under
+// their folders, marked + when created and ~ when modified.
+func planTree(plan []garchetype.FileDiff) []planLine {
+	var lines []planLine
+	var prev []string
+	for i := range plan {
+		d := &plan[i]
+		dirs := strings.Split(path.Dir(d.Path), "/")
+		if dirs[0] == "." {
+			dirs = nil
+		}
+		common := 0
+		for common < len(dirs) && common < len(prev) && dirs[common] == prev[common] {
+			common++
+		}
+		for j := common; j < len(dirs); j++ {
+			lines = append(lines, planLine{text: strings.Repeat("  ", j) + dirs[j] + "/"})
+		}
+		mark := "~"
+		if d.Change == garchetype.FileAdded {
+			mark = "+"
+		}
+		lines = append(lines, planLine{
+			text: fmt.Sprintf("%s%s %s", strings.Repeat("  ", len(dirs)), mark, path.Base(d.Path)),
+			diff: d,
+		})
+		prev = dirs
+	}
+	return lines
+}
+
+// previewPlan returns the Confirm hook showing the generation plan as a tree of
+// the files to be created or modified. Selecting a file prints its diff into w,
+// through the pager unless noPager, until the plan is confirmed or aborted.
+func previewPlan(p *printer, w io.Writer, noPager bool) func(plan []garchetype.FileDiff) (bool, error) {
+	return func(plan []garchetype.FileDiff) (bool, error) {
+		if len(plan) == 0 {
+			p.printf(iconTransformation, "The generated files are already up to date.")
+			return true, nil
+		}
+		lines := planTree(plan)
+		options := []string{tr("Confirm"), tr("Abort")}
+		for _, l := range lines {
+			options = append(options, l.text)
+		}
+		for {
+			var choice int
+			err := survey.AskOne(&survey.Select{
+				Message: fmt.Sprintf(tr("%d files to write, select one to see its diff:"), len(plan)),
+				Options: options,
+			}, &choice, survey.WithPageSize(previewPageSize))
+			if err != nil {
+				return false, err
+			}
+			switch choice {
+			case previewConfirm:
+				return true, nil
+			case previewAbort:
+				return false, nil
+			}
+			d := lines[choice-len(options)+len(lines)].diff
+			switch {
+			case d == nil:
+			case noPager:
+				fmt.Fprint(w, d.Patch)
+			default:
+				if err := page(w, []byte(d.Patch)); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+}
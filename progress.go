@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+var (
+	spinnerFrames      = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	plainSpinnerFrames = []string{"|", "/", "-", "\\"}
+)
+
+// isTerminal reports whether w is a terminal, progress indicators are only
+// shown on terminals.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
+
+// spinner shows an animated label until the returned stop function is called.
+// It's a no-op when the output isn't a terminal.
+func (p *printer) spinner(label string) (stop func()) {
+	if !isTerminal(p.w) {
+		return func() {}
+	}
+	frames := p.theme.Spinner
+	if p.plain || len(frames) == 0 {
+		frames = plainSpinnerFrames
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(100 * time.Millisecond) //nolint:mnd // Frame rate.
+		defer t.Stop()
+		for i := 0; ; i++ {
+			if d := p.detail.Load(); d != nil {
+				fmt.Fprintf(p.w, "\r%s %s: %s\033[K", frames[i%len(frames)], label, *d)
+			} else {
+				fmt.Fprintf(p.w, "\r%s %s", frames[i%len(frames)], label)
+			}
+			select {
+			case <-done:
+				p.detail.Store(nil)
+				fmt.Fprint(p.w, "\r\033[K")
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// gitProgress returns the writer of the git progress messages, showing the
+// last one after the label of the running spinner. It returns nil when the
+// output isn't a terminal.
+func (p *printer) gitProgress() io.Writer {
+	if !isTerminal(p.w) {
+		return nil
+	}
+	return progressWriter{p}
+}
+
+// progressWriter sets the detail of the spinner of p to the last line written,
+// the git progress messages being rewritten in place with carriage returns.
+type progressWriter struct{ p *printer }
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	lines := strings.FieldsFunc(string(b), func(r rune) bool { return r == '\r' || r == '\n' })
+	for _, l := range slices.Backward(lines) {
+		if l = strings.TrimSpace(l); l != "" {
+			w.p.detail.Store(&l)
+			break
+		}
+	}
+	return len(b), nil
+}
+
+// counter returns a function reporting how many of the total items labeled by
+// label are done, the line is cleared once all of them are. It returns nil when
+// the output isn't a terminal.
+func (p *printer) counter(label string) func(done, total int) {
+	if !isTerminal(p.w) {
+		return nil
+	}
+	var mu sync.Mutex
+	return func(done, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done >= total {
+			fmt.Fprint(p.w, "\r\033[K")
+			return
+		}
+		fmt.Fprintf(p.w, "\r%s%s %d/%d", p.prefix(iconTransformation), label, done, total)
+	}
+}
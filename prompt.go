@@ -0,0 +1,155 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/mattn/go-isatty"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// isInteractive reports whether the user can be prompted, i.e. stdin is a
+// terminal.
+func isInteractive() bool {
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// promptFeatureName asks for a feature name until validate accepts it.
+func promptFeatureName(validate func(string) error) (string, error) {
+	var name string
+	err := survey.AskOne(
+		&survey.Input{Message: tr("Feature name")},
+		&name,
+		survey.WithValidator(func(ans any) error {
+			s, _ := ans.(string)
+			return validate(s)
+		}),
+	)
+	return name, err
+}
+
+// promptArchetype asks for one of the archetypes as, showing their
+// descriptions, with fuzzy search.
+func promptArchetype(as []garchetype.Archetype) (string, error) {
+	names := make([]string, len(as))
+	for i, a := range as {
+		names[i] = a.Name
+	}
+	var name string
+	err := survey.AskOne(&survey.Select{
+		Message: tr("Archetype"),
+		Options: names,
+		Description: func(_ string, i int) string {
+			return as[i].Description
+		},
+	}, &name, survey.WithFilter(func(filter, value string, i int) bool {
+		return fuzzyMatch(filter, value+" "+as[i].Description)
+	}))
+	return name, err
+}
+
+// fuzzyMatch reports whether the letters of filter appear in order in s,
+// ignoring the case.
+func fuzzyMatch(filter, s string) bool {
+	filter, s = strings.ToLower(filter), strings.ToLower(s)
+	for _, r := range filter {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// promptTransformation asks for one of the transformations ts, showing their
+// descriptions.
+func promptTransformation(ts []garchetype.Transformation) (string, error) {
+	names := make([]string, len(ts))
+	var def any
+	for i, t := range ts {
+		names[i] = t.Name
+		if t.Default {
+			def = t.Name
+		}
+	}
+	var name string
+	err := survey.AskOne(&survey.Select{
+		Message: tr("Transformation"),
+		Options: names,
+		Default: def,
+		Description: func(_ string, i int) string {
+			return ts[i].Description
+		},
+	}, &name)
+	return name, err
+}
+
+// promptInput asks for the value of the input in until validate accepts it,
+// with the prompt suiting its type.
+func promptInput(in garchetype.Input, validate func(string) error) (string, error) {
+	message := cmp.Or(in.Text, in.ID)
+	validator := survey.WithValidator(func(ans any) error {
+		s, _ := ans.(string)
+		return validate(s)
+	})
+	switch {
+	case in.Secret:
+		var v string
+		err := survey.AskOne(&survey.Password{Message: message}, &v, validator)
+		return v, err
+	case in.Type == "yesno":
+		var yes bool
+		err := survey.AskOne(&survey.Confirm{Message: message}, &yes)
+		return strconv.FormatBool(yes), err
+	case in.Type == "select":
+		var v string
+		err := survey.AskOne(&survey.Select{Message: message, Options: in.Options}, &v)
+		return v, err
+	default:
+		var v string
+		err := survey.AskOne(&survey.Input{Message: message}, &v, validator)
+		return v, err
+	}
+}
+
+// promptPrerequisite asks whether to apply the archetype required by another
+// one first.
+func promptPrerequisite(archetype, required string) (bool, error) {
+	ok := true
+	err := survey.AskOne(&survey.Confirm{
+		Message: fmt.Sprintf(tr("The '%s' archetype requires '%s', not applied yet. Apply it first?"), archetype, required),
+		Default: true,
+	}, &ok)
+	return ok, err
+}
+
+// conflictChoices are the choices of promptConflict, by strategy.
+var conflictChoices = []struct{ strategy, label string }{
+	{garchetype.ConflictsTheirs, "Take the generated version"},
+	{garchetype.ConflictsOurs, "Keep the current version"},
+	{garchetype.ConflictsManual, "Write conflict markers to resolve by hand"},
+	{garchetype.ConflictsMergeTool, "Open the merge tool"},
+}
+
+// promptConflict asks how to resolve the conflict of the existing file path,
+// returning the strategy.
+func promptConflict(path string) (string, error) {
+	labels := make([]string, len(conflictChoices))
+	for i, c := range conflictChoices {
+		labels[i] = tr(c.label)
+	}
+	var i int
+	err := survey.AskOne(&survey.Select{
+		Message: fmt.Sprintf(tr("%s was changed in the project, resolve it how?"), path),
+		Options: labels,
+	}, &i)
+	return conflictChoices[i].strategy, err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// releasesURL is the release source checked by self-update.
+const releasesURL = "https://api.github.com/repos/diegosz/garchetype/releases/latest"
+
+// checksumsAsset is the release asset with the SHA-256 checksums of the
+// binaries, in the sha256sum format.
+const checksumsAsset = "checksums.txt"
+
+// release is the subset of the GitHub release used by self-update.
+type release struct {
+	TagName string         `json:"tag_name"` //nolint:tagliatelle // GitHub API.
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"` //nolint:tagliatelle // GitHub API.
+}
+
+// binaryAsset returns the name of the release binary for the current platform.
+func binaryAsset() string {
+	name := fmt.Sprintf("%s_%s_%s", exeName, runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// asset returns the URL of the asset name.
+func (r *release) asset(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no %s asset", r.TagName, name)
+}
+
+// selfUpdate replaces the running executable with the latest release binary,
+// if it's newer, after verifying its checksum. With check it only reports
+// whether there's a newer release.
+func selfUpdate(ctx context.Context, p *printer, check bool) error {
+	r := &release{}
+	if err := getJSON(ctx, releasesURL, r); err != nil {
+		return garchetype.WithHint(fmt.Errorf("could not check the latest release: %w", err), "install",
+			"Check your network access, or install the latest release manually")
+	}
+	if !semver.IsValid(r.TagName) {
+		return fmt.Errorf("invalid latest release version %q", r.TagName)
+	}
+	if semver.Compare(r.TagName, Version) <= 0 {
+		p.printf(iconDone, "%s %s is up to date.", exeName, Version)
+		return nil
+	}
+	if check {
+		p.printf(iconArchetype, "%s %s is available, run '%s self-update' to install it.", exeName, r.TagName, exeName)
+		return nil
+	}
+	name := binaryAsset()
+	binURL, err := r.asset(name)
+	if err != nil {
+		return err
+	}
+	sumsURL, err := r.asset(checksumsAsset)
+	if err != nil {
+		return err
+	}
+	sums, err := get(ctx, sumsURL)
+	if err != nil {
+		return err
+	}
+	want, err := checksum(sums, name)
+	if err != nil {
+		return err
+	}
+	stop := p.spinner("Downloading " + exeName + " " + r.TagName)
+	bin, err := get(ctx, binURL)
+	stop()
+	if err != nil {
+		return err
+	}
+	if got := sha256.Sum256(bin); hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s %s", name, r.TagName)
+	}
+	if err := replaceExecutable(bin); err != nil {
+		return err
+	}
+	p.printf(iconDone, "%s updated from %s to %s.", exeName, Version, r.TagName)
+	return nil
+}
+
+// checksum returns the SHA-256 checksum of the file name in sums.
+func checksum(sums []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(sums))
+	for s.Scan() {
+		sum, file, ok := strings.Cut(s.Text(), "  ")
+		if ok && strings.TrimPrefix(file, "*") == name {
+			return strings.ToLower(sum), nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+// replaceExecutable atomically replaces the running executable with bin.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+exeName+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// A running executable can't be overwritten, but it can be renamed.
+		old := exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+func get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+func getJSON(ctx context.Context, url string, v any) error {
+	b, err := get(ctx, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	return nil
+}
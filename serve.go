@@ -0,0 +1,244 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// Timeouts of the HTTP server.
+const (
+	serveReadTimeout     = 30 * time.Second
+	serveShutdownTimeout = 10 * time.Second
+)
+
+// generateRequest is the body of the generate endpoint.
+type generateRequest struct {
+	Transformation string            `json:"transformation"`
+	Feature        string            `json:"feature"`
+	Inputs         map[string]string `json:"inputs"`
+	// Workspace is the folder within the workspaces one to generate into,
+	// when empty the generated files are returned as a tarball.
+	Workspace string `json:"workspace"`
+}
+
+// errorResponse is the body of the failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+	Hint  string `json:"hint,omitempty"`
+	Docs  string `json:"docs,omitempty"`
+}
+
+// server is the HTTP API of garchetype, for the platforms offering scaffolding
+// through their own UI.
+type server struct {
+	cfg   *Config
+	token string
+	// workspaces is the folder the generate requests may write into, none by
+	// default.
+	workspaces string
+	diag       *printer
+	// mu serializes the requests, they share the source folder.
+	mu sync.Mutex
+}
+
+// handler returns the routes of the API, all of them authenticated.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /archetypes", s.listArchetypes)
+	mux.HandleFunc("GET /archetypes/{archetype}/inputs", s.describeInputs)
+	mux.HandleFunc("POST /archetypes/{archetype}/generate", s.generate)
+	return s.authenticated(mux)
+}
+
+// authenticated rejects the requests without the bearer token.
+func (s *server) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.fail(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// options returns the operation options of the request for the archetype.
+func (s *server) options(archetype string) garchetype.Options {
+	return garchetype.Options{
+		SourceDir:        s.cfg.SourceDir,
+		SourceRepo:       s.cfg.SourceRepo,
+		SourceRelease:    s.cfg.SourceRelease,
+		SourceAuth:       garchetype.SourceAuth{Type: s.cfg.SourceAuth},
+		PluginsDir:       s.cfg.PluginsDir,
+		CacheMaxSize:     s.cfg.cacheMaxSize,
+		ArchetypesFolder: s.cfg.ArchetypesFolder,
+		Archetype:        archetype,
+		Transformation:   s.cfg.Transformation,
+		MaxAge:           s.cfg.MaxAge,
+		NoPrompt:         true,
+		NoHooks:          true, // The requests mustn't run commands on the server.
+		NoFormat:         true,
+		ToolVersion:      Version,
+		Logger:           s.diag.log,
+		Hooks:            garchetype.Hooks{Warn: func(msg string) { s.diag.warnf("%s", msg) }},
+	}
+}
+
+func (s *server) listArchetypes(w http.ResponseWriter, r *http.Request) {
+	as, err := garchetype.List(r.Context(), s.options(""))
+	if err != nil {
+		s.fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.reply(w, as)
+}
+
+func (s *server) describeInputs(w http.ResponseWriter, r *http.Request) {
+	o := s.options(r.PathValue("archetype"))
+	if t := r.URL.Query().Get("transformation"); t != "" {
+		o.Transformation = t
+	}
+	ins, err := garchetype.Inputs(r.Context(), o)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	s.reply(w, ins)
+}
+
+// workspace returns the folder of the ws workspace, with the symbolic links
+// resolved, failing if it's not within the workspaces folder. The folders it
+// doesn't have yet are resolved from their closest existing parent.
+func (s *server) workspace(ws string) (string, error) {
+	if s.workspaces == "" || !filepath.IsLocal(ws) {
+		return "", fmt.Errorf("invalid workspace: %s", ws)
+	}
+	root, err := filepath.EvalSymlinks(s.workspaces)
+	if err != nil {
+		return "", err
+	}
+	dir, rest := filepath.Join(root, ws), ""
+	for {
+		res, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			dir = filepath.Join(res, rest)
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		dir, rest = filepath.Dir(dir), filepath.Join(filepath.Base(dir), rest)
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid workspace: %s links outside the workspaces folder", ws)
+	}
+	return dir, nil
+}
+
+func (s *server) generate(w http.ResponseWriter, r *http.Request) {
+	var req generateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.fail(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	o := s.options(r.PathValue("archetype"))
+	if req.Transformation != "" {
+		o.Transformation = req.Transformation
+	}
+	o.FeatureName, o.Inputs = req.Feature, req.Inputs
+	if req.Workspace != "" {
+		dir, err := s.workspace(req.Workspace)
+		if err != nil {
+			s.fail(w, http.StatusBadRequest, err)
+			return
+		}
+		rep, err := garchetype.Generate(r.Context(), o, dir)
+		if err != nil {
+			s.fail(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		s.reply(w, rep)
+		return
+	}
+	dir, err := os.MkdirTemp("", exeName+"-serve-")
+	if err != nil {
+		s.fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	rep, err := garchetype.Generate(r.Context(), o, dir)
+	if err != nil {
+		s.fail(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", rep.Feature+".tar.gz"))
+	if err := writeTarball(w, dir, rep.Files); err != nil {
+		s.diag.warnf("Could not send the %s tarball: %s", rep.Feature, err)
+	}
+}
+
+// writeTarball writes into w the gzipped tarball of the files in dir.
+func writeTarball(w io.Writer, dir string, files []string) error {
+	zw := gzip.NewWriter(w)
+	if err := writeTar(zw, dir, files); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (s *server) reply(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.diag.warnf("Could not send the response: %s", err)
+	}
+}
+
+func (s *server) fail(w http.ResponseWriter, code int, err error) {
+	res := errorResponse{Error: err.Error()}
+	var he *garchetype.HintError
+	if errors.As(err, &he) {
+		res.Hint, res.Docs = he.Hint, he.Docs
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// serve runs the HTTP API on addr until ctx is done.
+func serve(ctx context.Context, p, diag *printer, cfg *Config, addr, token, workspaces string) error {
+	if token == "" {
+		return garchetype.WithHint(errors.New("API token is required"), "serving",
+			"Set the %s_SERVE_TOKEN variable, or pass --token", envPrefix)
+	}
+	s := &server{cfg: cfg, token: token, workspaces: workspaces, diag: diag}
+	hs := &http.Server{Addr: addr, Handler: s.handler(), ReadHeaderTimeout: serveReadTimeout}
+	errc := make(chan error, 1)
+	go func() { errc <- hs.ListenAndServe() }()
+	p.printf(iconSource, "Serving the archetypes API on %s, press Ctrl+C to stop.", addr)
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	return hs.Shutdown(sctx)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/diegosz/go-archetype/log"
+
+	"github.com/diegosz/garchetype/pkg/garchetype"
+)
+
+// telemetryTimeout bounds the time a command waits for the telemetry endpoint.
+const telemetryTimeout = 2 * time.Second
+
+// telemetryEvent is the anonymous usage record sent to the telemetry endpoint.
+// It never holds file contents, nor feature, project or repository names.
+type telemetryEvent struct {
+	Command        string `json:"command"`
+	Archetype      string `json:"archetype"`
+	Transformation string `json:"transformation"`
+	Success        bool   `json:"success"`
+	Version        string `json:"version"`
+	Platform       string `json:"platform"`
+}
+
+// sendTelemetry posts the usage of the archetype of the r report, or of the
+// cfg one if it failed with err before resolving it, to the telemetry endpoint
+// the user opted in with. Its failures are only logged as diagnostics.
+func sendTelemetry(ctx context.Context, logger log.Logger, cfg *Config, command string, r *garchetype.Report, err error) {
+	if cfg.TelemetryURL == "" {
+		return
+	}
+	ev := telemetryEvent{
+		Command:        command,
+		Archetype:      cfg.Archetype,
+		Transformation: cfg.Transformation,
+		Success:        err == nil,
+		Version:        Version,
+		Platform:       runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if r != nil {
+		ev.Archetype, ev.Transformation = r.Archetype, r.Transformation
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), telemetryTimeout)
+	defer cancel()
+	if err := postJSON(ctx, cfg.TelemetryURL, ev); err != nil {
+		logger.Debugf("telemetry: %s", err)
+	}
+}
+
+func postJSON(ctx context.Context, url string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", url, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Built-in themes of the status lines.
+const (
+	themeEmoji = "emoji"
+	themeASCII = "ascii"
+	themeNone  = "none"
+)
+
+// iconRoles name the icons in the theme files.
+var iconRoles = map[string]string{
+	"add":            iconAdd,
+	"source":         iconSource,
+	"archetype":      iconArchetype,
+	"transformation": iconTransformation,
+	"done":           iconDone,
+	"warning":        iconWarning,
+	"error":          iconError,
+	"hint":           iconHint,
+	"docs":           iconDocs,
+	"watch":          iconWatch,
+	"debug":          iconDebug,
+}
+
+// ansiColors are the ANSI escape codes of the theme colors.
+var ansiColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"gray":    "90",
+	"bold":    "1",
+}
+
+// theme sets the symbols of the status lines, by icon, and their colors. An
+// icon without a symbol is dropped.
+type theme struct {
+	Symbols map[string]string
+	Colors  map[string]string
+	Spinner []string
+}
+
+// themes are the built-in themes.
+var themes = map[string]*theme{
+	themeEmoji: {
+		Symbols: map[string]string{
+			iconAdd: iconAdd, iconSource: iconSource, iconArchetype: iconArchetype,
+			iconTransformation: iconTransformation, iconDone: iconDone, iconWarning: iconWarning,
+			iconError: iconError, iconHint: iconHint, iconDocs: iconDocs, iconWatch: iconWatch,
+			iconDebug: iconDebug,
+		},
+		Spinner: spinnerFrames,
+	},
+	themeASCII: {
+		Symbols: map[string]string{
+			iconAdd: "[+]", iconSource: "[source]", iconArchetype: "[archetype]",
+			iconTransformation: "[file]", iconDone: "[ok]", iconWarning: "[warning]",
+			iconError: "[error]", iconHint: "[hint]", iconDocs: "[docs]", iconWatch: "[watch]",
+			iconDebug: "[debug]",
+		},
+		Colors:  map[string]string{iconDone: "green", iconWarning: "yellow", iconError: "red", iconHint: "cyan"},
+		Spinner: plainSpinnerFrames,
+	},
+	themeNone: {
+		Spinner: plainSpinnerFrames,
+	},
+}
+
+// themeFile is a theme file, overriding the symbols and colors of its base
+// theme by icon role.
+type themeFile struct {
+	Base    string            `yaml:"base"`
+	Symbols map[string]string `yaml:"symbols"`
+	Colors  map[string]string `yaml:"colors"`
+	Spinner []string          `yaml:"spinner"`
+}
+
+// loadTheme returns the built-in theme name, the emoji one by default, or the
+// theme of the name file.
+func loadTheme(name string) (*theme, error) {
+	if name == "" {
+		name = themeEmoji
+	}
+	if t, ok := themes[name]; ok {
+		return t, nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown theme %q, use %s, %s, %s or a theme file: %w", name, themeEmoji, themeASCII, themeNone, err)
+	}
+	tf := &themeFile{}
+	if err := yaml.UnmarshalStrict(b, tf); err != nil {
+		return nil, fmt.Errorf("invalid theme file %s: %w", name, err)
+	}
+	base, ok := themes[cmp.Or(tf.Base, themeEmoji)]
+	if !ok {
+		return nil, fmt.Errorf("invalid theme file %s: unknown base theme %q", name, tf.Base)
+	}
+	t := &theme{Symbols: maps.Clone(base.Symbols), Colors: maps.Clone(base.Colors), Spinner: base.Spinner}
+	if t.Symbols == nil {
+		t.Symbols = make(map[string]string)
+	}
+	if t.Colors == nil {
+		t.Colors = make(map[string]string)
+	}
+	for role, s := range tf.Symbols {
+		icon, ok := iconRoles[role]
+		if !ok {
+			return nil, fmt.Errorf("invalid theme file %s: unknown symbol %q, use one of %s", name, role, roleNames())
+		}
+		t.Symbols[icon] = s
+	}
+	for role, c := range tf.Colors {
+		icon, ok := iconRoles[role]
+		if !ok {
+			return nil, fmt.Errorf("invalid theme file %s: unknown symbol %q, use one of %s", name, role, roleNames())
+		}
+		if _, ok := ansiColors[c]; !ok && c != "" {
+			return nil, fmt.Errorf("invalid theme file %s: unknown color %q, use one of %s", name, c, strings.Join(slices.Sorted(maps.Keys(ansiColors)), ", "))
+		}
+		t.Colors[icon] = c
+	}
+	if len(tf.Spinner) > 0 {
+		t.Spinner = tf.Spinner
+	}
+	return t, nil
+}
+
+// roleNames returns the sorted icon roles of the theme files.
+func roleNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(iconRoles)), ", ")
+}
+
+// symbol returns the symbol of icon, colored with the ANSI escape codes if
+// color.
+func (t *theme) symbol(icon string, color bool) string {
+	s := t.Symbols[icon]
+	if code, ok := ansiColors[t.Colors[icon]]; ok && color && s != "" {
+		return "\033[" + code + "m" + s + "\033[0m"
+	}
+	return s
+}
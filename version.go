@@ -1,6 +1,65 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
 // Version can be set at link time to override debug.BuildInfo.Main.Version,
 // which is "(devel)" when building from within the module. See
 // golang.org/issue/29814 and golang.org/issue/29228.
 var Version = "v0.8.0"
+
+// Commit and BuildDate can be set at link time, otherwise they are taken from
+// the VCS information stamped by the go command, if any.
+var (
+	Commit    string
+	BuildDate string
+)
+
+// buildInfo is the build metadata printed by the version command.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+func getBuildInfo() buildInfo {
+	bi := buildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && bi.Commit == "":
+				bi.Commit = s.Value
+			case s.Key == "vcs.time" && bi.BuildDate == "":
+				bi.BuildDate = s.Value
+			}
+		}
+	}
+	return bi
+}
+
+func (bi buildInfo) print(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", exeName, bi.Version)
+	fmt.Fprintf(w, "commit:     %s\n", bi.Commit)
+	fmt.Fprintf(w, "build date: %s\n", bi.BuildDate)
+	fmt.Fprintf(w, "go version: %s\n", bi.GoVersion)
+	fmt.Fprintf(w, "platform:   %s\n", bi.Platform)
+}
+
+func (bi buildInfo) printJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bi)
+}